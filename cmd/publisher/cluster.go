@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/kchojn/poc-shared-publisher/internal/cluster"
+	"github.com/kchojn/poc-shared-publisher/internal/config"
+	"github.com/kchojn/poc-shared-publisher/internal/publisher"
+)
+
+// startCluster joins the publisher cluster and serves sequencers while this
+// node leads it. The returned function leaves the cluster.
+func startCluster(
+	ctx context.Context,
+	cfg *config.Config,
+	newServer publisher.ServerFactory,
+	log zerolog.Logger,
+) (*publisher.Member, func(context.Context), error) {
+	peers := make([]cluster.Peer, 0, len(cfg.Cluster.Peers))
+	for _, peer := range cfg.Cluster.Peers {
+		peers = append(peers, cluster.Peer{
+			ID:            peer.ID,
+			RaftAddr:      peer.RaftAddr,
+			PublisherAddr: peer.PublisherAddr,
+		})
+	}
+
+	dir := cfg.Cluster.Dir
+	if dir == "" && cfg.State.Dir != "" {
+		dir = filepath.Join(cfg.State.Dir, "raft")
+	}
+	if dir == "" {
+		log.Warn().Msg("Cluster directory not configured, the Raft log will not survive a restart")
+	}
+
+	node, err := cluster.NewNode(cluster.Config{
+		NodeID:            cfg.Cluster.NodeID,
+		Peers:             peers,
+		Dir:               dir,
+		ElectionTimeout:   cfg.Cluster.ElectionTimeout,
+		HeartbeatInterval: cfg.Cluster.HeartbeatInterval,
+		Compact:           publisher.CompactReplicated,
+	}, cluster.NewHTTPTransport(peers, cfg.Cluster.ElectionTimeout), log)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create cluster node: %w", err)
+	}
+
+	raftServer := &http.Server{
+		Addr:         cfg.Cluster.ListenAddr,
+		Handler:      cluster.NewHTTPHandler(node),
+		ReadTimeout:  5 * time.Second,
+		WriteTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		log.Info().Str("addr", cfg.Cluster.ListenAddr).Msg("Starting cluster RPC server")
+		if err := raftServer.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Error().Err(err).Msg("Cluster RPC server error")
+		}
+	}()
+
+	if err := node.Start(ctx); err != nil {
+		raftServer.Close()
+		node.Stop()
+		return nil, nil, fmt.Errorf("failed to start cluster node: %w", err)
+	}
+
+	member := publisher.NewMember(cfg, node, newServer, log)
+	go member.Run(ctx)
+
+	stop := func(shutdownCtx context.Context) {
+		log.Info().Msg("Stopping publisher...")
+		if err := member.Stop(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Publisher shutdown error")
+		}
+
+		log.Info().Msg("Leaving cluster...")
+		if err := raftServer.Shutdown(shutdownCtx); err != nil {
+			log.Error().Err(err).Msg("Cluster RPC server shutdown error")
+		}
+		if err := node.Stop(); err != nil {
+			log.Error().Err(err).Msg("Cluster node shutdown error")
+		}
+	}
+
+	return member, stop, nil
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"flag"
 	"fmt"
@@ -15,6 +16,7 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/rs/zerolog"
 
+	"github.com/kchojn/poc-shared-publisher/internal/auth"
 	"github.com/kchojn/poc-shared-publisher/internal/config"
 	"github.com/kchojn/poc-shared-publisher/internal/network"
 	"github.com/kchojn/poc-shared-publisher/internal/publisher"
@@ -62,24 +64,88 @@ func main() {
 
 	prometheus.MustRegister(metrics.NewRuntimeCollector())
 
-	serverCfg := network.ServerConfig{
-		ListenAddr:     cfg.Server.ListenAddr,
-		ReadTimeout:    cfg.Server.ReadTimeout,
-		WriteTimeout:   cfg.Server.WriteTimeout,
-		MaxMessageSize: cfg.Server.MaxMessageSize,
-		MaxConnections: cfg.Server.MaxConnections,
+	var capabilities []string
+	if cfg.Server.Compression {
+		capabilities = append(capabilities, network.CapabilityDeflate)
 	}
 
-	server := network.NewServer(serverCfg, log.Logger)
+	var serverTLS *tls.Config
+	if cfg.Server.TLSCertFile != "" {
+		serverTLS, err = network.LoadServerTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile, cfg.Server.TLSClientCAFile)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load TLS configuration")
+			return
+		}
+	}
+
+	// When signatures are enforced, sequencers prove the chain they serve by signing their Hello
+	var helloKeyring *auth.Keyring
+	if cfg.Auth.Mode == config.AuthModeEnforce {
+		helloKeyring, err = auth.NewKeyring(cfg.Auth.Keys)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to load auth keys")
+			return
+		}
+	}
+
+	newServer := func(epoch uint64) network.Server {
+		serverCfg := network.ServerConfig{
+			ListenAddr:     cfg.Server.ListenAddr,
+			ReadTimeout:    cfg.Server.ReadTimeout,
+			WriteTimeout:   cfg.Server.WriteTimeout,
+			MaxMessageSize: cfg.Server.MaxMessageSize,
+			MaxConnections: cfg.Server.MaxConnections,
+			Epoch:          epoch,
+
+			SendQueueSize:   cfg.Server.SendQueueSize,
+			SendQueuePolicy: network.QueuePolicy(cfg.Server.SendQueuePolicy),
+
+			HandshakeTimeout: cfg.Server.HandshakeTimeout,
+			ReconnectHint:    cfg.Server.ReconnectHint,
+			LegacyFraming:    cfg.Server.LegacyFraming,
+			TLS:              serverTLS,
+			ClientChains:     cfg.Server.TLSClientChains,
+			Keyring:          helloKeyring,
+			MessageTypes:     publisher.MessageTypes,
+			Capabilities:     capabilities,
+
+			HeartbeatInterval:   cfg.Server.HeartbeatInterval,
+			MaxMissedHeartbeats: cfg.Server.MaxMissedHeartbeats,
+		}
+		return network.NewServer(serverCfg, log.Logger)
+	}
 
-	pub := publisher.New(cfg, server, log.Logger)
+	var (
+		handler *publisher.HTTPHandler
+		stop    func(ctx context.Context)
+	)
+
+	if cfg.Cluster.Enabled {
+		member, stopCluster, err := startCluster(ctx, cfg, newServer, log.Logger)
+		if err != nil {
+			log.Error().Err(err).Msg("Failed to join cluster")
+			return
+		}
+		handler = publisher.NewClusterHTTPHandler(member, log.Logger)
+		stop = stopCluster
+	} else {
+		pub := publisher.New(cfg, newServer(0), log.Logger)
+
+		if err := pub.Start(ctx); err != nil {
+			log.Error().Err(err).Msg("Failed to start publisher")
+			return
+		}
 
-	if err := pub.Start(ctx); err != nil {
-		log.Error().Err(err).Msg("Failed to start publisher")
-		return
+		handler = publisher.NewHTTPHandler(pub, log.Logger)
+		stop = func(shutdownCtx context.Context) {
+			log.Info().Msg("Stopping publisher...")
+			if err := pub.Stop(shutdownCtx); err != nil {
+				log.Error().Err(err).Msg("Publisher shutdown error")
+			}
+		}
 	}
 
-	httpServer := startHTTPServer(pub, cfg, log.Logger)
+	httpServer := startHTTPServer(handler, cfg, log.Logger)
 
 	sigCh := make(chan os.Signal, 1)
 	signal.Notify(sigCh, syscall.SIGINT, syscall.SIGTERM)
@@ -95,18 +161,13 @@ func main() {
 		log.Error().Err(err).Msg("HTTP server shutdown error")
 	}
 
-	log.Info().Msg("Stopping publisher...")
-	if err := pub.Stop(shutdownCtx); err != nil {
-		log.Error().Err(err).Msg("Publisher shutdown error")
-	}
+	stop(shutdownCtx)
 
 	log.Info().Msg("Shutdown complete")
 }
 
 // startHTTPServer starts the HTTP server for metrics and health
-func startHTTPServer(pub *publisher.Publisher, cfg *config.Config, log zerolog.Logger) *http.Server {
-	handler := publisher.NewHTTPHandler(pub, log)
-
+func startHTTPServer(handler *publisher.HTTPHandler, cfg *config.Config, log zerolog.Logger) *http.Server {
 	addr := ":8081"
 	if cfg.Metrics.Port > 0 {
 		addr = fmt.Sprintf(":%d", cfg.Metrics.Port)
@@ -0,0 +1,192 @@
+// Package auth signs sequencer messages with ed25519 keys and verifies them
+// against a per-chain allowlist of public keys.
+package auth
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/internal/types"
+)
+
+// signingDomain separates message signatures from other uses of the same key.
+const signingDomain = "poc-shared-publisher/message/v1"
+
+var (
+	// ErrUnsigned is returned for messages without a signature.
+	ErrUnsigned = types.NewError(types.ErrCodeUnauthenticated, "message not signed")
+
+	// ErrUnknownKey is returned for signatures by a key not allowlisted for the signing chain.
+	ErrUnknownKey = types.NewError(types.ErrCodeUnauthenticated, "signing key not allowed for chain")
+
+	// ErrBadSignature is returned for signatures that do not match the message.
+	ErrBadSignature = types.NewError(types.ErrCodeUnauthenticated, "invalid signature")
+
+	// ErrSignerMismatch is returned for payloads that speak for another chain than the signer,
+	// such as a vote of chain A signed with a key of chain B.
+	ErrSignerMismatch = types.NewError(types.ErrCodeUnauthenticated, "payload signed by another chain")
+)
+
+// Signer signs messages on behalf of a chain.
+type Signer struct {
+	chainID []byte
+	key     ed25519.PrivateKey
+}
+
+// NewSigner creates a signer for chainID.
+func NewSigner(chainID []byte, key ed25519.PrivateKey) *Signer {
+	return &Signer{chainID: chainID, key: key}
+}
+
+// Sign signs the payload of msg and sets its signature.
+func (s *Signer) Sign(msg *pb.Message) error {
+	data, err := signingBytes(s.chainID, msg)
+	if err != nil {
+		return err
+	}
+
+	msg.Signature = &pb.Signature{
+		ChainId:   s.chainID,
+		PublicKey: s.key.Public().(ed25519.PublicKey),
+		Signature: ed25519.Sign(s.key, data),
+	}
+	return nil
+}
+
+// Keyring is the allowlist of public keys per chain.
+type Keyring struct {
+	keys map[string][]ed25519.PublicKey // Keyed by formatted chain ID
+}
+
+// NewKeyring parses an allowlist of hex encoded public keys keyed by hex
+// chain ID, e.g. "0x01": ["d75a98..."]. A chain may have several keys, so
+// keys can be rotated without downtime.
+func NewKeyring(keys map[string][]string) (*Keyring, error) {
+	k := &Keyring{keys: make(map[string][]ed25519.PublicKey, len(keys))}
+
+	for chain, hexKeys := range keys {
+		chainID, err := pb.ParseChainID(chain)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, hexKey := range hexKeys {
+			key, err := ParsePublicKey(hexKey)
+			if err != nil {
+				return nil, fmt.Errorf("chain %s: %w", chain, err)
+			}
+			k.keys[pb.FormatChainID(chainID)] = append(k.keys[pb.FormatChainID(chainID)], key)
+		}
+	}
+
+	return k, nil
+}
+
+// ParsePublicKey parses a hex encoded ed25519 public key.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := decodeHex(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid public key: %w", err)
+	}
+	if len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid public key: %d bytes, want %d", len(key), ed25519.PublicKeySize)
+	}
+	return key, nil
+}
+
+// Verify checks that msg is signed by an allowlisted key of the chain its
+// payload speaks for.
+func (k *Keyring) Verify(msg *pb.Message) error {
+	sig := msg.GetSignature()
+	if sig == nil || len(sig.Signature) == 0 {
+		return ErrUnsigned
+	}
+
+	if !k.allowed(sig.ChainId, sig.PublicKey) {
+		return fmt.Errorf("%w: chain %s", ErrUnknownKey, pb.FormatChainID(sig.ChainId))
+	}
+
+	data, err := signingBytes(sig.ChainId, msg)
+	if err != nil {
+		return err
+	}
+	if !ed25519.Verify(sig.PublicKey, data, sig.Signature) {
+		return fmt.Errorf("%w: chain %s", ErrBadSignature, pb.FormatChainID(sig.ChainId))
+	}
+
+	if claimed := claimedChain(msg); claimed != nil && !bytes.Equal(claimed, sig.ChainId) {
+		return fmt.Errorf("%w: payload of chain %s signed by chain %s",
+			ErrSignerMismatch, pb.FormatChainID(claimed), pb.FormatChainID(sig.ChainId))
+	}
+
+	return nil
+}
+
+func (k *Keyring) allowed(chainID []byte, key []byte) bool {
+	for _, allowed := range k.keys[pb.FormatChainID(chainID)] {
+		if allowed.Equal(ed25519.PublicKey(key)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Reason returns a short label for a Verify error, for logs and metrics.
+func Reason(err error) string {
+	switch {
+	case errors.Is(err, ErrUnsigned):
+		return "unsigned"
+	case errors.Is(err, ErrUnknownKey):
+		return "unknown_key"
+	case errors.Is(err, ErrBadSignature):
+		return "bad_signature"
+	case errors.Is(err, ErrSignerMismatch):
+		return "signer_mismatch"
+	}
+	return "error"
+}
+
+// signingBytes returns what a chain signs for msg: the domain, the chain ID
+// and the deterministically serialized payload. Envelope fields such as
+// sender_id, version, epoch and sequence are left out, as the publisher sets
+// them when relaying.
+func signingBytes(chainID []byte, msg *pb.Message) ([]byte, error) {
+	payload, err := proto.MarshalOptions{Deterministic: true}.Marshal(&pb.Message{Payload: msg.Payload})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	data := make([]byte, 0, len(signingDomain)+4+len(chainID)+len(payload))
+	data = append(data, signingDomain...)
+	data = binary.BigEndian.AppendUint32(data, uint32(len(chainID)))
+	data = append(data, chainID...)
+	data = append(data, payload...)
+
+	return data, nil
+}
+
+// claimedChain returns the chain a payload speaks for, or nil if any
+// allowlisted chain may send it.
+func claimedChain(msg *pb.Message) []byte {
+	switch payload := msg.Payload.(type) {
+	case *pb.Message_Vote:
+		return payload.Vote.SenderChainId
+	case *pb.Message_BlockSealed:
+		return payload.BlockSealed.ChainId
+	case *pb.Message_Hello:
+		return payload.Hello.ChainId
+	}
+	return nil
+}
+
+func decodeHex(s string) ([]byte, error) {
+	return hex.DecodeString(strings.TrimPrefix(strings.ToLower(s), "0x"))
+}
@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/internal/types"
+)
+
+func newKey(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	return key
+}
+
+func publicHex(key ed25519.PrivateKey) string {
+	return hex.EncodeToString(key.Public().(ed25519.PublicKey))
+}
+
+func newXTRequest() *pb.Message {
+	return &pb.Message{Payload: &pb.Message_XtRequest{XtRequest: &pb.XTRequest{
+		Transactions: []*pb.TransactionRequest{
+			{ChainId: []byte{0x01}, Transaction: [][]byte{{0xaa}}},
+			{ChainId: []byte{0x02}, Transaction: [][]byte{{0xbb}}},
+		},
+	}}}
+}
+
+func newVote(chainID []byte) *pb.Message {
+	return &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{
+		SenderChainId: chainID,
+		XtId:          &pb.XtID{Hash: []byte{0x01}},
+		Vote:          true,
+	}}}
+}
+
+func TestKeyring_Verify(t *testing.T) {
+	t.Parallel()
+
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+	keyA, keyA2, keyB, stranger := newKey(t), newKey(t), newKey(t), newKey(t)
+
+	keyring, err := NewKeyring(map[string][]string{
+		"0x01": {publicHex(keyA), publicHex(keyA2)},
+		"0x02": {"0x" + publicHex(keyB)},
+	})
+	require.NoError(t, err)
+
+	sign := func(chainID []byte, key ed25519.PrivateKey, msg *pb.Message) *pb.Message {
+		require.NoError(t, NewSigner(chainID, key).Sign(msg))
+		return msg
+	}
+
+	tests := []struct {
+		name    string
+		msg     func() *pb.Message
+		wantErr error
+	}{
+		{
+			name: "signed request",
+			msg:  func() *pb.Message { return sign(chainA, keyA, newXTRequest()) },
+		},
+		{
+			name: "second key of a chain",
+			msg:  func() *pb.Message { return sign(chainA, keyA2, newXTRequest()) },
+		},
+		{
+			name: "relayed with a new envelope",
+			msg: func() *pb.Message {
+				msg := sign(chainA, keyA, newXTRequest())
+				msg.SenderId = "publisher"
+				msg.Version = 4
+				msg.Epoch = 7
+				msg.Sequence = 42
+				msg.CorrelationId = 3
+
+				// Through the wire and back, as a recipient sees it
+				data, err := proto.Marshal(msg)
+				require.NoError(t, err)
+				var relayed pb.Message
+				require.NoError(t, proto.Unmarshal(data, &relayed))
+				return &relayed
+			},
+		},
+		{
+			name:    "unsigned",
+			msg:     newXTRequest,
+			wantErr: ErrUnsigned,
+		},
+		{
+			name:    "key not allowlisted",
+			msg:     func() *pb.Message { return sign(chainA, stranger, newXTRequest()) },
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name:    "key of another chain",
+			msg:     func() *pb.Message { return sign(chainA, keyB, newXTRequest()) },
+			wantErr: ErrUnknownKey,
+		},
+		{
+			name: "tampered payload",
+			msg: func() *pb.Message {
+				msg := sign(chainA, keyA, newXTRequest())
+				msg.GetXtRequest().Transactions[1].Transaction[0] = []byte{0xcc}
+				return msg
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "signature claims another chain",
+			msg: func() *pb.Message {
+				msg := sign(chainA, keyA, newXTRequest())
+				msg.Signature.ChainId = chainB
+				msg.Signature.PublicKey = keyB.Public().(ed25519.PublicKey)
+				return msg
+			},
+			wantErr: ErrBadSignature,
+		},
+		{
+			name: "own vote",
+			msg:  func() *pb.Message { return sign(chainB, keyB, newVote(chainB)) },
+		},
+		{
+			name:    "vote for another chain",
+			msg:     func() *pb.Message { return sign(chainB, keyB, newVote(chainA)) },
+			wantErr: ErrSignerMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			err := keyring.Verify(tt.msg())
+			if tt.wantErr == nil {
+				assert.NoError(t, err)
+				return
+			}
+
+			assert.ErrorIs(t, err, tt.wantErr)
+			assert.Equal(t, types.ErrCodeUnauthenticated, types.Code(err))
+			assert.NotEqual(t, "error", Reason(err))
+		})
+	}
+}
+
+func TestNewKeyring_RejectsInvalidKeys(t *testing.T) {
+	t.Parallel()
+
+	valid := publicHex(newKey(t))
+
+	tests := []struct {
+		name string
+		keys map[string][]string
+	}{
+		{name: "chain ID not hex", keys: map[string][]string{"chain-a": {valid}}},
+		{name: "empty chain ID", keys: map[string][]string{"0x": {valid}}},
+		{name: "key not hex", keys: map[string][]string{"0x01": {"not-a-key"}}},
+		{name: "short key", keys: map[string][]string{"0x01": {valid[:62]}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := NewKeyring(tt.keys)
+			assert.Error(t, err)
+		})
+	}
+}
@@ -0,0 +1,881 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/kchojn/poc-shared-publisher/pkg/metrics"
+)
+
+const (
+	// maxAppendEntries bounds the entries sent in a single AppendEntries RPC.
+	maxAppendEntries = 64
+
+	// defaultCompactEvery is how many entries are applied between compactions
+	// unless Config.CompactEvery is set.
+	defaultCompactEvery = 1024
+)
+
+// proposal is a client waiting for its entry to commit.
+type proposal struct {
+	term uint64
+	done chan error
+}
+
+// node implements the Node interface with the Raft consensus algorithm:
+// leader election, log replication and commitment by majority.
+type node struct {
+	cfg       Config
+	transport Transport
+	storage   storage
+	peers     []string // Other members
+	addrs     map[string]string
+	log       zerolog.Logger
+
+	mu               sync.Mutex
+	role             Role
+	term             uint64
+	votedFor         string
+	leaderID         string
+	snapshot         Snapshot
+	entries          []Entry // entries[0] is a sentinel for the last snapshot entry
+	commitIndex      uint64
+	lastApplied      uint64
+	electionDeadline time.Time
+	standAsideUntil  time.Time // No elections started before, after StepDown
+	heartbeatAt      time.Time
+	votes            map[string]bool
+	nextIndex        map[string]uint64
+	matchIndex       map[string]uint64
+	readyIndex       uint64 // No-op entry of the current leader term
+	ready            bool   // Leader has applied readyIndex
+	proposals        map[uint64]*proposal
+	stopped          bool
+
+	replicate  map[string]chan struct{}
+	leadership chan Leadership
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewNode creates a cluster node. The node stores its state in cfg.Dir, or in
+// memory when it is empty.
+func NewNode(cfg Config, transport Transport, log zerolog.Logger) (Node, error) {
+	if cfg.ElectionTimeout <= 0 || cfg.HeartbeatInterval <= 0 {
+		return nil, fmt.Errorf("election timeout and heartbeat interval must be positive")
+	}
+
+	n := &node{
+		cfg:        cfg,
+		transport:  transport,
+		storage:    memoryStorage{},
+		addrs:      make(map[string]string),
+		log:        log.With().Str("component", "cluster").Str("node_id", cfg.NodeID).Logger(),
+		proposals:  make(map[uint64]*proposal),
+		nextIndex:  make(map[string]uint64),
+		matchIndex: make(map[string]uint64),
+		replicate:  make(map[string]chan struct{}),
+		leadership: make(chan Leadership, 1),
+	}
+
+	member := false
+	for _, peer := range cfg.Peers {
+		n.addrs[peer.ID] = peer.PublisherAddr
+		if peer.ID == cfg.NodeID {
+			member = true
+			continue
+		}
+		n.peers = append(n.peers, peer.ID)
+		n.replicate[peer.ID] = make(chan struct{}, 1)
+	}
+	if !member {
+		return nil, fmt.Errorf("node %q is not a cluster member", cfg.NodeID)
+	}
+
+	if cfg.Dir != "" {
+		fs, err := openFileStorage(cfg.Dir)
+		if err != nil {
+			return nil, err
+		}
+		n.storage = fs
+	}
+
+	hs, snap, entries, err := n.storage.Load()
+	if err != nil {
+		n.storage.Close()
+		return nil, err
+	}
+	n.term = hs.Term
+	n.votedFor = hs.VotedFor
+	n.snapshot = snap
+	n.entries = append([]Entry{{Index: snap.Index, Term: snap.Term}}, entries...)
+	n.commitIndex = snap.Index
+	n.lastApplied = snap.Index
+
+	return n, nil
+}
+
+// Start joins the cluster.
+func (n *node) Start(ctx context.Context) error {
+	ctx, n.cancel = context.WithCancel(ctx)
+
+	n.mu.Lock()
+	n.resetElectionDeadlineLocked()
+	n.mu.Unlock()
+
+	n.log.Info().
+		Uint64("term", n.term).
+		Uint64("last_index", n.lastIndex()).
+		Int("members", len(n.peers)+1).
+		Msg("Cluster node started")
+
+	n.wg.Add(1)
+	go n.run(ctx)
+
+	for _, peer := range n.peers {
+		n.wg.Add(1)
+		go n.replicator(ctx, peer)
+	}
+
+	return nil
+}
+
+// Stop leaves the cluster and closes the storage.
+func (n *node) Stop() error {
+	if n.cancel != nil {
+		n.cancel()
+	}
+	n.wg.Wait()
+
+	n.mu.Lock()
+	n.stopped = true
+	n.stepDownLocked(n.term)
+	n.mu.Unlock()
+
+	return n.storage.Close()
+}
+
+// Propose appends data to the replicated log and returns once it committed.
+func (n *node) Propose(ctx context.Context, data []byte) error {
+	n.mu.Lock()
+
+	if n.stopped {
+		n.mu.Unlock()
+		return ErrStopped
+	}
+
+	if n.role != RoleLeader || !n.ready {
+		leader := n.leaderID
+		n.mu.Unlock()
+		return fmt.Errorf("%w: leader is %q", ErrNotLeader, leader)
+	}
+
+	entry := Entry{Index: n.lastIndex() + 1, Term: n.term, Data: data}
+	if err := n.appendLocked(entry); err != nil {
+		n.mu.Unlock()
+		return err
+	}
+
+	p := &proposal{term: n.term, done: make(chan error, 1)}
+	n.proposals[entry.Index] = p
+
+	n.signalAllLocked()
+	n.advanceCommitLocked()
+	n.mu.Unlock()
+
+	select {
+	case err := <-p.done:
+		return err
+	case <-ctx.Done():
+		n.mu.Lock()
+		delete(n.proposals, entry.Index)
+		n.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// Committed calls fn for the snapshot data and then the data of every
+// committed entry after it, in order.
+func (n *node) Committed(fn func(data []byte) error) error {
+	n.mu.Lock()
+	snapshot := n.snapshot.Data
+	committed := append([]Entry(nil), n.entries[1:n.offset(n.commitIndex)+1]...)
+	n.mu.Unlock()
+
+	for _, data := range snapshot {
+		if err := fn(data); err != nil {
+			return err
+		}
+	}
+
+	for _, entry := range committed {
+		if entry.Data == nil {
+			continue // Leader no-op
+		}
+		if err := fn(entry.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Leadership reports leadership changes.
+func (n *node) Leadership() <-chan Leadership {
+	return n.leadership
+}
+
+// StepDown gives up leadership, if this node leads. It starts no election
+// for twice the election timeout, past the deadlines of the followers, so one
+// of them is elected next. It still votes meanwhile.
+func (n *node) StepDown() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.role != RoleLeader {
+		return
+	}
+
+	n.stepDownLocked(n.term)
+	n.standAsideUntil = time.Now().Add(2 * n.cfg.ElectionTimeout)
+}
+
+// Status returns the node state.
+func (n *node) Status() Status {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	return Status{
+		NodeID:      n.cfg.NodeID,
+		Role:        n.role.String(),
+		Term:        n.term,
+		LeaderID:    n.leaderID,
+		LeaderAddr:  n.addrs[n.leaderID],
+		CommitIndex: n.commitIndex,
+		LastIndex:   n.lastIndex(),
+		Members:     len(n.peers) + 1,
+	}
+}
+
+// HandleRequestVote grants a vote to candidates with an up-to-date log.
+func (n *node) HandleRequestVote(req *RequestVoteRequest) *RequestVoteResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term > n.term {
+		// Only a granted vote postpones an election of a follower, so a
+		// candidate with a stale log cannot keep the others from standing
+		deadline, leading := n.electionDeadline, n.role == RoleLeader
+		n.stepDownLocked(req.Term)
+		if !leading {
+			n.electionDeadline = deadline
+		}
+	}
+
+	resp := &RequestVoteResponse{Term: n.term}
+	if req.Term < n.term {
+		return resp
+	}
+
+	last := n.entries[len(n.entries)-1]
+	upToDate := req.LastLogTerm > last.Term ||
+		(req.LastLogTerm == last.Term && req.LastLogIndex >= last.Index)
+
+	if (n.votedFor == "" || n.votedFor == req.CandidateID) && upToDate {
+		n.votedFor = req.CandidateID
+		if err := n.saveHardStateLocked(); err != nil {
+			n.log.Error().Err(err).Msg("Failed to persist vote")
+			n.votedFor = ""
+			return resp
+		}
+		n.resetElectionDeadlineLocked()
+		resp.VoteGranted = true
+
+		n.log.Debug().
+			Str("candidate", req.CandidateID).
+			Uint64("term", req.Term).
+			Msg("Vote granted")
+	}
+
+	return resp
+}
+
+// HandleAppendEntries accepts entries and heartbeats from the leader.
+func (n *node) HandleAppendEntries(req *AppendEntriesRequest) *AppendEntriesResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term > n.term || (req.Term == n.term && n.role != RoleFollower) {
+		n.stepDownLocked(req.Term)
+	}
+
+	resp := &AppendEntriesResponse{Term: n.term}
+	if req.Term < n.term {
+		return resp
+	}
+
+	if n.leaderID != req.LeaderID {
+		n.leaderID = req.LeaderID
+		n.log.Info().Str("leader", req.LeaderID).Uint64("term", req.Term).Msg("Following leader")
+	}
+	n.resetElectionDeadlineLocked()
+
+	lastNew := req.PrevLogIndex + uint64(len(req.Entries))
+	prevIndex, prevTerm, entries := req.PrevLogIndex, req.PrevLogTerm, req.Entries
+
+	// Entries up to the snapshot are committed, so they match the leader's
+	if prevIndex < n.snapshot.Index {
+		skip := min(n.snapshot.Index-prevIndex, uint64(len(entries)))
+		prevIndex, prevTerm, entries = n.snapshot.Index, n.snapshot.Term, entries[skip:]
+	}
+
+	// The log must contain the entry preceding the new ones
+	if prevIndex > n.lastIndex() {
+		resp.ConflictIndex = n.lastIndex() + 1
+		return resp
+	}
+	if term := n.entry(prevIndex).Term; term != prevTerm {
+		index := prevIndex
+		for index > n.snapshot.Index+1 && n.entry(index-1).Term == term {
+			index--
+		}
+		resp.ConflictIndex = index
+		return resp
+	}
+
+	for i, entry := range entries {
+		if entry.Index <= n.lastIndex() {
+			if n.entry(entry.Index).Term == entry.Term {
+				continue
+			}
+			if err := n.truncateLocked(entry.Index); err != nil {
+				n.log.Error().Err(err).Msg("Failed to truncate log")
+				return resp
+			}
+		}
+		if err := n.appendLocked(entries[i:]...); err != nil {
+			n.log.Error().Err(err).Msg("Failed to append entries")
+			return resp
+		}
+		break
+	}
+
+	if req.LeaderCommit > n.commitIndex {
+		n.commitLocked(min(req.LeaderCommit, lastNew))
+	}
+
+	resp.Success = true
+	return resp
+}
+
+// HandleInstallSnapshot replaces the log with the snapshot of the leader when
+// it holds entries this node has not applied.
+func (n *node) HandleInstallSnapshot(req *InstallSnapshotRequest) *InstallSnapshotResponse {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if req.Term > n.term || (req.Term == n.term && n.role != RoleFollower) {
+		n.stepDownLocked(req.Term)
+	}
+
+	resp := &InstallSnapshotResponse{Term: n.term}
+	if req.Term < n.term {
+		return resp
+	}
+
+	if n.leaderID != req.LeaderID {
+		n.leaderID = req.LeaderID
+		n.log.Info().Str("leader", req.LeaderID).Uint64("term", req.Term).Msg("Following leader")
+	}
+	n.resetElectionDeadlineLocked()
+
+	snap := req.Snapshot
+	if snap.Index <= n.commitIndex {
+		return resp
+	}
+
+	// Entries after the snapshot are kept if the log agrees with it
+	var rest []Entry
+	if snap.Index <= n.lastIndex() && n.entry(snap.Index).Term == snap.Term {
+		rest = n.entries[n.offset(snap.Index)+1:]
+	}
+
+	if err := n.installSnapshotLocked(snap, rest); err != nil {
+		n.log.Error().Err(err).Msg("Failed to install snapshot")
+		return resp
+	}
+
+	n.commitIndex = snap.Index
+	n.lastApplied = snap.Index
+	metrics.ClusterCommitIndex.Set(float64(snap.Index))
+
+	n.log.Info().Uint64("index", snap.Index).Str("leader", req.LeaderID).Msg("Installed snapshot")
+
+	return resp
+}
+
+// run drives elections and heartbeats until ctx is cancelled.
+func (n *node) run(ctx context.Context) {
+	defer n.wg.Done()
+
+	ticker := time.NewTicker(n.cfg.HeartbeatInterval / 2)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			n.tick(ctx, now)
+		}
+	}
+}
+
+func (n *node) tick(ctx context.Context, now time.Time) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	switch {
+	case n.role == RoleLeader:
+		if !now.Before(n.heartbeatAt) {
+			n.heartbeatAt = now.Add(n.cfg.HeartbeatInterval)
+			n.signalAllLocked()
+		}
+	case !now.Before(n.electionDeadline) && !now.Before(n.standAsideUntil):
+		n.startElectionLocked(ctx)
+	}
+}
+
+// startElectionLocked becomes a candidate for the next term and asks for votes.
+// Caller must hold n.mu.
+func (n *node) startElectionLocked(ctx context.Context) {
+	n.role = RoleCandidate
+	n.term++
+	n.votedFor = n.cfg.NodeID
+	n.leaderID = ""
+	n.votes = map[string]bool{n.cfg.NodeID: true}
+	n.resetElectionDeadlineLocked()
+
+	if err := n.saveHardStateLocked(); err != nil {
+		n.log.Error().Err(err).Msg("Failed to persist term")
+		return
+	}
+
+	metrics.ClusterElectionsTotal.Inc()
+	metrics.ClusterTerm.Set(float64(n.term))
+
+	n.log.Info().Uint64("term", n.term).Msg("Starting election")
+
+	if n.hasQuorum(len(n.votes)) {
+		n.becomeLeaderLocked()
+		return
+	}
+
+	last := n.entries[len(n.entries)-1]
+	req := &RequestVoteRequest{
+		Term:         n.term,
+		CandidateID:  n.cfg.NodeID,
+		LastLogIndex: last.Index,
+		LastLogTerm:  last.Term,
+	}
+
+	for _, peer := range n.peers {
+		go n.requestVote(ctx, peer, req)
+	}
+}
+
+func (n *node) requestVote(ctx context.Context, peer string, req *RequestVoteRequest) {
+	rpcCtx, cancel := context.WithTimeout(ctx, n.cfg.ElectionTimeout)
+	defer cancel()
+
+	resp, err := n.transport.RequestVote(rpcCtx, peer, req)
+	if err != nil {
+		n.log.Debug().Err(err).Str("peer", peer).Msg("RequestVote failed")
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if resp.Term > n.term {
+		n.stepDownLocked(resp.Term)
+		return
+	}
+
+	if n.role != RoleCandidate || n.term != req.Term || !resp.VoteGranted {
+		return
+	}
+
+	n.votes[peer] = true
+	if n.hasQuorum(len(n.votes)) {
+		n.becomeLeaderLocked()
+	}
+}
+
+// becomeLeaderLocked takes over the cluster and appends a no-op entry; once it
+// commits, every entry of earlier terms is committed too.
+// Caller must hold n.mu.
+func (n *node) becomeLeaderLocked() {
+	n.role = RoleLeader
+	n.leaderID = n.cfg.NodeID
+	n.ready = false
+
+	for _, peer := range n.peers {
+		n.nextIndex[peer] = n.lastIndex() + 1
+		n.matchIndex[peer] = 0
+	}
+
+	entry := Entry{Index: n.lastIndex() + 1, Term: n.term}
+	if err := n.appendLocked(entry); err != nil {
+		n.log.Error().Err(err).Msg("Failed to append leader no-op")
+		n.stepDownLocked(n.term)
+		return
+	}
+	n.readyIndex = entry.Index
+
+	metrics.ClusterLeader.Set(1)
+
+	n.log.Info().Uint64("term", n.term).Msg("Elected cluster leader")
+
+	n.heartbeatAt = time.Now().Add(n.cfg.HeartbeatInterval)
+	n.signalAllLocked()
+	n.advanceCommitLocked()
+}
+
+// stepDownLocked becomes a follower, moving to term if it is newer.
+// Caller must hold n.mu.
+func (n *node) stepDownLocked(term uint64) {
+	if term > n.term {
+		n.term = term
+		n.votedFor = ""
+		n.leaderID = ""
+		if err := n.saveHardStateLocked(); err != nil {
+			n.log.Error().Err(err).Msg("Failed to persist term")
+		}
+		metrics.ClusterTerm.Set(float64(term))
+	}
+
+	if n.role == RoleLeader {
+		n.log.Info().Uint64("term", n.term).Msg("Stepped down as cluster leader")
+		metrics.ClusterLeader.Set(0)
+		if n.ready {
+			n.notifyLeadershipLocked(false)
+		}
+	}
+
+	n.role = RoleFollower
+	n.ready = false
+	n.resetElectionDeadlineLocked()
+
+	// The outcome of pending proposals is unknown to this node from now on
+	for index, p := range n.proposals {
+		p.done <- ErrNotLeader
+		delete(n.proposals, index)
+	}
+}
+
+// replicator sends AppendEntries to a peer whenever it is signalled.
+func (n *node) replicator(ctx context.Context, peer string) {
+	defer n.wg.Done()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-n.replicate[peer]:
+			n.replicateTo(ctx, peer)
+		}
+	}
+}
+
+func (n *node) replicateTo(ctx context.Context, peer string) {
+	n.mu.Lock()
+	if n.role != RoleLeader {
+		n.mu.Unlock()
+		return
+	}
+
+	next := n.nextIndex[peer]
+	if next <= n.snapshot.Index {
+		// The peer misses entries that were compacted
+		req := &InstallSnapshotRequest{Term: n.term, LeaderID: n.cfg.NodeID, Snapshot: n.snapshot}
+		n.mu.Unlock()
+		n.sendSnapshot(ctx, peer, req)
+		return
+	}
+
+	end := min(n.lastIndex()+1, next+maxAppendEntries)
+	req := &AppendEntriesRequest{
+		Term:         n.term,
+		LeaderID:     n.cfg.NodeID,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  n.entry(next - 1).Term,
+		Entries:      append([]Entry(nil), n.entries[n.offset(next):n.offset(end)]...),
+		LeaderCommit: n.commitIndex,
+	}
+	n.mu.Unlock()
+
+	rpcCtx, cancel := context.WithTimeout(ctx, n.cfg.ElectionTimeout)
+	defer cancel()
+
+	resp, err := n.transport.AppendEntries(rpcCtx, peer, req)
+	if err != nil {
+		n.log.Debug().Err(err).Str("peer", peer).Msg("AppendEntries failed")
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if resp.Term > n.term {
+		n.stepDownLocked(resp.Term)
+		return
+	}
+
+	if n.role != RoleLeader || n.term != req.Term {
+		return
+	}
+
+	if !resp.Success {
+		next := min(resp.ConflictIndex, n.nextIndex[peer]-1)
+		n.nextIndex[peer] = max(next, 1)
+		n.signalLocked(peer)
+		return
+	}
+
+	match := req.PrevLogIndex + uint64(len(req.Entries))
+	if match > n.matchIndex[peer] {
+		n.matchIndex[peer] = match
+	}
+	n.nextIndex[peer] = match + 1
+
+	n.advanceCommitLocked()
+
+	if n.nextIndex[peer] <= n.lastIndex() {
+		n.signalLocked(peer)
+	}
+}
+
+// sendSnapshot installs the snapshot on a peer and resumes replication after it.
+func (n *node) sendSnapshot(ctx context.Context, peer string, req *InstallSnapshotRequest) {
+	rpcCtx, cancel := context.WithTimeout(ctx, n.cfg.ElectionTimeout)
+	defer cancel()
+
+	resp, err := n.transport.InstallSnapshot(rpcCtx, peer, req)
+	if err != nil {
+		n.log.Debug().Err(err).Str("peer", peer).Msg("InstallSnapshot failed")
+		return
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if resp.Term > n.term {
+		n.stepDownLocked(resp.Term)
+		return
+	}
+
+	if n.role != RoleLeader || n.term != req.Term {
+		return
+	}
+
+	if match := req.Snapshot.Index; match > n.matchIndex[peer] {
+		n.matchIndex[peer] = match
+		n.nextIndex[peer] = match + 1
+	}
+
+	n.advanceCommitLocked()
+
+	if n.nextIndex[peer] <= n.lastIndex() {
+		n.signalLocked(peer)
+	}
+}
+
+// advanceCommitLocked commits the newest entry of the current term stored on
+// a majority of the cluster.
+// Caller must hold n.mu.
+func (n *node) advanceCommitLocked() {
+	for index := n.lastIndex(); index > n.commitIndex; index-- {
+		if n.entry(index).Term != n.term {
+			break // Entries of earlier terms commit indirectly
+		}
+
+		replicas := 1
+		for _, peer := range n.peers {
+			if n.matchIndex[peer] >= index {
+				replicas++
+			}
+		}
+
+		if n.hasQuorum(replicas) {
+			n.commitLocked(index)
+			return
+		}
+	}
+}
+
+// commitLocked moves the commit index forward and applies the new entries.
+// Caller must hold n.mu.
+func (n *node) commitLocked(index uint64) {
+	if index <= n.commitIndex {
+		return
+	}
+	n.commitIndex = index
+	metrics.ClusterCommitIndex.Set(float64(index))
+
+	for n.lastApplied < n.commitIndex {
+		n.lastApplied++
+		entry := n.entry(n.lastApplied)
+
+		if p, ok := n.proposals[entry.Index]; ok {
+			if p.term == entry.Term {
+				p.done <- nil
+			} else {
+				p.done <- ErrNotLeader // Replaced by another leader's entry
+			}
+			delete(n.proposals, entry.Index)
+		}
+	}
+
+	if n.role == RoleLeader && !n.ready && n.lastApplied >= n.readyIndex {
+		n.ready = true
+		n.notifyLeadershipLocked(true)
+	}
+
+	n.compactLocked()
+}
+
+// compactLocked replaces the applied entries with a snapshot of what
+// cfg.Compact keeps of them, once enough entries were applied since the last
+// snapshot. Peers that miss the replaced entries are sent the snapshot.
+// Caller must hold n.mu.
+func (n *node) compactLocked() {
+	every := n.cfg.CompactEvery
+	if every == 0 {
+		every = defaultCompactEvery
+	}
+	if n.cfg.Compact == nil || n.lastApplied-n.snapshot.Index < every {
+		return
+	}
+
+	applied := n.offset(n.lastApplied)
+	data := append([][]byte(nil), n.snapshot.Data...)
+	for _, entry := range n.entries[1 : applied+1] {
+		if entry.Data != nil {
+			data = append(data, entry.Data)
+		}
+	}
+
+	kept, err := n.cfg.Compact(data)
+	if err != nil {
+		n.log.Error().Err(err).Msg("Failed to compact log")
+		return
+	}
+
+	snap := Snapshot{Index: n.lastApplied, Term: n.entry(n.lastApplied).Term, Data: kept}
+	if err := n.installSnapshotLocked(snap, n.entries[applied+1:]); err != nil {
+		n.log.Error().Err(err).Msg("Failed to save snapshot")
+		return
+	}
+
+	n.log.Debug().
+		Uint64("index", snap.Index).
+		Int("compacted", len(data)).
+		Int("kept", len(kept)).
+		Msg("Compacted log")
+}
+
+// installSnapshotLocked durably replaces the log with snap and the entries
+// after it.
+// Caller must hold n.mu.
+func (n *node) installSnapshotLocked(snap Snapshot, rest []Entry) error {
+	rest = append([]Entry(nil), rest...)
+	if err := n.storage.SaveSnapshot(snap, rest); err != nil {
+		return err
+	}
+
+	n.snapshot = snap
+	n.entries = append([]Entry{{Index: snap.Index, Term: snap.Term}}, rest...)
+	return nil
+}
+
+// appendLocked durably appends entries to the log.
+// Caller must hold n.mu.
+func (n *node) appendLocked(entries ...Entry) error {
+	if err := n.storage.Append(entries); err != nil {
+		return err
+	}
+	n.entries = append(n.entries, entries...)
+	return nil
+}
+
+// truncateLocked durably removes entries from index on.
+// Caller must hold n.mu.
+func (n *node) truncateLocked(index uint64) error {
+	if err := n.storage.TruncateFrom(index); err != nil {
+		return err
+	}
+	n.entries = n.entries[:n.offset(index)]
+
+	for i, p := range n.proposals {
+		if i >= index {
+			p.done <- ErrNotLeader
+			delete(n.proposals, i)
+		}
+	}
+	return nil
+}
+
+func (n *node) saveHardStateLocked() error {
+	return n.storage.SaveHardState(hardState{Term: n.term, VotedFor: n.votedFor})
+}
+
+func (n *node) notifyLeadershipLocked(leader bool) {
+	// Keep only the latest change for slow readers
+	select {
+	case <-n.leadership:
+	default:
+	}
+	n.leadership <- Leadership{Leader: leader, Term: n.term}
+}
+
+func (n *node) signalAllLocked() {
+	for _, peer := range n.peers {
+		n.signalLocked(peer)
+	}
+}
+
+func (n *node) signalLocked(peer string) {
+	select {
+	case n.replicate[peer] <- struct{}{}:
+	default:
+	}
+}
+
+func (n *node) resetElectionDeadlineLocked() {
+	timeout := n.cfg.ElectionTimeout + rand.N(n.cfg.ElectionTimeout)
+	n.electionDeadline = time.Now().Add(timeout)
+}
+
+// entry returns the entry at index, which must not precede the snapshot.
+func (n *node) entry(index uint64) Entry {
+	return n.entries[n.offset(index)]
+}
+
+// offset returns the position of index in n.entries.
+func (n *node) offset(index uint64) uint64 {
+	return index - n.snapshot.Index
+}
+
+func (n *node) lastIndex() uint64 {
+	return n.entries[len(n.entries)-1].Index
+}
+
+func (n *node) hasQuorum(count int) bool {
+	return count > (len(n.peers)+1)/2
+}
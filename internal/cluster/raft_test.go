@@ -0,0 +1,383 @@
+package cluster
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	testElectionTimeout   = 100 * time.Millisecond
+	testHeartbeatInterval = 20 * time.Millisecond
+	testWait              = 5 * time.Second
+)
+
+func newTestPeers(size int) []Peer {
+	peers := make([]Peer, size)
+	for i := range peers {
+		peers[i] = Peer{
+			ID:            fmt.Sprintf("node-%d", i+1),
+			PublisherAddr: fmt.Sprintf("127.0.0.1:%d", 8080+i),
+		}
+	}
+	return peers
+}
+
+func newTestConfig(id string, peers []Peer, dir string) Config {
+	return Config{
+		NodeID:            id,
+		Peers:             peers,
+		Dir:               dir,
+		ElectionTimeout:   testElectionTimeout,
+		HeartbeatInterval: testHeartbeatInterval,
+	}
+}
+
+// startMemoryCluster starts an in-process cluster of size nodes, with the
+// test config changed by opts.
+func startMemoryCluster(t *testing.T, size int, opts ...func(*Config)) (map[string]Node, *MemoryNetwork) {
+	t.Helper()
+
+	network := NewMemoryNetwork()
+	peers := newTestPeers(size)
+	nodes := make(map[string]Node, size)
+
+	for _, peer := range peers {
+		cfg := newTestConfig(peer.ID, peers, "")
+		for _, opt := range opts {
+			opt(&cfg)
+		}
+
+		node, err := NewNode(cfg, network.Transport(peer.ID), zerolog.Nop())
+		require.NoError(t, err)
+		network.Register(peer.ID, node)
+		nodes[peer.ID] = node
+	}
+
+	for _, node := range nodes {
+		require.NoError(t, node.Start(context.Background()))
+		t.Cleanup(func() { node.Stop() })
+	}
+
+	return nodes, network
+}
+
+// waitForLeader waits until one of nodes leads and is ready to accept proposals.
+func waitForLeader(t *testing.T, nodes map[string]Node) (string, Node) {
+	t.Helper()
+
+	deadline := time.Now().Add(testWait)
+	for time.Now().Before(deadline) {
+		for id, node := range nodes {
+			if node.Status().Role != RoleLeader.String() {
+				continue
+			}
+			select {
+			case change := <-node.Leadership():
+				if change.Leader {
+					return id, node
+				}
+			case <-time.After(testElectionTimeout):
+			}
+		}
+		time.Sleep(testHeartbeatInterval)
+	}
+
+	t.Fatal("no leader elected")
+	return "", nil
+}
+
+func committed(node Node) []string {
+	var data []string
+	_ = node.Committed(func(d []byte) error {
+		data = append(data, string(d))
+		return nil
+	})
+	return data
+}
+
+// compactDropped is a Config.Compact function dropping data starting with "-".
+func compactDropped(data [][]byte) ([][]byte, error) {
+	var kept [][]byte
+	for _, d := range data {
+		if !strings.HasPrefix(string(d), "-") {
+			kept = append(kept, d)
+		}
+	}
+	return kept, nil
+}
+
+// kept returns the committed data of node that compactDropped keeps.
+func kept(node Node) []string {
+	var data []string
+	for _, d := range committed(node) {
+		if !strings.HasPrefix(d, "-") {
+			data = append(data, d)
+		}
+	}
+	return data
+}
+
+func withCompaction(cfg *Config) {
+	cfg.Compact = compactDropped
+	cfg.CompactEvery = 4
+}
+
+func propose(t *testing.T, node Node, data string) {
+	t.Helper()
+
+	ctx, cancel := context.WithTimeout(context.Background(), testWait)
+	defer cancel()
+	require.NoError(t, node.Propose(ctx, []byte(data)))
+}
+
+func TestCluster_ReplicatesToAllNodes(t *testing.T) {
+	t.Parallel()
+
+	nodes, _ := startMemoryCluster(t, 3)
+	leaderID, leader := waitForLeader(t, nodes)
+
+	propose(t, leader, "a")
+	propose(t, leader, "b")
+
+	for id, node := range nodes {
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]string{"a", "b"}, committed(node))
+		}, testWait, testHeartbeatInterval, "node %s", id)
+
+		status := node.Status()
+		assert.Equal(t, leaderID, status.LeaderID)
+		assert.Equal(t, 3, status.Members)
+	}
+
+	for id, node := range nodes {
+		if id != leaderID {
+			err := node.Propose(context.Background(), []byte("c"))
+			assert.ErrorIs(t, err, ErrNotLeader)
+		}
+	}
+}
+
+func TestCluster_FailoverKeepsCommittedEntries(t *testing.T) {
+	t.Parallel()
+
+	nodes, network := startMemoryCluster(t, 3)
+	oldID, oldLeader := waitForLeader(t, nodes)
+	oldTerm := oldLeader.Status().Term
+
+	propose(t, oldLeader, "before")
+
+	// Isolate the leader; the others elect a new one
+	network.Disconnect(oldID)
+
+	rest := make(map[string]Node)
+	for id, node := range nodes {
+		if id != oldID {
+			rest[id] = node
+		}
+	}
+	newID, newLeader := waitForLeader(t, rest)
+	assert.NotEqual(t, oldID, newID)
+	assert.Greater(t, newLeader.Status().Term, oldTerm)
+
+	propose(t, newLeader, "after")
+
+	// The isolated leader cannot commit on its own
+	ctx, cancel := context.WithTimeout(context.Background(), 3*testElectionTimeout)
+	defer cancel()
+	assert.Error(t, oldLeader.Propose(ctx, []byte("lost")))
+
+	// Once back, it follows the new leader and drops its uncommitted entry
+	network.Reconnect(oldID)
+
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual([]string{"before", "after"}, committed(oldLeader))
+	}, testWait, testHeartbeatInterval)
+	assert.Eventually(t, func() bool {
+		return oldLeader.Status().Role == RoleFollower.String()
+	}, testWait, testHeartbeatInterval)
+}
+
+func TestCluster_CompactsLog(t *testing.T) {
+	t.Parallel()
+
+	nodes, network := startMemoryCluster(t, 3, withCompaction)
+	leaderID, leader := waitForLeader(t, nodes)
+
+	// One follower misses every entry until the others compacted them
+	var laggingID string
+	for id := range nodes {
+		if id != leaderID {
+			laggingID = id
+			break
+		}
+	}
+	network.Disconnect(laggingID)
+
+	var want []string
+	for i := range 20 {
+		if i%5 == 0 {
+			data := fmt.Sprintf("kept-%d", i)
+			want = append(want, data)
+			propose(t, leader, data)
+			continue
+		}
+		propose(t, leader, fmt.Sprintf("-%d", i))
+	}
+
+	assert.Equal(t, want, kept(leader))
+
+	n := leader.(*node)
+	n.mu.Lock()
+	assert.Positive(t, n.snapshot.Index)
+	assert.LessOrEqual(t, len(n.entries), 5, "applied entries were compacted")
+	n.mu.Unlock()
+
+	// The lagging follower catches up from the snapshot
+	network.Reconnect(laggingID)
+	lagging := nodes[laggingID]
+
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(want, kept(lagging))
+	}, testWait, testHeartbeatInterval)
+
+	l := lagging.(*node)
+	l.mu.Lock()
+	assert.Positive(t, l.snapshot.Index, "the follower installed the snapshot")
+	l.mu.Unlock()
+
+	propose(t, leader, "after")
+	assert.Eventually(t, func() bool {
+		return assert.ObjectsAreEqual(append(want, "after"), kept(lagging))
+	}, testWait, testHeartbeatInterval)
+}
+
+func TestCluster_StepDownHandsOverLeadership(t *testing.T) {
+	t.Parallel()
+
+	nodes, _ := startMemoryCluster(t, 3)
+	oldID, oldLeader := waitForLeader(t, nodes)
+	propose(t, oldLeader, "a")
+
+	oldLeader.StepDown()
+	assert.NotEqual(t, RoleLeader.String(), oldLeader.Status().Role)
+
+	others := make(map[string]Node, len(nodes)-1)
+	for id, node := range nodes {
+		if id != oldID {
+			others[id] = node
+		}
+	}
+	_, newLeader := waitForLeader(t, others)
+
+	propose(t, newLeader, "b")
+	assert.Equal(t, []string{"a", "b"}, committed(newLeader))
+}
+
+func TestCluster_HTTPTransport(t *testing.T) {
+	t.Parallel()
+
+	peers := newTestPeers(3)
+	listeners := make([]net.Listener, len(peers))
+	for i := range peers {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		listeners[i] = l
+		peers[i].RaftAddr = l.Addr().String()
+	}
+
+	nodes := make(map[string]Node)
+	for i, peer := range peers {
+		node, err := NewNode(
+			newTestConfig(peer.ID, peers, ""),
+			NewHTTPTransport(peers, testElectionTimeout),
+			zerolog.Nop(),
+		)
+		require.NoError(t, err)
+		nodes[peer.ID] = node
+
+		srv := &http.Server{Handler: NewHTTPHandler(node)}
+		go srv.Serve(listeners[i])
+		t.Cleanup(func() { srv.Close() })
+
+		require.NoError(t, node.Start(context.Background()))
+		t.Cleanup(func() { node.Stop() })
+	}
+
+	_, leader := waitForLeader(t, nodes)
+	propose(t, leader, "over-http")
+
+	for _, node := range nodes {
+		assert.Eventually(t, func() bool {
+			return assert.ObjectsAreEqual([]string{"over-http"}, committed(node))
+		}, testWait, testHeartbeatInterval)
+	}
+}
+
+func TestNode_RestoresStateFromDisk(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	peers := newTestPeers(1)
+	network := NewMemoryNetwork()
+
+	node, err := NewNode(newTestConfig(peers[0].ID, peers, dir), network.Transport(peers[0].ID), zerolog.Nop())
+	require.NoError(t, err)
+	require.NoError(t, node.Start(context.Background()))
+
+	_, leader := waitForLeader(t, map[string]Node{peers[0].ID: node})
+	propose(t, leader, "durable")
+	term := node.Status().Term
+	require.NoError(t, node.Stop())
+
+	node, err = NewNode(newTestConfig(peers[0].ID, peers, dir), network.Transport(peers[0].ID), zerolog.Nop())
+	require.NoError(t, err)
+	require.NoError(t, node.Start(context.Background()))
+	defer node.Stop()
+
+	assert.Equal(t, term, node.Status().Term)
+
+	// Entries of the previous run commit once the node leads again
+	waitForLeader(t, map[string]Node{peers[0].ID: node})
+	assert.Equal(t, []string{"durable"}, committed(node))
+	assert.Greater(t, node.Status().Term, term)
+}
+
+func TestNode_RestoresSnapshotFromDisk(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	peers := newTestPeers(1)
+	network := NewMemoryNetwork()
+
+	cfg := newTestConfig(peers[0].ID, peers, dir)
+	withCompaction(&cfg)
+
+	first, err := NewNode(cfg, network.Transport(peers[0].ID), zerolog.Nop())
+	require.NoError(t, err)
+	require.NoError(t, first.Start(context.Background()))
+
+	_, leader := waitForLeader(t, map[string]Node{peers[0].ID: first})
+	for _, data := range []string{"a", "-1", "-2", "b", "-3", "c"} {
+		propose(t, leader, data)
+	}
+	require.NoError(t, first.Stop())
+
+	restarted, err := NewNode(cfg, network.Transport(peers[0].ID), zerolog.Nop())
+	require.NoError(t, err)
+	require.NoError(t, restarted.Start(context.Background()))
+	defer restarted.Stop()
+
+	assert.Positive(t, restarted.(*node).snapshot.Index)
+
+	waitForLeader(t, map[string]Node{peers[0].ID: restarted})
+	assert.Equal(t, []string{"a", "b", "c"}, kept(restarted))
+}
@@ -0,0 +1,310 @@
+package cluster
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	raftLogFile      = "raft.log"
+	raftStateFile    = "raft-state.json"
+	raftSnapshotFile = "raft-snapshot.json"
+	recordHeaderSize = 8 // 4-byte length + 4-byte CRC32C
+	maxRecordSize    = 64 * 1024 * 1024
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// hardState is the part of the node state that must survive a restart
+// besides the log, so a node never votes twice in a term.
+type hardState struct {
+	Term     uint64 `json:"term"`
+	VotedFor string `json:"voted_for"`
+}
+
+// storage persists the hard state and the log of a node.
+type storage interface {
+	// Load returns the persisted hard state, snapshot and the log entries after it
+	Load() (hardState, Snapshot, []Entry, error)
+	// SaveHardState durably replaces the hard state
+	SaveHardState(hs hardState) error
+	// Append durably appends entries
+	Append(entries []Entry) error
+	// TruncateFrom durably removes entries with index >= index
+	TruncateFrom(index uint64) error
+	// SaveSnapshot durably replaces the log with snap and the entries after it
+	SaveSnapshot(snap Snapshot, entries []Entry) error
+	// Close releases the storage
+	Close() error
+}
+
+// memoryStorage keeps nothing; the node state lives only in memory.
+type memoryStorage struct{}
+
+func (memoryStorage) Load() (hardState, Snapshot, []Entry, error) {
+	return hardState{}, Snapshot{}, nil, nil
+}
+func (memoryStorage) SaveHardState(hardState) error        { return nil }
+func (memoryStorage) Append([]Entry) error                 { return nil }
+func (memoryStorage) TruncateFrom(uint64) error            { return nil }
+func (memoryStorage) SaveSnapshot(Snapshot, []Entry) error { return nil }
+func (memoryStorage) Close() error                         { return nil }
+
+// logRecord is a single record of the Raft log file: an entry or a truncation.
+type logRecord struct {
+	Entry    *Entry `json:"entry,omitempty"`
+	Truncate uint64 `json:"truncate,omitempty"`
+}
+
+// fileStorage persists the log as an append-only file of framed records and
+// the hard state as a small file replaced atomically.
+//
+// Records are framed like the publisher decision log: a 4-byte big-endian
+// length, a 4-byte CRC32C of the payload and the JSON record. A torn tail
+// left by a crash is truncated on load. A snapshot is written to its own file
+// before the log is rewritten without the entries it replaces, so entries a
+// crash left in between are skipped on load.
+type fileStorage struct {
+	dir  string
+	file *os.File
+}
+
+func openFileStorage(dir string) (*fileStorage, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create raft dir: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, raftLogFile), os.O_CREATE|os.O_RDWR, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open raft log: %w", err)
+	}
+
+	return &fileStorage{dir: dir, file: file}, nil
+}
+
+// Load returns the persisted hard state, snapshot and the log entries after it.
+func (s *fileStorage) Load() (hardState, Snapshot, []Entry, error) {
+	var (
+		hs   hardState
+		snap Snapshot
+	)
+
+	if err := s.readFile(raftStateFile, &hs); err != nil {
+		return hs, snap, nil, fmt.Errorf("failed to read raft state: %w", err)
+	}
+
+	if err := s.readFile(raftSnapshotFile, &snap); err != nil {
+		return hs, snap, nil, fmt.Errorf("failed to read raft snapshot: %w", err)
+	}
+
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return hs, snap, nil, fmt.Errorf("failed to seek raft log: %w", err)
+	}
+
+	var (
+		entries []Entry
+		offset  int64
+		reader  = bufio.NewReader(s.file)
+		header  = make([]byte, recordHeaderSize)
+	)
+
+	for {
+		rec, n, err := readRecord(reader, header)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				// Torn or corrupted tail: drop it so later appends stay readable
+				if err := s.file.Truncate(offset); err != nil {
+					return hs, snap, nil, fmt.Errorf("failed to truncate raft log: %w", err)
+				}
+			}
+			break
+		}
+		offset += n
+
+		switch {
+		case rec.Entry != nil && rec.Entry.Index <= snap.Index:
+			// Replaced by the snapshot before a crash rewrote the log
+		case rec.Entry != nil:
+			entries = append(entries, *rec.Entry)
+		case rec.Truncate > 0:
+			for len(entries) > 0 && entries[len(entries)-1].Index >= rec.Truncate {
+				entries = entries[:len(entries)-1]
+			}
+		}
+	}
+
+	return hs, snap, entries, nil
+}
+
+// SaveHardState durably replaces the hard state.
+func (s *fileStorage) SaveHardState(hs hardState) error {
+	if err := s.replaceFile(raftStateFile, hs); err != nil {
+		return fmt.Errorf("failed to save raft state: %w", err)
+	}
+	return nil
+}
+
+// SaveSnapshot durably replaces the log with snap and the entries after it.
+func (s *fileStorage) SaveSnapshot(snap Snapshot, entries []Entry) error {
+	if err := s.replaceFile(raftSnapshotFile, snap); err != nil {
+		return fmt.Errorf("failed to save raft snapshot: %w", err)
+	}
+
+	path := filepath.Join(s.dir, raftLogFile)
+	tmp := path + ".tmp"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to rewrite raft log: %w", err)
+	}
+
+	old := s.file
+	s.file = file
+	if err := s.Append(entries); err != nil {
+		s.file = old
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		s.file = old
+		file.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace raft log: %w", err)
+	}
+
+	old.Close()
+	return nil
+}
+
+// Append durably appends entries.
+func (s *fileStorage) Append(entries []Entry) error {
+	records := make([]logRecord, len(entries))
+	for i := range entries {
+		records[i] = logRecord{Entry: &entries[i]}
+	}
+	return s.write(records...)
+}
+
+// TruncateFrom durably removes entries with index >= index.
+func (s *fileStorage) TruncateFrom(index uint64) error {
+	return s.write(logRecord{Truncate: index})
+}
+
+// Close releases the storage.
+func (s *fileStorage) Close() error {
+	return s.file.Close()
+}
+
+// readFile decodes the JSON file name into v; a missing file leaves v as is.
+func (s *fileStorage) readFile(name string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(s.dir, name))
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return nil
+	case err != nil:
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// replaceFile durably replaces the JSON file name with v, through a
+// temporary file renamed over it.
+func (s *fileStorage) replaceFile(name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(s.dir, name+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, filepath.Join(s.dir, name))
+}
+
+func (s *fileStorage) write(records ...logRecord) error {
+	var buf []byte
+	for _, rec := range records {
+		payload, err := json.Marshal(rec)
+		if err != nil {
+			return fmt.Errorf("failed to marshal raft record: %w", err)
+		}
+
+		header := make([]byte, recordHeaderSize)
+		binary.BigEndian.PutUint32(header[0:4], uint32(len(payload)))
+		binary.BigEndian.PutUint32(header[4:8], crc32.Checksum(payload, crcTable))
+		buf = append(buf, header...)
+		buf = append(buf, payload...)
+	}
+
+	if _, err := s.file.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("failed to seek raft log: %w", err)
+	}
+
+	if _, err := s.file.Write(buf); err != nil {
+		return fmt.Errorf("failed to write raft log: %w", err)
+	}
+
+	if err := s.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync raft log: %w", err)
+	}
+
+	return nil
+}
+
+// readRecord reads one framed record and returns it with its size on disk.
+func readRecord(r io.Reader, header []byte) (logRecord, int64, error) {
+	var rec logRecord
+
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return rec, 0, fmt.Errorf("torn record header: %w", err)
+		}
+		return rec, 0, err
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return rec, 0, fmt.Errorf("record too large: %d bytes", size)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return rec, 0, fmt.Errorf("torn record payload: %w", err)
+	}
+
+	if crc32.Checksum(payload, crcTable) != binary.BigEndian.Uint32(header[4:8]) {
+		return rec, 0, errors.New("record checksum mismatch")
+	}
+
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return rec, 0, fmt.Errorf("failed to decode record: %w", err)
+	}
+
+	return rec, int64(recordHeaderSize) + int64(size), nil
+}
@@ -0,0 +1,255 @@
+package cluster
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	requestVotePath     = "/raft/request_vote"
+	appendEntriesPath   = "/raft/append_entries"
+	installSnapshotPath = "/raft/install_snapshot"
+)
+
+// httpTransport sends Raft RPCs as JSON over HTTP.
+type httpTransport struct {
+	peers  map[string]string // Peer ID to Raft address
+	client *http.Client
+}
+
+// NewHTTPTransport creates a transport reaching peers by their RaftAddr.
+func NewHTTPTransport(peers []Peer, timeout time.Duration) Transport {
+	addrs := make(map[string]string, len(peers))
+	for _, peer := range peers {
+		addrs[peer.ID] = peer.RaftAddr
+	}
+
+	return &httpTransport{
+		peers:  addrs,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+func (t *httpTransport) RequestVote(ctx context.Context, peerID string, req *RequestVoteRequest) (*RequestVoteResponse, error) {
+	var resp RequestVoteResponse
+	if err := t.call(ctx, peerID, requestVotePath, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (t *httpTransport) AppendEntries(ctx context.Context, peerID string, req *AppendEntriesRequest) (*AppendEntriesResponse, error) {
+	var resp AppendEntriesResponse
+	if err := t.call(ctx, peerID, appendEntriesPath, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (t *httpTransport) InstallSnapshot(ctx context.Context, peerID string, req *InstallSnapshotRequest) (*InstallSnapshotResponse, error) {
+	var resp InstallSnapshotResponse
+	if err := t.call(ctx, peerID, installSnapshotPath, req, &resp); err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+func (t *httpTransport) call(ctx context.Context, peerID, path string, req, resp interface{}) error {
+	addr, ok := t.peers[peerID]
+	if !ok {
+		return fmt.Errorf("%w: unknown peer %s", ErrUnreachable, peerID)
+	}
+
+	body, err := json.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+addr+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	httpResp, err := t.client.Do(httpReq)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrUnreachable, err)
+	}
+	defer httpResp.Body.Close()
+
+	if httpResp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: %s returned %s", ErrUnreachable, peerID, httpResp.Status)
+	}
+
+	if err := json.NewDecoder(httpResp.Body).Decode(resp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	return nil
+}
+
+// NewHTTPHandler serves the Raft RPCs of a node for the HTTP transport.
+func NewHTTPHandler(node RPCHandler) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(requestVotePath, func(w http.ResponseWriter, r *http.Request) {
+		var req RequestVoteRequest
+		if !decodeRPC(w, r, &req) {
+			return
+		}
+		writeRPC(w, node.HandleRequestVote(&req))
+	})
+
+	mux.HandleFunc(appendEntriesPath, func(w http.ResponseWriter, r *http.Request) {
+		var req AppendEntriesRequest
+		if !decodeRPC(w, r, &req) {
+			return
+		}
+		writeRPC(w, node.HandleAppendEntries(&req))
+	})
+
+	mux.HandleFunc(installSnapshotPath, func(w http.ResponseWriter, r *http.Request) {
+		var req InstallSnapshotRequest
+		if !decodeRPC(w, r, &req) {
+			return
+		}
+		writeRPC(w, node.HandleInstallSnapshot(&req))
+	})
+
+	return mux
+}
+
+func decodeRPC(w http.ResponseWriter, r *http.Request, req interface{}) bool {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return false
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		http.Error(w, "invalid request", http.StatusBadRequest)
+		return false
+	}
+
+	return true
+}
+
+func writeRPC(w http.ResponseWriter, resp interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// MemoryNetwork connects nodes of an in-process cluster, mainly for tests.
+// Nodes can be cut off to simulate crashes and partitions.
+type MemoryNetwork struct {
+	mu    sync.RWMutex
+	nodes map[string]RPCHandler
+	down  map[string]bool
+}
+
+// NewMemoryNetwork creates an empty in-process network.
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		nodes: make(map[string]RPCHandler),
+		down:  make(map[string]bool),
+	}
+}
+
+// Register makes a node reachable under id.
+func (m *MemoryNetwork) Register(id string, node RPCHandler) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nodes[id] = node
+}
+
+// Disconnect cuts a node off from all others.
+func (m *MemoryNetwork) Disconnect(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.down[id] = true
+}
+
+// Reconnect undoes Disconnect.
+func (m *MemoryNetwork) Reconnect(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.down, id)
+}
+
+// Transport returns the transport used by node id.
+func (m *MemoryNetwork) Transport(id string) Transport {
+	return &memoryTransport{network: m, from: id}
+}
+
+func (m *MemoryNetwork) route(from, to string) (RPCHandler, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	node, ok := m.nodes[to]
+	if !ok || m.down[from] || m.down[to] {
+		return nil, fmt.Errorf("%w: %s", ErrUnreachable, to)
+	}
+	return node, nil
+}
+
+// memoryTransport calls the handlers of other nodes directly.
+type memoryTransport struct {
+	network *MemoryNetwork
+	from    string
+}
+
+func (t *memoryTransport) RequestVote(ctx context.Context, peerID string, req *RequestVoteRequest) (*RequestVoteResponse, error) {
+	node, err := t.network.route(t.from, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return node.HandleRequestVote(req), nil
+}
+
+func (t *memoryTransport) AppendEntries(ctx context.Context, peerID string, req *AppendEntriesRequest) (*AppendEntriesResponse, error) {
+	node, err := t.network.route(t.from, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// Entries are copied as they would be by a real network
+	copied := *req
+	copied.Entries = append([]Entry(nil), req.Entries...)
+
+	resp := node.HandleAppendEntries(&copied)
+
+	// A reply from a node cut off meanwhile is lost
+	if _, err := t.network.route(t.from, peerID); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (t *memoryTransport) InstallSnapshot(ctx context.Context, peerID string, req *InstallSnapshotRequest) (*InstallSnapshotResponse, error) {
+	node, err := t.network.route(t.from, peerID)
+	if err != nil {
+		return nil, err
+	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	// The snapshot data is never modified, so it is shared instead of copied
+	resp := node.HandleInstallSnapshot(req)
+
+	// A reply from a node cut off meanwhile is lost
+	if _, err := t.network.route(t.from, peerID); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
@@ -0,0 +1,186 @@
+package cluster
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotLeader is returned when a proposal reaches a node that does not lead
+	// the cluster, or leadership was lost before the proposal committed.
+	ErrNotLeader = errors.New("not the cluster leader")
+
+	// ErrStopped is returned for proposals on a stopped node.
+	ErrStopped = errors.New("node stopped")
+
+	// ErrUnreachable is returned by transports when a peer cannot be reached.
+	ErrUnreachable = errors.New("peer unreachable")
+)
+
+// Role is the Raft role of a node.
+type Role int
+
+const (
+	RoleFollower Role = iota
+	RoleCandidate
+	RoleLeader
+)
+
+func (r Role) String() string {
+	switch r {
+	case RoleCandidate:
+		return "candidate"
+	case RoleLeader:
+		return "leader"
+	default:
+		return "follower"
+	}
+}
+
+// Peer is a cluster member.
+type Peer struct {
+	ID string
+	// RaftAddr is where the member serves Raft RPCs
+	RaftAddr string
+	// PublisherAddr is where sequencers connect while the member leads
+	PublisherAddr string
+}
+
+// Config contains node configuration.
+type Config struct {
+	// NodeID identifies this node; it must be one of Peers
+	NodeID string
+	// Peers lists every cluster member, including this node
+	Peers []Peer
+	// Dir stores the Raft log and vote. Empty keeps them in memory.
+	Dir string
+	// ElectionTimeout is the minimum time without a leader before an election;
+	// the actual timeout is randomized between one and two times this value.
+	ElectionTimeout time.Duration
+	// HeartbeatInterval is how often the leader contacts followers
+	HeartbeatInterval time.Duration
+	// Compact reduces the data of applied entries to what a replay of the log
+	// still needs; the node keeps the result as a snapshot instead of the
+	// entries. Nil keeps every entry.
+	Compact func(data [][]byte) ([][]byte, error)
+	// CompactEvery is how many entries are applied between compactions;
+	// 0 uses defaultCompactEvery
+	CompactEvery uint64
+}
+
+// Entry is a Raft log entry. Entries without data are leader no-ops.
+type Entry struct {
+	Index uint64 `json:"index"`
+	Term  uint64 `json:"term"`
+	Data  []byte `json:"data,omitempty"`
+}
+
+// Snapshot replaces the log entries up to Index once they are compacted.
+type Snapshot struct {
+	Index uint64   `json:"index"` // Last entry replaced
+	Term  uint64   `json:"term"`  // Term of that entry
+	Data  [][]byte `json:"data,omitempty"`
+}
+
+// Status describes a node for monitoring and client redirection.
+type Status struct {
+	NodeID      string `json:"node_id"`
+	Role        string `json:"role"`
+	Term        uint64 `json:"term"`
+	LeaderID    string `json:"leader_id,omitempty"`
+	LeaderAddr  string `json:"leader_addr,omitempty"` // Publisher address of the leader
+	CommitIndex uint64 `json:"commit_index"`
+	LastIndex   uint64 `json:"last_index"`
+	Members     int    `json:"members"`
+}
+
+// Leadership is a change of leadership of a node.
+type Leadership struct {
+	Leader bool
+	Term   uint64 // Term of the node at the change
+}
+
+// Node is a member of the replicated publisher cluster.
+type Node interface {
+	RPCHandler
+
+	// Start joins the cluster
+	Start(ctx context.Context) error
+	// Stop leaves the cluster and closes the storage
+	Stop() error
+	// Propose appends data to the replicated log and returns once it committed
+	Propose(ctx context.Context, data []byte) error
+	// Committed calls fn for the data of every committed entry, in order;
+	// compacted entries are represented by what Config.Compact kept of them
+	Committed(fn func(data []byte) error) error
+	// Leadership reports leadership changes: Leader once this node leads and
+	// has applied every entry of previous terms, not Leader when it stops
+	// leading. Only the latest change is kept for slow readers, so a reader
+	// that sees Leader twice must compare the terms.
+	Leadership() <-chan Leadership
+	// StepDown gives up leadership, if this node leads, and sits out the next
+	// election so another member takes over
+	StepDown()
+	// Status returns the node state
+	Status() Status
+}
+
+// RequestVoteRequest is sent by candidates to gather votes.
+type RequestVoteRequest struct {
+	Term         uint64 `json:"term"`
+	CandidateID  string `json:"candidate_id"`
+	LastLogIndex uint64 `json:"last_log_index"`
+	LastLogTerm  uint64 `json:"last_log_term"`
+}
+
+// RequestVoteResponse answers a RequestVoteRequest.
+type RequestVoteResponse struct {
+	Term        uint64 `json:"term"`
+	VoteGranted bool   `json:"vote_granted"`
+}
+
+// AppendEntriesRequest replicates entries; without entries it is a heartbeat.
+type AppendEntriesRequest struct {
+	Term         uint64  `json:"term"`
+	LeaderID     string  `json:"leader_id"`
+	PrevLogIndex uint64  `json:"prev_log_index"`
+	PrevLogTerm  uint64  `json:"prev_log_term"`
+	Entries      []Entry `json:"entries,omitempty"`
+	LeaderCommit uint64  `json:"leader_commit"`
+}
+
+// AppendEntriesResponse answers an AppendEntriesRequest.
+type AppendEntriesResponse struct {
+	Term    uint64 `json:"term"`
+	Success bool   `json:"success"`
+	// ConflictIndex is where the leader should resume replication after a rejection
+	ConflictIndex uint64 `json:"conflict_index,omitempty"`
+}
+
+// InstallSnapshotRequest replaces the log of a follower that misses entries
+// the leader has compacted.
+type InstallSnapshotRequest struct {
+	Term     uint64   `json:"term"`
+	LeaderID string   `json:"leader_id"`
+	Snapshot Snapshot `json:"snapshot"`
+}
+
+// InstallSnapshotResponse answers an InstallSnapshotRequest.
+type InstallSnapshotResponse struct {
+	Term uint64 `json:"term"`
+}
+
+// RPCHandler serves Raft RPCs from other nodes.
+type RPCHandler interface {
+	HandleRequestVote(req *RequestVoteRequest) *RequestVoteResponse
+	HandleAppendEntries(req *AppendEntriesRequest) *AppendEntriesResponse
+	HandleInstallSnapshot(req *InstallSnapshotRequest) *InstallSnapshotResponse
+}
+
+// Transport carries Raft RPCs to other nodes.
+type Transport interface {
+	RequestVote(ctx context.Context, peerID string, req *RequestVoteRequest) (*RequestVoteResponse, error)
+	AppendEntries(ctx context.Context, peerID string, req *AppendEntriesRequest) (*AppendEntriesResponse, error)
+	InstallSnapshot(ctx context.Context, peerID string, req *InstallSnapshotRequest) (*InstallSnapshotResponse, error)
+}
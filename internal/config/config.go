@@ -6,20 +6,90 @@ import (
 	"time"
 
 	"github.com/spf13/viper"
+
+	"github.com/kchojn/poc-shared-publisher/internal/auth"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// Signature verification modes
+const (
+	AuthModeOff     = "off"     // Messages are not verified
+	AuthModeFlag    = "flag"    // Failures are logged and counted, the message is still handled
+	AuthModeEnforce = "enforce" // Failing messages are answered with an unauthenticated error
 )
 
 type Config struct {
-	Server  ServerConfig  `mapstructure:"server"`
-	Metrics MetricsConfig `mapstructure:"metrics"`
-	Log     LogConfig     `mapstructure:"log"`
+	Server    ServerConfig    `mapstructure:"server"`
+	Consensus ConsensusConfig `mapstructure:"consensus"`
+	State     StateConfig     `mapstructure:"state"`
+	Slot      SlotConfig      `mapstructure:"slot"`
+	Cluster   ClusterConfig   `mapstructure:"cluster"`
+	Auth      AuthConfig      `mapstructure:"auth"`
+	Metrics   MetricsConfig   `mapstructure:"metrics"`
+	Log       LogConfig       `mapstructure:"log"`
 }
 
 type ServerConfig struct {
-	ListenAddr     string        `mapstructure:"listen_addr" env:"SERVER_LISTEN_ADDR"`
+	ListenAddr     string        `mapstructure:"listen_addr" env:"SERVER_LISTEN_ADDR"` // host:port, tcp://host:port or unix:///path/to.sock
 	ReadTimeout    time.Duration `mapstructure:"read_timeout" env:"SERVER_READ_TIMEOUT"`
 	WriteTimeout   time.Duration `mapstructure:"write_timeout" env:"SERVER_WRITE_TIMEOUT"`
 	MaxMessageSize int           `mapstructure:"max_message_size" env:"SERVER_MAX_MESSAGE_SIZE"`
 	MaxConnections int           `mapstructure:"max_connections" env:"SERVER_MAX_CONNECTIONS"`
+
+	SendQueueSize   int    `mapstructure:"send_queue_size" env:"SERVER_SEND_QUEUE_SIZE"`     // messages waiting to be written per connection
+	SendQueuePolicy string `mapstructure:"send_queue_policy" env:"SERVER_SEND_QUEUE_POLICY"` // drop_oldest, drop_newest or disconnect when the queue is full
+
+	HandshakeTimeout time.Duration `mapstructure:"handshake_timeout" env:"SERVER_HANDSHAKE_TIMEOUT"` // time a new connection has to send its Hello
+	ReconnectHint    time.Duration `mapstructure:"reconnect_hint" env:"SERVER_RECONNECT_HINT"`       // reconnect delay suggested to sequencers on shutdown, 0 for none
+
+	HeartbeatInterval   time.Duration `mapstructure:"heartbeat_interval" env:"SERVER_HEARTBEAT_INTERVAL"`       // time between Pings, 0 disables heartbeats
+	MaxMissedHeartbeats int           `mapstructure:"max_missed_heartbeats" env:"SERVER_MAX_MISSED_HEARTBEATS"` // unanswered Pings before a connection is closed
+
+	Compression   bool `mapstructure:"compression" env:"SERVER_COMPRESSION"`       // offer DEFLATE compression to sequencers
+	LegacyFraming bool `mapstructure:"legacy_framing" env:"SERVER_LEGACY_FRAMING"` // also accept frames without magic and checksum
+
+	TLSCertFile     string            `mapstructure:"tls_cert_file" env:"SERVER_TLS_CERT_FILE"`           // PEM certificate, empty serves plain TCP
+	TLSKeyFile      string            `mapstructure:"tls_key_file" env:"SERVER_TLS_KEY_FILE"`             // PEM private key of the certificate
+	TLSClientCAFile string            `mapstructure:"tls_client_ca_file" env:"SERVER_TLS_CLIENT_CA_FILE"` // require client certificates signed by these CAs (mutual TLS)
+	TLSClientChains map[string]string `mapstructure:"tls_client_chains"`                                  // chain ID each client certificate identity may announce
+}
+
+type ConsensusConfig struct {
+	Timeout             time.Duration `mapstructure:"timeout" env:"CONSENSUS_TIMEOUT"`                               // vote deadline per xT
+	MaxInflightPerChain int           `mapstructure:"max_inflight_per_chain" env:"CONSENSUS_MAX_INFLIGHT_PER_CHAIN"` // xTs in prepare phase per chain
+}
+
+type StateConfig struct {
+	Dir string `mapstructure:"dir" env:"STATE_DIR"` // decision log directory, empty disables persistence
+}
+
+type SlotConfig struct {
+	Enabled      bool          `mapstructure:"enabled" env:"SLOT_ENABLED"`
+	Duration     time.Duration `mapstructure:"duration" env:"SLOT_DURATION"`           // length of a slot
+	SealOffset   time.Duration `mapstructure:"seal_offset" env:"SLOT_SEAL_OFFSET"`     // RequestSeal after slot start
+	SealDeadline time.Duration `mapstructure:"seal_deadline" env:"SLOT_SEAL_DEADLINE"` // acks due after RequestSeal
+}
+
+type ClusterConfig struct {
+	Enabled           bool          `mapstructure:"enabled" env:"CLUSTER_ENABLED"`
+	NodeID            string        `mapstructure:"node_id" env:"CLUSTER_NODE_ID"`
+	ListenAddr        string        `mapstructure:"listen_addr" env:"CLUSTER_LISTEN_ADDR"` // Raft RPC address
+	Dir               string        `mapstructure:"dir" env:"CLUSTER_DIR"`                 // Raft state, defaults to <state.dir>/raft
+	Peers             []PeerConfig  `mapstructure:"peers"`                                 // all members, including this node
+	ElectionTimeout   time.Duration `mapstructure:"election_timeout" env:"CLUSTER_ELECTION_TIMEOUT"`
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval" env:"CLUSTER_HEARTBEAT_INTERVAL"`
+	ProposeTimeout    time.Duration `mapstructure:"propose_timeout" env:"CLUSTER_PROPOSE_TIMEOUT"` // wait for a log record to commit
+}
+
+type PeerConfig struct {
+	ID            string `mapstructure:"id"`
+	RaftAddr      string `mapstructure:"raft_addr"`
+	PublisherAddr string `mapstructure:"publisher_addr"` // where sequencers connect while the member leads
+}
+
+type AuthConfig struct {
+	Mode string              `mapstructure:"mode" env:"AUTH_MODE"` // off, flag or enforce
+	Keys map[string][]string `mapstructure:"keys"`                 // hex ed25519 public keys allowed per hex chain ID
 }
 
 type MetricsConfig struct {
@@ -48,6 +118,30 @@ func Load(path string) (*Config, error) {
 	viper.SetDefault("server.write_timeout", "30s")
 	viper.SetDefault("server.max_message_size", 10*1024*1024) // 10MB
 	viper.SetDefault("server.max_connections", 100)
+	viper.SetDefault("server.send_queue_size", 256)
+	viper.SetDefault("server.send_queue_policy", "disconnect")
+	viper.SetDefault("server.handshake_timeout", "5s")
+	viper.SetDefault("server.reconnect_hint", "1s")
+	viper.SetDefault("server.heartbeat_interval", "10s")
+	viper.SetDefault("server.max_missed_heartbeats", 3)
+	viper.SetDefault("server.compression", false)
+	viper.SetDefault("server.legacy_framing", false)
+
+	viper.SetDefault("consensus.timeout", "30s")
+	viper.SetDefault("consensus.max_inflight_per_chain", 1)
+
+	viper.SetDefault("slot.enabled", false)
+	viper.SetDefault("slot.duration", "12s")
+	viper.SetDefault("slot.seal_offset", "8s")
+	viper.SetDefault("slot.seal_deadline", "2s")
+
+	viper.SetDefault("cluster.enabled", false)
+	viper.SetDefault("cluster.listen_addr", ":9090")
+	viper.SetDefault("cluster.election_timeout", "1s")
+	viper.SetDefault("cluster.heartbeat_interval", "100ms")
+	viper.SetDefault("cluster.propose_timeout", "5s")
+
+	viper.SetDefault("auth.mode", AuthModeOff)
 
 	viper.SetDefault("metrics.enabled", true)
 	viper.SetDefault("metrics.port", 8081)
@@ -74,12 +168,71 @@ func Load(path string) (*Config, error) {
 }
 
 func (c *Config) Validate() error {
+	if scheme, _, found := strings.Cut(c.Server.ListenAddr, "://"); found && scheme != "tcp" && scheme != "unix" {
+		return fmt.Errorf("server.listen_addr must be a tcp:// or unix:// address")
+	}
 	if c.Server.MaxMessageSize <= 0 {
 		return fmt.Errorf("server.max_message_size must be positive")
 	}
+	if c.Server.MaxMessageSize >= 1<<31 {
+		return fmt.Errorf("server.max_message_size must be below 2GiB")
+	}
 	if c.Server.MaxConnections <= 0 {
 		return fmt.Errorf("server.max_connections must be positive")
 	}
+	if c.Server.SendQueueSize <= 0 {
+		return fmt.Errorf("server.send_queue_size must be positive")
+	}
+	switch c.Server.SendQueuePolicy {
+	case "drop_oldest", "drop_newest", "disconnect":
+	default:
+		return fmt.Errorf("server.send_queue_policy must be drop_oldest, drop_newest or disconnect")
+	}
+	if c.Server.HandshakeTimeout <= 0 {
+		return fmt.Errorf("server.handshake_timeout must be positive")
+	}
+	if c.Server.ReconnectHint < 0 {
+		return fmt.Errorf("server.reconnect_hint must not be negative")
+	}
+	if c.Server.HeartbeatInterval < 0 {
+		return fmt.Errorf("server.heartbeat_interval must not be negative")
+	}
+	if c.Server.HeartbeatInterval > 0 && c.Server.MaxMissedHeartbeats < 1 {
+		return fmt.Errorf("server.max_missed_heartbeats must be at least 1")
+	}
+	if err := c.Server.validateTLS(); err != nil {
+		return err
+	}
+
+	if c.Consensus.Timeout <= 0 {
+		return fmt.Errorf("consensus.timeout must be positive")
+	}
+
+	if c.Consensus.MaxInflightPerChain < 1 {
+		return fmt.Errorf("consensus.max_inflight_per_chain must be at least 1")
+	}
+
+	if c.Slot.Enabled {
+		if c.Slot.Duration <= 0 {
+			return fmt.Errorf("slot.duration must be positive")
+		}
+		if c.Slot.SealOffset <= 0 || c.Slot.SealDeadline <= 0 {
+			return fmt.Errorf("slot.seal_offset and slot.seal_deadline must be positive")
+		}
+		if c.Slot.SealOffset+c.Slot.SealDeadline > c.Slot.Duration {
+			return fmt.Errorf("slot.seal_offset + slot.seal_deadline must not exceed slot.duration")
+		}
+	}
+
+	if c.Cluster.Enabled {
+		if err := c.Cluster.validate(); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Auth.validate(); err != nil {
+		return err
+	}
 
 	if c.Metrics.Enabled && c.Metrics.Port <= 0 {
 		return fmt.Errorf("metrics.port must be positive when metrics enabled")
@@ -87,3 +240,69 @@ func (c *Config) Validate() error {
 
 	return nil
 }
+
+func (c *ServerConfig) validateTLS() error {
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return fmt.Errorf("server.tls_cert_file and server.tls_key_file must be set together")
+	}
+	if c.TLSClientCAFile != "" && c.TLSCertFile == "" {
+		return fmt.Errorf("server.tls_client_ca_file requires server.tls_cert_file")
+	}
+	if len(c.TLSClientChains) > 0 && c.TLSClientCAFile == "" {
+		return fmt.Errorf("server.tls_client_chains requires server.tls_client_ca_file")
+	}
+	for identity, chain := range c.TLSClientChains {
+		if _, err := pb.ParseChainID(chain); err != nil {
+			return fmt.Errorf("server.tls_client_chains: invalid chain ID %q for %q", chain, identity)
+		}
+	}
+
+	return nil
+}
+
+func (c *AuthConfig) validate() error {
+	switch c.Mode {
+	case AuthModeOff:
+		return nil
+	case AuthModeFlag, AuthModeEnforce:
+	default:
+		return fmt.Errorf("auth.mode must be %s, %s or %s", AuthModeOff, AuthModeFlag, AuthModeEnforce)
+	}
+
+	if len(c.Keys) == 0 {
+		return fmt.Errorf("auth.keys must list at least one chain when auth.mode is %s", c.Mode)
+	}
+	if _, err := auth.NewKeyring(c.Keys); err != nil {
+		return fmt.Errorf("auth.keys: %w", err)
+	}
+
+	return nil
+}
+
+func (c *ClusterConfig) validate() error {
+	if c.NodeID == "" {
+		return fmt.Errorf("cluster.node_id is required")
+	}
+	if c.ElectionTimeout <= 0 || c.HeartbeatInterval <= 0 || c.ProposeTimeout <= 0 {
+		return fmt.Errorf("cluster timeouts must be positive")
+	}
+	if c.HeartbeatInterval >= c.ElectionTimeout {
+		return fmt.Errorf("cluster.heartbeat_interval must be shorter than cluster.election_timeout")
+	}
+
+	seen := make(map[string]bool, len(c.Peers))
+	for _, peer := range c.Peers {
+		if peer.ID == "" || peer.RaftAddr == "" || peer.PublisherAddr == "" {
+			return fmt.Errorf("cluster.peers entries need id, raft_addr and publisher_addr")
+		}
+		if seen[peer.ID] {
+			return fmt.Errorf("duplicate cluster peer %q", peer.ID)
+		}
+		seen[peer.ID] = true
+	}
+	if !seen[c.NodeID] {
+		return fmt.Errorf("cluster.node_id %q is not listed in cluster.peers", c.NodeID)
+	}
+
+	return nil
+}
@@ -0,0 +1,361 @@
+package consensus
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/kchojn/poc-shared-publisher/internal/auth"
+	"github.com/kchojn/poc-shared-publisher/internal/network"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// Validator decides whether the sequencer can include the transactions of its chain.
+// Returning an error is treated as an abort vote.
+type Validator func(ctx context.Context, xtID *pb.XtID, txs []*pb.TransactionRequest) (bool, error)
+
+// Outcome is the decided result of an xT the participant took part in.
+type Outcome struct {
+	XtID         *pb.XtID
+	Transactions []*pb.TransactionRequest // Transactions for the participant's chain
+	Decision     bool
+	Voted        bool // False if the decision arrived before the vote was sent
+}
+
+// OutcomeHandler is called exactly once per decided xT.
+type OutcomeHandler func(ctx context.Context, outcome Outcome)
+
+// ParticipantConfig contains participant configuration.
+type ParticipantConfig struct {
+	// ChainID is the chain the sequencer is responsible for
+	ChainID []byte
+	// ValidateTimeout bounds the Validator call. Zero means no limit.
+	ValidateTimeout time.Duration
+	// Retention is how long decided xTs are remembered to drop duplicates,
+	// and how long undecided xTs wait for their decision before they are
+	// forgotten without an outcome.
+	Retention time.Duration
+	// Keyring, if set, drops xT requests not signed by an allowlisted key
+	// of the sequencer that submitted them.
+	Keyring *auth.Keyring
+}
+
+// Participant is the sequencer side of the two-phase commit.
+type Participant interface {
+	// Resync resends votes for undecided xTs. It runs whenever the client
+	// (re)connects, so votes lost with a connection are sent again
+	Resync(ctx context.Context) error
+	// GetState returns the decision state of a known xT
+	GetState(xtID *pb.XtID) (DecisionState, bool)
+	// SetFallbackHandler sets the handler for messages not related to 2PC
+	SetFallbackHandler(handler network.MessageHandler)
+	// SetStateHandler sets the handler for the client's connection state changes
+	SetStateHandler(handler network.StateHandler)
+}
+
+// participantTx is the participant view of a single xT.
+type participantTx struct {
+	xtID       *pb.XtID
+	txs        []*pb.TransactionRequest
+	vote       *bool
+	decision   DecisionState
+	receivedAt time.Time
+	decidedAt  time.Time
+}
+
+// participant implements the Participant interface on top of network.Client.
+type participant struct {
+	cfg       ParticipantConfig
+	client    network.Client
+	validate  Validator
+	onOutcome OutcomeHandler
+	log       zerolog.Logger
+
+	mu       sync.Mutex
+	txs      map[string]*participantTx // keyed by xT ID hex
+	fallback network.MessageHandler
+	onState  network.StateHandler
+}
+
+// NewParticipant creates a participant and installs it as the client's
+// message and state handler.
+func NewParticipant(
+	cfg ParticipantConfig,
+	client network.Client,
+	validate Validator,
+	onOutcome OutcomeHandler,
+	log zerolog.Logger,
+) Participant {
+	if cfg.Retention <= 0 {
+		cfg.Retention = 10 * time.Minute
+	}
+
+	p := &participant{
+		cfg:       cfg,
+		client:    client,
+		validate:  validate,
+		onOutcome: onOutcome,
+		log: log.With().
+			Str("component", "participant").
+			Str("chain_id", pb.FormatChainID(cfg.ChainID)).
+			Logger(),
+		txs: make(map[string]*participantTx),
+	}
+
+	client.SetHandler(p.handleMessage)
+	client.SetStateHandler(p.handleState)
+
+	return p
+}
+
+// SetFallbackHandler sets the handler for messages not related to 2PC.
+func (p *participant) SetFallbackHandler(handler network.MessageHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.fallback = handler
+}
+
+// SetStateHandler sets the handler for the client's connection state changes.
+func (p *participant) SetStateHandler(handler network.StateHandler) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.onState = handler
+}
+
+// handleState resyncs votes once the client is connected again.
+func (p *participant) handleState(state network.ClientState, err error) {
+	if state == network.StateConnected {
+		if err := p.Resync(context.Background()); err != nil {
+			p.log.Error().Err(err).Msg("Failed to resend pending votes")
+		}
+	}
+
+	p.mu.Lock()
+	onState := p.onState
+	p.mu.Unlock()
+
+	if onState != nil {
+		onState(state, err)
+	}
+}
+
+// GetState returns the decision state of a known xT.
+func (p *participant) GetState(xtID *pb.XtID) (DecisionState, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tx, ok := p.txs[xtID.Hex()]
+	if !ok {
+		return StateUndecided, false
+	}
+
+	return tx.decision, true
+}
+
+// Resync resends votes for undecided xTs, e.g. after a reconnect.
+func (p *participant) Resync(ctx context.Context) error {
+	p.mu.Lock()
+	var votes []*pb.Vote
+	for _, tx := range p.txs {
+		if tx.decision == StateUndecided && tx.vote != nil {
+			votes = append(votes, p.newVote(tx.xtID, *tx.vote))
+		}
+	}
+	p.mu.Unlock()
+
+	for _, vote := range votes {
+		if err := p.sendVote(ctx, vote); err != nil {
+			return err
+		}
+	}
+
+	if len(votes) > 0 {
+		p.log.Info().Int("votes", len(votes)).Msg("Resent pending votes")
+	}
+
+	return nil
+}
+
+func (p *participant) handleMessage(ctx context.Context, from string, msg *pb.Message) error {
+	switch payload := msg.Payload.(type) {
+	case *pb.Message_XtRequest:
+		if p.cfg.Keyring != nil {
+			if err := p.cfg.Keyring.Verify(msg); err != nil {
+				return fmt.Errorf("dropping xT request: %w", err)
+			}
+		}
+		return p.handleXTRequest(ctx, payload.XtRequest)
+	case *pb.Message_Decided:
+		p.handleDecided(ctx, payload.Decided)
+		return nil
+	default:
+		p.mu.Lock()
+		fallback := p.fallback
+		p.mu.Unlock()
+
+		if fallback != nil {
+			return fallback(ctx, from, msg)
+		}
+		return nil
+	}
+}
+
+// handleXTRequest validates the transactions of our chain and votes asynchronously,
+// so a slow Validator does not block the receive loop.
+func (p *participant) handleXTRequest(ctx context.Context, req *pb.XTRequest) error {
+	xtID, err := req.XtID()
+	if err != nil {
+		return err
+	}
+
+	var txs []*pb.TransactionRequest
+	for _, tx := range req.Transactions {
+		if bytes.Equal(tx.ChainId, p.cfg.ChainID) {
+			txs = append(txs, tx)
+		}
+	}
+
+	if len(txs) == 0 {
+		return nil // Not a participant
+	}
+
+	key := xtID.Hex()
+
+	p.mu.Lock()
+	p.pruneLocked(time.Now())
+	if _, seen := p.txs[key]; seen {
+		p.mu.Unlock()
+		p.log.Debug().Str("xt_id", key).Msg("Ignoring duplicate xT request")
+		return nil
+	}
+	p.txs[key] = &participantTx{xtID: xtID, txs: txs, receivedAt: time.Now()}
+	p.mu.Unlock()
+
+	go p.vote(context.WithoutCancel(ctx), xtID, txs)
+
+	return nil
+}
+
+// vote runs the validator and sends the vote unless the xT was decided meanwhile.
+func (p *participant) vote(ctx context.Context, xtID *pb.XtID, txs []*pb.TransactionRequest) {
+	key := xtID.Hex()
+
+	validateCtx := ctx
+	if p.cfg.ValidateTimeout > 0 {
+		var cancel context.CancelFunc
+		validateCtx, cancel = context.WithTimeout(ctx, p.cfg.ValidateTimeout)
+		defer cancel()
+	}
+
+	ok, err := p.validate(validateCtx, xtID, txs)
+	if err != nil {
+		p.log.Warn().Err(err).Str("xt_id", key).Msg("Validation failed, voting abort")
+		ok = false
+	}
+
+	p.mu.Lock()
+	tx, exists := p.txs[key]
+	if !exists || tx.decision != StateUndecided {
+		p.mu.Unlock()
+		p.log.Debug().Str("xt_id", key).Msg("xT already decided, dropping late vote")
+		return
+	}
+	tx.vote = &ok
+	p.mu.Unlock()
+
+	if err := p.sendVote(ctx, p.newVote(xtID, ok)); err != nil {
+		// Resync will retry once the connection is back
+		p.log.Error().Err(err).Str("xt_id", key).Msg("Failed to send vote")
+	}
+}
+
+// handleDecided applies a decision once; duplicates are ignored.
+func (p *participant) handleDecided(ctx context.Context, decided *pb.Decided) {
+	key := decided.GetXtId().Hex()
+	decision := StateAbort
+	if decided.Decision {
+		decision = StateCommit
+	}
+
+	p.mu.Lock()
+	p.pruneLocked(time.Now())
+	tx, ok := p.txs[key]
+	if !ok {
+		// Decision for an xT we have not seen (yet): remember it so a late request is not voted on
+		p.txs[key] = &participantTx{xtID: decided.XtId, decision: decision, decidedAt: time.Now()}
+		p.mu.Unlock()
+		return
+	}
+
+	if tx.decision != StateUndecided {
+		p.mu.Unlock()
+		if tx.decision != decision {
+			p.log.Error().
+				Str("xt_id", key).
+				Str("known", tx.decision.String()).
+				Str("received", decision.String()).
+				Msg("Conflicting decision received")
+		} else {
+			p.log.Debug().Str("xt_id", key).Msg("Ignoring duplicate decision")
+		}
+		return
+	}
+
+	tx.decision = decision
+	tx.decidedAt = time.Now()
+	outcome := Outcome{
+		XtID:         tx.xtID,
+		Transactions: tx.txs,
+		Decision:     decided.Decision,
+		Voted:        tx.vote != nil,
+	}
+	p.mu.Unlock()
+
+	p.log.Info().
+		Str("xt_id", key).
+		Str("decision", decision.String()).
+		Bool("voted", outcome.Voted).
+		Msg("xT decided")
+
+	if p.onOutcome != nil {
+		p.onOutcome(ctx, outcome)
+	}
+}
+
+func (p *participant) newVote(xtID *pb.XtID, vote bool) *pb.Vote {
+	return &pb.Vote{
+		SenderChainId: p.cfg.ChainID,
+		XtId:          xtID,
+		Vote:          vote,
+	}
+}
+
+func (p *participant) sendVote(ctx context.Context, vote *pb.Vote) error {
+	msg := &pb.Message{Payload: &pb.Message_Vote{Vote: vote}}
+	if err := p.client.Send(ctx, msg); err != nil {
+		return fmt.Errorf("failed to send vote: %w", err)
+	}
+	return nil
+}
+
+// pruneLocked forgets xTs decided, or received without a decision, longer
+// ago than the retention period. Caller must hold p.mu.
+func (p *participant) pruneLocked(now time.Time) {
+	for key, tx := range p.txs {
+		if tx.decision != StateUndecided {
+			if now.Sub(tx.decidedAt) > p.cfg.Retention {
+				delete(p.txs, key)
+			}
+			continue
+		}
+
+		if now.Sub(tx.receivedAt) > p.cfg.Retention {
+			delete(p.txs, key)
+			p.log.Warn().Str("xt_id", key).Msg("No decision within retention, forgetting xT")
+		}
+	}
+}
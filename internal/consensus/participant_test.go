@@ -0,0 +1,350 @@
+package consensus
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kchojn/poc-shared-publisher/internal/auth"
+	"github.com/kchojn/poc-shared-publisher/internal/network"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// fakeClient is a network.Client that records sent messages.
+type fakeClient struct {
+	mu      sync.Mutex
+	handler network.MessageHandler
+	onState network.StateHandler
+	sent    []*pb.Message
+}
+
+func (c *fakeClient) Connect(context.Context) error    { return nil }
+func (c *fakeClient) Disconnect(context.Context) error { return nil }
+func (c *fakeClient) IsConnected() bool                { return true }
+func (c *fakeClient) GetID() string                    { return "fake" }
+func (c *fakeClient) ServerInfo() network.ServerInfo   { return network.ServerInfo{} }
+func (c *fakeClient) RTT() time.Duration               { return 0 }
+
+func (c *fakeClient) Send(_ context.Context, msg *pb.Message) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.sent = append(c.sent, msg)
+	return nil
+}
+
+func (c *fakeClient) Request(context.Context, *pb.Message) (*pb.Message, error) {
+	return nil, network.ErrRequestUnsupported
+}
+
+func (c *fakeClient) SetHandler(handler network.MessageHandler) {
+	c.handler = handler
+}
+
+func (c *fakeClient) SetErrorHandler(network.ErrorHandler) {}
+func (c *fakeClient) SetStateHandler(handler network.StateHandler) {
+	c.onState = handler
+}
+
+func (c *fakeClient) deliver(t *testing.T, msg *pb.Message) {
+	t.Helper()
+	require.NoError(t, c.handler(context.Background(), "publisher", msg))
+}
+
+func (c *fakeClient) votes() []*pb.Vote {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var votes []*pb.Vote
+	for _, msg := range c.sent {
+		if vote := msg.GetVote(); vote != nil {
+			votes = append(votes, vote)
+		}
+	}
+	return votes
+}
+
+type outcomeRecorder struct {
+	mu       sync.Mutex
+	outcomes []Outcome
+}
+
+func (r *outcomeRecorder) handle(_ context.Context, outcome Outcome) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.outcomes = append(r.outcomes, outcome)
+}
+
+func (r *outcomeRecorder) get() []Outcome {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Outcome(nil), r.outcomes...)
+}
+
+func xtRequestMessage(req *pb.XTRequest) *pb.Message {
+	return &pb.Message{Payload: &pb.Message_XtRequest{XtRequest: req}}
+}
+
+func decidedMessage(xtID *pb.XtID, decision bool) *pb.Message {
+	return &pb.Message{Payload: &pb.Message_Decided{Decided: &pb.Decided{XtId: xtID, Decision: decision}}}
+}
+
+func TestParticipant_VotesAndDecides(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{name: "commit", valid: true},
+		{name: "abort", valid: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			client := &fakeClient{}
+			recorder := &outcomeRecorder{}
+			chainID := []byte{0x01}
+
+			var validated []*pb.TransactionRequest
+			validate := func(_ context.Context, _ *pb.XtID, txs []*pb.TransactionRequest) (bool, error) {
+				validated = txs
+				return tt.valid, nil
+			}
+
+			NewParticipant(ParticipantConfig{ChainID: chainID}, client, validate, recorder.handle, zerolog.Nop())
+
+			req := newTestRequest(chainID, []byte{0x02})
+			xtID, err := req.XtID()
+			require.NoError(t, err)
+
+			client.deliver(t, xtRequestMessage(req))
+
+			require.Eventually(t, func() bool { return len(client.votes()) == 1 }, time.Second, 5*time.Millisecond)
+
+			vote := client.votes()[0]
+			assert.Equal(t, chainID, vote.SenderChainId)
+			assert.Equal(t, xtID.Hex(), vote.XtId.Hex())
+			assert.Equal(t, tt.valid, vote.Vote)
+			require.Len(t, validated, 1)
+			assert.Equal(t, chainID, validated[0].ChainId)
+
+			client.deliver(t, decidedMessage(xtID, tt.valid))
+
+			outcomes := recorder.get()
+			require.Len(t, outcomes, 1)
+			assert.Equal(t, tt.valid, outcomes[0].Decision)
+			assert.True(t, outcomes[0].Voted)
+		})
+	}
+}
+
+func TestParticipant_IgnoresOtherChains(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeClient{}
+	validate := func(context.Context, *pb.XtID, []*pb.TransactionRequest) (bool, error) {
+		t.Error("validator must not be called")
+		return true, nil
+	}
+
+	p := NewParticipant(ParticipantConfig{ChainID: []byte{0x09}}, client, validate, nil, zerolog.Nop())
+
+	req := newTestRequest([]byte{0x01}, []byte{0x02})
+	xtID, err := req.XtID()
+	require.NoError(t, err)
+
+	client.deliver(t, xtRequestMessage(req))
+
+	_, known := p.GetState(xtID)
+	assert.False(t, known)
+	assert.Empty(t, client.votes())
+}
+
+func TestParticipant_DuplicateDecision(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeClient{}
+	recorder := &outcomeRecorder{}
+	chainID := []byte{0x01}
+	validate := func(context.Context, *pb.XtID, []*pb.TransactionRequest) (bool, error) { return true, nil }
+
+	p := NewParticipant(ParticipantConfig{ChainID: chainID}, client, validate, recorder.handle, zerolog.Nop())
+
+	req := newTestRequest(chainID)
+	xtID, err := req.XtID()
+	require.NoError(t, err)
+
+	client.deliver(t, xtRequestMessage(req))
+	require.Eventually(t, func() bool { return len(client.votes()) == 1 }, time.Second, 5*time.Millisecond)
+
+	client.deliver(t, decidedMessage(xtID, true))
+	client.deliver(t, decidedMessage(xtID, true))
+
+	assert.Len(t, recorder.get(), 1)
+
+	state, known := p.GetState(xtID)
+	require.True(t, known)
+	assert.Equal(t, StateCommit, state)
+
+	// A redelivered request for a decided xT is not voted on again
+	client.deliver(t, xtRequestMessage(req))
+	time.Sleep(20 * time.Millisecond)
+	assert.Len(t, client.votes(), 1)
+}
+
+func TestParticipant_LateVoteDropped(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeClient{}
+	recorder := &outcomeRecorder{}
+	chainID := []byte{0x01}
+
+	release := make(chan struct{})
+	done := make(chan struct{})
+	validate := func(context.Context, *pb.XtID, []*pb.TransactionRequest) (bool, error) {
+		<-release
+		return true, nil
+	}
+
+	NewParticipant(ParticipantConfig{ChainID: chainID}, client, validate, func(ctx context.Context, o Outcome) {
+		recorder.handle(ctx, o)
+		close(done)
+	}, zerolog.Nop())
+
+	req := newTestRequest(chainID)
+	xtID, err := req.XtID()
+	require.NoError(t, err)
+
+	client.deliver(t, xtRequestMessage(req))
+
+	// The coordinator times out before validation finishes
+	client.deliver(t, decidedMessage(xtID, false))
+	<-done
+	close(release)
+
+	time.Sleep(20 * time.Millisecond)
+	assert.Empty(t, client.votes())
+
+	outcomes := recorder.get()
+	require.Len(t, outcomes, 1)
+	assert.False(t, outcomes[0].Voted)
+	assert.False(t, outcomes[0].Decision)
+}
+
+func TestParticipant_ResyncResendsPendingVotes(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeClient{}
+	chainID := []byte{0x01}
+	validate := func(context.Context, *pb.XtID, []*pb.TransactionRequest) (bool, error) { return true, nil }
+
+	p := NewParticipant(ParticipantConfig{ChainID: chainID}, client, validate, nil, zerolog.Nop())
+
+	pending := newTestRequest(chainID, []byte{0x02})
+	decided := newTestRequest(chainID, []byte{0x03})
+	decidedID, err := decided.XtID()
+	require.NoError(t, err)
+
+	client.deliver(t, xtRequestMessage(pending))
+	client.deliver(t, xtRequestMessage(decided))
+	require.Eventually(t, func() bool { return len(client.votes()) == 2 }, time.Second, 5*time.Millisecond)
+
+	client.deliver(t, decidedMessage(decidedID, true))
+
+	var states []network.ClientState
+	p.SetStateHandler(func(state network.ClientState, _ error) { states = append(states, state) })
+
+	// Losing the connection resends nothing, getting it back resyncs
+	client.onState(network.StateReconnecting, nil)
+	assert.Len(t, client.votes(), 2)
+	client.onState(network.StateConnected, nil)
+
+	votes := client.votes()
+	require.Len(t, votes, 3)
+
+	pendingID, err := pending.XtID()
+	require.NoError(t, err)
+	assert.Equal(t, pendingID.Hex(), votes[2].XtId.Hex())
+
+	assert.Equal(t, []network.ClientState{network.StateReconnecting, network.StateConnected}, states,
+		"state changes still reach the embedder")
+}
+
+func TestParticipant_ForgetsUndecidedAfterRetention(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeClient{}
+	chainID := []byte{0x01}
+	validate := func(context.Context, *pb.XtID, []*pb.TransactionRequest) (bool, error) { return true, nil }
+
+	p := NewParticipant(ParticipantConfig{ChainID: chainID, Retention: time.Minute}, client, validate, nil, zerolog.Nop())
+
+	req := newTestRequest(chainID, []byte{0x02})
+	xtID, err := req.XtID()
+	require.NoError(t, err)
+
+	client.deliver(t, xtRequestMessage(req))
+	require.Eventually(t, func() bool { return len(client.votes()) == 1 }, time.Second, 5*time.Millisecond)
+
+	part := p.(*participant)
+	part.mu.Lock()
+	part.pruneLocked(time.Now().Add(30 * time.Second))
+	part.mu.Unlock()
+	_, ok := p.GetState(xtID)
+	assert.True(t, ok, "kept while within retention")
+
+	part.mu.Lock()
+	part.pruneLocked(time.Now().Add(2 * time.Minute))
+	part.mu.Unlock()
+	_, ok = p.GetState(xtID)
+	assert.False(t, ok, "never decided, forgotten after retention")
+}
+
+func TestParticipant_FallbackHandler(t *testing.T) {
+	t.Parallel()
+
+	client := &fakeClient{}
+	p := NewParticipant(ParticipantConfig{ChainID: []byte{0x01}}, client, nil, nil, zerolog.Nop())
+
+	var received *pb.Message
+	p.SetFallbackHandler(func(_ context.Context, _ string, msg *pb.Message) error {
+		received = msg
+		return nil
+	})
+
+	msg := &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{}}}
+	client.deliver(t, msg)
+	assert.Same(t, msg, received)
+}
+
+func TestParticipant_DropsUnverifiedRequests(t *testing.T) {
+	t.Parallel()
+
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	keyring, err := auth.NewKeyring(map[string][]string{"0x01": {hex.EncodeToString(key.Public().(ed25519.PublicKey))}})
+	require.NoError(t, err)
+
+	client := &fakeClient{}
+	validate := func(context.Context, *pb.XtID, []*pb.TransactionRequest) (bool, error) { return true, nil }
+	NewParticipant(ParticipantConfig{ChainID: chainB, Keyring: keyring}, client, validate, nil, zerolog.Nop())
+
+	unsigned := xtRequestMessage(newTestRequest(chainA, chainB))
+	assert.ErrorIs(t, client.handler(context.Background(), "publisher", unsigned), auth.ErrUnsigned)
+
+	signed := xtRequestMessage(newTestRequest(chainA, chainB, []byte{0x03}))
+	require.NoError(t, auth.NewSigner(chainA, key).Sign(signed))
+	client.deliver(t, signed)
+
+	require.Eventually(t, func() bool { return len(client.votes()) == 1 }, time.Second, 5*time.Millisecond)
+}
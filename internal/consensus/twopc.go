@@ -1 +1,308 @@
 package consensus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/pkg/metrics"
+)
+
+// coordinator implements the Coordinator interface.
+type coordinator struct {
+	cfg Config
+	log zerolog.Logger
+
+	mu           sync.RWMutex
+	transactions map[string]*TwoPCState // keyed by xT ID hex
+	callback     DecisionCallback
+}
+
+// NewCoordinator creates a new 2PC coordinator.
+func NewCoordinator(cfg Config, log zerolog.Logger) Coordinator {
+	return &coordinator{
+		cfg:          cfg,
+		log:          log.With().Str("component", "coordinator").Logger(),
+		transactions: make(map[string]*TwoPCState),
+	}
+}
+
+// SetDecisionCallback sets the callback invoked on decisions.
+func (c *coordinator) SetDecisionCallback(cb DecisionCallback) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.callback = cb
+}
+
+// StartTransaction registers a new xT and returns its ID.
+func (c *coordinator) StartTransaction(_ context.Context, from string, req *pb.XTRequest) (*pb.XtID, error) {
+	if len(req.GetTransactions()) == 0 {
+		return nil, ErrEmptyTransaction
+	}
+
+	xtID, err := req.XtID()
+	if err != nil {
+		return nil, err
+	}
+
+	participants := make(map[string]struct{})
+	for _, tx := range req.Transactions {
+		participants[pb.FormatChainID(tx.ChainId)] = struct{}{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := xtID.Hex()
+	if _, exists := c.transactions[key]; exists {
+		return nil, fmt.Errorf("%w: %s", ErrDuplicateTransaction, key)
+	}
+
+	state := &TwoPCState{
+		XtID:         xtID,
+		Request:      req,
+		From:         from,
+		Participants: participants,
+		Votes:        make(map[string]bool, len(participants)),
+		Decision:     StateUndecided,
+		StartTime:    time.Now(),
+	}
+
+	if c.cfg.Timeout > 0 {
+		state.Deadline = state.StartTime.Add(c.cfg.Timeout)
+		state.timer = time.AfterFunc(c.cfg.Timeout, func() {
+			c.handleTimeout(key)
+		})
+	}
+
+	c.transactions[key] = state
+
+	metrics.TwoPCActiveTransactions.Inc()
+
+	c.log.Info().
+		Str("xt_id", key).
+		Str("from", from).
+		Int("participants", len(participants)).
+		Dur("timeout", c.cfg.Timeout).
+		Msg("Started 2PC transaction")
+
+	return xtID, nil
+}
+
+// RecordVote records a participant vote and returns the resulting state.
+// A single abort vote aborts the transaction; it commits once all participants voted commit.
+func (c *coordinator) RecordVote(ctx context.Context, vote *pb.Vote) (DecisionState, error) {
+	key := vote.GetXtId().Hex()
+	chainID := pb.FormatChainID(vote.GetSenderChainId())
+
+	c.mu.Lock()
+
+	state, ok := c.transactions[key]
+	if !ok {
+		c.mu.Unlock()
+		return StateUndecided, fmt.Errorf("%w: %s", ErrUnknownTransaction, key)
+	}
+
+	if _, ok := state.Participants[chainID]; !ok {
+		c.mu.Unlock()
+		return state.Decision, fmt.Errorf("%w: %s in %s", ErrNotParticipant, chainID, key)
+	}
+
+	if _, voted := state.Votes[chainID]; voted {
+		c.mu.Unlock()
+		return state.Decision, fmt.Errorf("%w: %s in %s", ErrDuplicateVote, chainID, key)
+	}
+
+	state.Votes[chainID] = vote.Vote
+	metrics.TwoPCVotesTotal.WithLabelValues(voteLabel(vote.Vote)).Inc()
+
+	c.log.Debug().
+		Str("xt_id", key).
+		Str("chain_id", chainID).
+		Bool("vote", vote.Vote).
+		Int("votes", len(state.Votes)).
+		Int("participants", len(state.Participants)).
+		Msg("Recorded vote")
+
+	switch {
+	case !vote.Vote:
+		state.Decision = StateAbort
+	case len(state.Votes) == len(state.Participants):
+		state.Decision = StateCommit
+	default:
+		c.mu.Unlock()
+		return StateUndecided, nil
+	}
+
+	decision := state.Decision
+	cb := c.finalizeLocked(key, state)
+	c.mu.Unlock()
+
+	if err := notify(ctx, cb, state.XtID, decision); err != nil {
+		return decision, err
+	}
+
+	return decision, nil
+}
+
+// AbortParticipant aborts every undecided transaction the chain participates
+// in and has not voted on yet. Transactions it already voted on can still be
+// decided without it.
+func (c *coordinator) AbortParticipant(ctx context.Context, chainID string) []*pb.XtID {
+	type aborted struct {
+		xtID *pb.XtID
+		cb   DecisionCallback
+	}
+
+	var decided []aborted
+
+	c.mu.Lock()
+	for key, state := range c.transactions {
+		if _, ok := state.Participants[chainID]; !ok {
+			continue
+		}
+		if _, voted := state.Votes[chainID]; voted {
+			continue
+		}
+
+		state.Decision = StateAbort
+		cb := c.finalizeLocked(key, state)
+		decided = append(decided, aborted{xtID: state.XtID, cb: cb})
+
+		metrics.TwoPCForcedAbortsTotal.WithLabelValues("disconnect").Inc()
+
+		c.log.Warn().
+			Str("xt_id", key).
+			Str("chain_id", chainID).
+			Msg("Aborting transaction, participant disconnected")
+	}
+	c.mu.Unlock()
+
+	ids := make([]*pb.XtID, 0, len(decided))
+	for _, d := range decided {
+		ids = append(ids, d.xtID)
+		if err := notify(ctx, d.cb, d.xtID, StateAbort); err != nil {
+			c.log.Error().Err(err).Str("xt_id", d.xtID.Hex()).Msg("Failed to notify abort")
+		}
+	}
+
+	return ids
+}
+
+// handleTimeout aborts a transaction whose vote deadline has passed.
+func (c *coordinator) handleTimeout(key string) {
+	c.mu.Lock()
+	state, ok := c.transactions[key]
+	if !ok {
+		c.mu.Unlock()
+		return
+	}
+
+	state.Decision = StateAbort
+	cb := c.finalizeLocked(key, state)
+	c.mu.Unlock()
+
+	metrics.TwoPCTimeoutsTotal.Inc()
+	metrics.TwoPCForcedAbortsTotal.WithLabelValues("timeout").Inc()
+
+	c.log.Warn().
+		Str("xt_id", key).
+		Int("votes", len(state.Votes)).
+		Int("participants", len(state.Participants)).
+		Msg("Vote deadline passed, aborting transaction")
+
+	if err := notify(context.Background(), cb, state.XtID, StateAbort); err != nil {
+		c.log.Error().Err(err).Str("xt_id", key).Msg("Failed to notify abort")
+	}
+}
+
+// GetTransactionState returns the state of an active transaction.
+func (c *coordinator) GetTransactionState(xtID *pb.XtID) (DecisionState, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	state, ok := c.transactions[xtID.Hex()]
+	if !ok {
+		return StateUndecided, fmt.Errorf("%w: %s", ErrUnknownTransaction, xtID.Hex())
+	}
+
+	return state.Decision, nil
+}
+
+// GetActiveTransactions returns the IDs of all undecided transactions.
+func (c *coordinator) GetActiveTransactions() []*pb.XtID {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ids := make([]*pb.XtID, 0, len(c.transactions))
+	for _, state := range c.transactions {
+		ids = append(ids, state.XtID)
+	}
+
+	return ids
+}
+
+// Stop stops the vote deadlines of all undecided transactions and forgets
+// them. No decision is made: the coordinator that takes over decides them.
+func (c *coordinator) Stop() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, state := range c.transactions {
+		if state.timer != nil {
+			state.timer.Stop()
+		}
+		delete(c.transactions, key)
+		metrics.TwoPCActiveTransactions.Dec()
+	}
+}
+
+// finalizeLocked removes a decided transaction, records metrics and
+// returns the callback to notify once the lock is released.
+// Caller must hold c.mu.
+func (c *coordinator) finalizeLocked(key string, state *TwoPCState) DecisionCallback {
+	delete(c.transactions, key)
+
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+
+	duration := time.Since(state.StartTime)
+
+	metrics.TwoPCActiveTransactions.Dec()
+	metrics.TwoPCDecisionsTotal.WithLabelValues(state.Decision.String()).Inc()
+	metrics.TwoPCDuration.Observe(duration.Seconds())
+
+	c.log.Info().
+		Str("xt_id", key).
+		Str("decision", state.Decision.String()).
+		Int("votes", len(state.Votes)).
+		Dur("duration", duration).
+		Msg("2PC transaction decided")
+
+	return c.callback
+}
+
+// notify invokes the decision callback, if any.
+func notify(ctx context.Context, cb DecisionCallback, xtID *pb.XtID, decision DecisionState) error {
+	if cb == nil {
+		return nil
+	}
+
+	if err := cb(ctx, xtID, decision == StateCommit); err != nil {
+		return fmt.Errorf("decision callback failed: %w", err)
+	}
+
+	return nil
+}
+
+func voteLabel(vote bool) string {
+	if vote {
+		return "commit"
+	}
+	return "abort"
+}
@@ -1 +1,288 @@
 package consensus
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+type decisionRecorder struct {
+	mu        sync.Mutex
+	decisions map[string]bool
+}
+
+func newDecisionRecorder() *decisionRecorder {
+	return &decisionRecorder{decisions: make(map[string]bool)}
+}
+
+func (r *decisionRecorder) callback(_ context.Context, xtID *pb.XtID, decision bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.decisions[xtID.Hex()] = decision
+	return nil
+}
+
+func (r *decisionRecorder) get(xtID *pb.XtID) (bool, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	decision, ok := r.decisions[xtID.Hex()]
+	return decision, ok
+}
+
+func newTestRequest(chainIDs ...[]byte) *pb.XTRequest {
+	req := &pb.XTRequest{}
+	for _, chainID := range chainIDs {
+		req.Transactions = append(req.Transactions, &pb.TransactionRequest{
+			ChainId:     chainID,
+			Transaction: [][]byte{append([]byte("tx-"), chainID...)},
+		})
+	}
+	return req
+}
+
+func newVote(chainID []byte, xtID *pb.XtID, vote bool) *pb.Vote {
+	return &pb.Vote{SenderChainId: chainID, XtId: xtID, Vote: vote}
+}
+
+func TestCoordinator_Decisions(t *testing.T) {
+	t.Parallel()
+
+	chainA := []byte{0x01}
+	chainB := []byte{0x02}
+
+	tests := []struct {
+		name     string
+		votes    []bool
+		expected DecisionState
+	}{
+		{
+			name:     "all commit",
+			votes:    []bool{true, true},
+			expected: StateCommit,
+		},
+		{
+			name:     "first abort",
+			votes:    []bool{false},
+			expected: StateAbort,
+		},
+		{
+			name:     "second abort",
+			votes:    []bool{true, false},
+			expected: StateAbort,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx := context.Background()
+			recorder := newDecisionRecorder()
+			coord := NewCoordinator(Config{}, zerolog.Nop())
+			coord.SetDecisionCallback(recorder.callback)
+
+			xtID, err := coord.StartTransaction(ctx, "conn-1", newTestRequest(chainA, chainB))
+			require.NoError(t, err)
+
+			chains := [][]byte{chainA, chainB}
+			var state DecisionState
+			for i, vote := range tt.votes {
+				state, err = coord.RecordVote(ctx, newVote(chains[i], xtID, vote))
+				require.NoError(t, err)
+			}
+
+			assert.Equal(t, tt.expected, state)
+
+			decision, ok := recorder.get(xtID)
+			require.True(t, ok, "decision callback not invoked")
+			assert.Equal(t, tt.expected == StateCommit, decision)
+			assert.Empty(t, coord.GetActiveTransactions())
+		})
+	}
+}
+
+func TestCoordinator_WaitsForAllParticipants(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	recorder := newDecisionRecorder()
+	coord := NewCoordinator(Config{}, zerolog.Nop())
+	coord.SetDecisionCallback(recorder.callback)
+
+	xtID, err := coord.StartTransaction(ctx, "conn-1", newTestRequest([]byte{0x01}, []byte{0x02}, []byte{0x03}))
+	require.NoError(t, err)
+
+	state, err := coord.RecordVote(ctx, newVote([]byte{0x01}, xtID, true))
+	require.NoError(t, err)
+	assert.Equal(t, StateUndecided, state)
+
+	state, err = coord.GetTransactionState(xtID)
+	require.NoError(t, err)
+	assert.Equal(t, StateUndecided, state)
+	assert.Len(t, coord.GetActiveTransactions(), 1)
+
+	_, ok := recorder.get(xtID)
+	assert.False(t, ok)
+}
+
+func TestCoordinator_Errors(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	coord := NewCoordinator(Config{}, zerolog.Nop())
+
+	_, err := coord.StartTransaction(ctx, "conn-1", &pb.XTRequest{})
+	require.ErrorIs(t, err, ErrEmptyTransaction)
+
+	req := newTestRequest([]byte{0x01}, []byte{0x02})
+	xtID, err := coord.StartTransaction(ctx, "conn-1", req)
+	require.NoError(t, err)
+
+	_, err = coord.StartTransaction(ctx, "conn-2", req)
+	require.ErrorIs(t, err, ErrDuplicateTransaction)
+
+	_, err = coord.RecordVote(ctx, newVote([]byte{0x03}, xtID, true))
+	require.ErrorIs(t, err, ErrNotParticipant)
+
+	_, err = coord.RecordVote(ctx, newVote([]byte{0x01}, xtID, true))
+	require.NoError(t, err)
+
+	_, err = coord.RecordVote(ctx, newVote([]byte{0x01}, xtID, true))
+	require.ErrorIs(t, err, ErrDuplicateVote)
+
+	_, err = coord.RecordVote(ctx, newVote([]byte{0x01}, &pb.XtID{Hash: []byte{0xff}}, true))
+	require.ErrorIs(t, err, ErrUnknownTransaction)
+}
+
+func TestXtID_Deterministic(t *testing.T) {
+	t.Parallel()
+
+	first, err := newTestRequest([]byte{0x01}, []byte{0x02}).XtID()
+	require.NoError(t, err)
+
+	second, err := newTestRequest([]byte{0x01}, []byte{0x02}).XtID()
+	require.NoError(t, err)
+
+	other, err := newTestRequest([]byte{0x02}, []byte{0x01}).XtID()
+	require.NoError(t, err)
+
+	assert.Equal(t, first.Hex(), second.Hex())
+	assert.NotEqual(t, first.Hex(), other.Hex())
+	assert.Len(t, first.Hash, 32)
+}
+
+func TestCoordinator_TimeoutAborts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	recorder := newDecisionRecorder()
+	coord := NewCoordinator(Config{Timeout: 50 * time.Millisecond}, zerolog.Nop())
+	coord.SetDecisionCallback(recorder.callback)
+
+	xtID, err := coord.StartTransaction(ctx, "conn-1", newTestRequest([]byte{0x01}, []byte{0x02}))
+	require.NoError(t, err)
+
+	_, err = coord.RecordVote(ctx, newVote([]byte{0x01}, xtID, true))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		_, ok := recorder.get(xtID)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	decision, _ := recorder.get(xtID)
+	assert.False(t, decision)
+	assert.Empty(t, coord.GetActiveTransactions())
+
+	// Late vote after the deadline
+	_, err = coord.RecordVote(ctx, newVote([]byte{0x02}, xtID, true))
+	require.ErrorIs(t, err, ErrUnknownTransaction)
+}
+
+func TestCoordinator_DecisionStopsTimer(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var calls atomic.Int32
+	coord := NewCoordinator(Config{Timeout: 50 * time.Millisecond}, zerolog.Nop())
+	coord.SetDecisionCallback(func(context.Context, *pb.XtID, bool) error {
+		calls.Add(1)
+		return nil
+	})
+
+	xtID, err := coord.StartTransaction(ctx, "conn-1", newTestRequest([]byte{0x01}))
+	require.NoError(t, err)
+
+	state, err := coord.RecordVote(ctx, newVote([]byte{0x01}, xtID, true))
+	require.NoError(t, err)
+	assert.Equal(t, StateCommit, state)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, int32(1), calls.Load())
+}
+
+func TestCoordinator_StopStopsTimers(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	var calls atomic.Int32
+	coord := NewCoordinator(Config{Timeout: 50 * time.Millisecond}, zerolog.Nop())
+	coord.SetDecisionCallback(func(context.Context, *pb.XtID, bool) error {
+		calls.Add(1)
+		return nil
+	})
+
+	xtID, err := coord.StartTransaction(ctx, "conn-1", newTestRequest([]byte{0x01}, []byte{0x02}))
+	require.NoError(t, err)
+
+	coord.Stop()
+	assert.Empty(t, coord.GetActiveTransactions())
+
+	_, err = coord.GetTransactionState(xtID)
+	require.ErrorIs(t, err, ErrUnknownTransaction)
+
+	time.Sleep(100 * time.Millisecond)
+	assert.Zero(t, calls.Load(), "no timeout abort after Stop")
+}
+
+func TestCoordinator_AbortParticipant(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	recorder := newDecisionRecorder()
+	coord := NewCoordinator(Config{}, zerolog.Nop())
+	coord.SetDecisionCallback(recorder.callback)
+
+	involved, err := coord.StartTransaction(ctx, "conn-1", newTestRequest([]byte{0x01}, []byte{0x02}))
+	require.NoError(t, err)
+
+	unrelated, err := coord.StartTransaction(ctx, "conn-1", newTestRequest([]byte{0x01}, []byte{0x03}))
+	require.NoError(t, err)
+
+	voted, err := coord.StartTransaction(ctx, "conn-1", newTestRequest([]byte{0x02}, []byte{0x03}))
+	require.NoError(t, err)
+	_, err = coord.RecordVote(ctx, &pb.Vote{SenderChainId: []byte{0x02}, XtId: voted, Vote: true})
+	require.NoError(t, err)
+
+	aborted := coord.AbortParticipant(ctx, pb.FormatChainID([]byte{0x02}))
+	require.Len(t, aborted, 1)
+	assert.Equal(t, involved.Hex(), aborted[0].Hex())
+
+	decision, ok := recorder.get(involved)
+	require.True(t, ok)
+	assert.False(t, decision)
+
+	for _, xtID := range []*pb.XtID{unrelated, voted} {
+		state, err := coord.GetTransactionState(xtID)
+		require.NoError(t, err)
+		assert.Equal(t, StateUndecided, state)
+	}
+}
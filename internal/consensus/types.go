@@ -1 +1,90 @@
 package consensus
+
+import (
+	"context"
+	"time"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/internal/types"
+)
+
+var (
+	// ErrDuplicateTransaction is returned when an xT with the same ID is already in progress.
+	ErrDuplicateTransaction = types.NewError(types.ErrCodeDuplicateXT, "transaction already in progress")
+
+	// ErrUnknownTransaction is returned for votes on transactions the coordinator does not track.
+	ErrUnknownTransaction = types.NewError(types.ErrCodeUnknownXT, "unknown transaction")
+
+	// ErrNotParticipant is returned when a vote comes from a chain not involved in the transaction.
+	ErrNotParticipant = types.NewError(types.ErrCodeNotParticipant, "chain is not a participant")
+
+	// ErrDuplicateVote is returned when a chain votes more than once.
+	ErrDuplicateVote = types.NewError(types.ErrCodeDuplicateVote, "duplicate vote")
+
+	// ErrEmptyTransaction is returned for requests without any transactions.
+	ErrEmptyTransaction = types.NewError(types.ErrCodeInvalidRequest, "transaction request has no transactions")
+)
+
+// DecisionState represents the outcome of a two-phase commit.
+type DecisionState int
+
+const (
+	StateUndecided DecisionState = iota
+	StateCommit
+	StateAbort
+)
+
+// String returns the state name.
+func (s DecisionState) String() string {
+	switch s {
+	case StateUndecided:
+		return "undecided"
+	case StateCommit:
+		return "commit"
+	case StateAbort:
+		return "abort"
+	default:
+		return "unknown"
+	}
+}
+
+// TwoPCState tracks a single cross-chain transaction on the coordinator.
+type TwoPCState struct {
+	XtID         *pb.XtID
+	Request      *pb.XTRequest
+	From         string              // Connection that submitted the request
+	Participants map[string]struct{} // Chain IDs that must vote
+	Votes        map[string]bool     // Votes received so far, keyed by chain ID
+	Decision     DecisionState
+	StartTime    time.Time
+	Deadline     time.Time // Zero if the coordinator has no vote timeout
+
+	timer *time.Timer
+}
+
+// Config contains coordinator configuration.
+type Config struct {
+	// Timeout is the vote deadline per transaction. Zero disables it.
+	Timeout time.Duration
+}
+
+// DecisionCallback is invoked exactly once when a transaction is decided.
+type DecisionCallback func(ctx context.Context, xtID *pb.XtID, decision bool) error
+
+// Coordinator drives the two-phase commit of cross-chain transactions.
+type Coordinator interface {
+	// StartTransaction registers a new xT and returns its ID
+	StartTransaction(ctx context.Context, from string, req *pb.XTRequest) (*pb.XtID, error)
+	// RecordVote records a participant vote and returns the resulting state
+	RecordVote(ctx context.Context, vote *pb.Vote) (DecisionState, error)
+	// GetTransactionState returns the state of an active transaction
+	GetTransactionState(xtID *pb.XtID) (DecisionState, error)
+	// AbortParticipant aborts every undecided transaction the chain participates in and has not voted on
+	AbortParticipant(ctx context.Context, chainID string) []*pb.XtID
+	// GetActiveTransactions returns the IDs of all undecided transactions
+	GetActiveTransactions() []*pb.XtID
+	// SetDecisionCallback sets the callback invoked on decisions
+	SetDecisionCallback(cb DecisionCallback)
+	// Stop stops all vote deadlines and forgets undecided transactions without deciding them
+	Stop()
+}
@@ -0,0 +1,114 @@
+package network
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// Message fields carrying the position in a connection's stream
+var (
+	sequenceField = messageField("sequence")
+	epochField    = messageField("epoch")
+)
+
+// maxStampSize bounds the bytes stamp adds to a payload: two one-byte tags and two varints.
+const maxStampSize = 2 * (1 + binary.MaxVarintLen64)
+
+func messageField(name protoreflect.Name) protowire.Number {
+	return (&pb.Message{}).ProtoReflect().Descriptor().Fields().ByName(name).Number()
+}
+
+// stamp encodes the sequence and epoch fields of a Message. Appended to a
+// marshalled Message without them, it places the message in a stream.
+func stamp(epoch, sequence uint64) []byte {
+	b := make([]byte, 0, maxStampSize)
+	b = protowire.AppendTag(b, sequenceField, protowire.VarintType)
+	b = protowire.AppendVarint(b, sequence)
+	b = protowire.AppendTag(b, epochField, protowire.VarintType)
+	return protowire.AppendVarint(b, epoch)
+}
+
+// frameVariant identifies how a connection frames its messages.
+type frameVariant struct {
+	legacy     bool
+	compressed bool
+}
+
+// sharedFrames marshals a message once and frames its body once per variant
+// in use, so all connections with the same framing share the same bytes. Each
+// connection only adds a header and the stamp with its stream position. The
+// bodies are queued to several connections and must not be modified.
+type sharedFrames struct {
+	payload []byte
+	bodies  map[frameVariant]*frameBody
+}
+
+// newSharedFrames marshals msg, whose epoch and sequence must be zero.
+func newSharedFrames(codec *Codec, msg proto.Message) (*sharedFrames, error) {
+	payload, err := codec.marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The stamp must fit, too
+	if len(payload)+maxStampSize > codec.maxMessageSize {
+		return nil, fmt.Errorf("%w: message size %d with stream position exceeds max %d",
+			ErrMessageTooLarge, len(payload), codec.maxMessageSize)
+	}
+
+	return &sharedFrames{payload: payload, bodies: make(map[frameVariant]*frameBody, 1)}, nil
+}
+
+// bodyFor returns the shared part of the frames the writer sends.
+func (f *sharedFrames) bodyFor(sw *StreamWriter) *frameBody {
+	variant := frameVariant{legacy: sw.codec.legacy, compressed: sw.compress.Load()}
+
+	body, ok := f.bodies[variant]
+	if !ok {
+		body = &frameBody{codec: sw.codec, data: f.payload}
+		if variant.compressed {
+			// Left open, so each connection's stamp ends the DEFLATE stream
+			if deflated, ok := compressOpen(f.payload); ok {
+				body.data, body.compressed = deflated, true
+			}
+		}
+		if !variant.legacy {
+			body.crc = crc32.Checksum(body.data, crc32c)
+		}
+		f.bodies[variant] = body
+	}
+	return body
+}
+
+// frameBody is the shared part of a frame: the payload, or an open DEFLATE
+// stream of it.
+type frameBody struct {
+	codec      *Codec
+	data       []byte
+	crc        uint32 // CRC32C of data, zero for legacy frames
+	compressed bool
+}
+
+// frame returns the parts of the frame carrying the message at position
+// sequence of epoch.
+func (b *frameBody) frame(epoch, sequence uint64) [][]byte {
+	tail := stamp(epoch, sequence)
+	if b.compressed {
+		tail = storedBlock(tail)
+	}
+
+	var crc uint32
+	if !b.codec.legacy {
+		crc = crc32.Update(b.crc, crc32c, tail)
+	}
+
+	header := b.codec.appendHeader(make([]byte, 0, b.codec.headerSize()), len(b.data)+len(tail), crc, b.compressed)
+	return [][]byte{header, b.data, tail}
+}
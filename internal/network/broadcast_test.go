@@ -0,0 +1,117 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+func TestSharedFrames(t *testing.T) {
+	t.Parallel()
+
+	msg := newTestBatch(100)
+
+	newWriter := func(legacy, compressed bool) *StreamWriter {
+		codec := NewCodec(1024 * 1024)
+		if legacy {
+			codec = NewLegacyCodec(1024 * 1024)
+		}
+		sw := NewStreamWriter(io.Discard, codec)
+		if compressed {
+			sw.EnableCompression()
+		}
+		return sw
+	}
+
+	frames, err := newSharedFrames(NewCodec(1024*1024), msg)
+	require.NoError(t, err)
+
+	for _, legacy := range []bool{false, true} {
+		for _, compressed := range []bool{false, true} {
+			a, b := newWriter(legacy, compressed), newWriter(legacy, compressed)
+
+			first := frames.bodyFor(a).frame(7, 1)
+			second := frames.bodyFor(b).frame(7, 2)
+			assert.Same(t, &first[1][0], &second[1][0], "writers with the same framing share the body")
+
+			for sequence, parts := range map[uint64][][]byte{1: first, 2: second} {
+				var decoded pb.Message
+				require.NoError(t, a.codec.Decode(bytes.NewReader(bytes.Join(parts, nil)), &decoded),
+					"legacy=%v compressed=%v", legacy, compressed)
+				assert.Equal(t, uint64(7), decoded.Epoch)
+				assert.Equal(t, sequence, decoded.Sequence)
+
+				decoded.Epoch, decoded.Sequence = 0, 0
+				assert.True(t, proto.Equal(msg, &decoded))
+			}
+
+			if compressed {
+				assert.Less(t, len(first[1]), proto.Size(msg), "the body is compressed")
+			}
+		}
+	}
+
+	assert.Len(t, frames.bodies, 4)
+}
+
+func TestSharedFrames_RejectsLargeMessages(t *testing.T) {
+	t.Parallel()
+
+	_, err := newSharedFrames(NewCodec(1024), newTestBatch(100))
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+}
+
+// BenchmarkBroadcastFanout frames one xT batch for many connections, once per
+// connection and once with the body shared by all. Half the connections compress.
+func BenchmarkBroadcastFanout(b *testing.B) {
+	codec := NewCodec(100 * 1024 * 1024)
+
+	for _, txs := range []int{100, 10000} {
+		msg := newTestBatch(txs)
+
+		for _, conns := range []int{10, 50} {
+			writers := make([]*StreamWriter, conns)
+			for i := range writers {
+				writers[i] = NewStreamWriter(io.Discard, codec)
+				if i%2 == 1 {
+					writers[i].EnableCompression()
+				}
+			}
+
+			b.Run(fmt.Sprintf("txs=%d/conns=%d/per_conn", txs, conns), func(b *testing.B) {
+				b.SetBytes(int64(proto.Size(msg)))
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					for _, sw := range writers {
+						if _, err := sw.encode(msg); err != nil {
+							b.Fatal(err)
+						}
+					}
+				}
+			})
+
+			b.Run(fmt.Sprintf("txs=%d/conns=%d/shared", txs, conns), func(b *testing.B) {
+				b.SetBytes(int64(proto.Size(msg)))
+				b.ReportAllocs()
+
+				for i := 0; i < b.N; i++ {
+					frames, err := newSharedFrames(codec, msg)
+					if err != nil {
+						b.Fatal(err)
+					}
+					for j, sw := range writers {
+						frames.bodyFor(sw).frame(1, uint64(j+1))
+					}
+				}
+			})
+		}
+	}
+}
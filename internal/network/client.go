@@ -2,6 +2,8 @@ package network
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -12,17 +14,55 @@ import (
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 
+	"github.com/kchojn/poc-shared-publisher/internal/auth"
 	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
 )
 
 // ClientConfig contains client configuration.
 type ClientConfig struct {
-	ServerAddr     string
+	// ServerAddr is the address of the server. Its scheme selects the
+	// transport: tcp:// (the default without a scheme), unix:// or mem://.
+	ServerAddr string
+	// Transport dials instead of the transport of the ServerAddr scheme
+	Transport      Transport
 	ConnectTimeout time.Duration
 	ReadTimeout    time.Duration
 	WriteTimeout   time.Duration
-	ReconnectDelay time.Duration
 	MaxMessageSize int
+	// LegacyFraming frames messages with a bare length prefix, for servers
+	// that predate the frame header.
+	LegacyFraming bool
+	// RequestTimeout bounds Request calls whose context has no deadline.
+	// Zero uses DefaultRequestTimeout.
+	RequestTimeout time.Duration
+
+	// HeartbeatInterval is the time between Pings to the server. The connection
+	// is closed after MaxMissedHeartbeats unanswered Pings. Zero disables
+	// heartbeats; servers before protocol version 3 are never pinged.
+	HeartbeatInterval   time.Duration
+	MaxMissedHeartbeats int
+
+	// TLS connects over TLS when set. An empty ServerName is taken from the
+	// host of a TCP ServerAddr. Set Certificates to authenticate with mutual TLS.
+	TLS *tls.Config
+
+	// AutoReconnect re-establishes a lost connection until Disconnect,
+	// waiting ReconnectDelay, doubling up to MaxReconnectDelay, before each
+	// attempt. While reconnecting, up to SendQueueSize Sends are queued and
+	// written in order once the handshake completed again. Zero values use
+	// DefaultReconnectDelay, DefaultMaxReconnectDelay and DefaultSendQueueSize.
+	AutoReconnect     bool
+	ReconnectDelay    time.Duration
+	MaxReconnectDelay time.Duration
+	SendQueueSize     int
+
+	// Signer signs every message sent, including the Hello. Nil sends messages unsigned.
+	Signer *auth.Signer
+
+	// Announced in the Hello that opens every connection
+	ChainID      []byte
+	Name         string
+	Capabilities []string
 }
 
 // client implements the Client interface.
@@ -30,86 +70,210 @@ type client struct {
 	cfg     ClientConfig
 	id      string
 	handler MessageHandler
+	onError ErrorHandler
+	onState StateHandler
 	codec   *Codec
 	log     zerolog.Logger
 
-	conn      net.Conn
-	writer    *StreamWriter
-	connected atomic.Bool
-	mu        sync.RWMutex
+	// Stream position of the current connection; the epoch is kept across reconnects
+	sequence sequenceTracker
+
+	// Requests waiting for their reply
+	requests pendingRequests
+
+	conn       net.Conn
+	writer     *StreamWriter
+	serverInfo ServerInfo
+	heartbeat  *heartbeat
+	connected  atomic.Bool
+	mu         sync.RWMutex
+
+	// Between Connect and Disconnect, including while reconnecting
+	started   atomic.Bool
+	state     atomic.Int32 // ClientState
+	connectMu sync.Mutex   // Serializes Connect and Disconnect
+
+	// Sends waiting for a reconnect
+	queue   []*pb.Message
+	queueMu sync.Mutex
 
 	// Shutdown management
 	cancel context.CancelFunc
 	wg     sync.WaitGroup
 }
 
-// NewClient creates a new client instance.
-func NewClient(cfg ClientConfig, log zerolog.Logger) Client {
+// NewClient creates a new client instance. Options override cfg.
+func NewClient(cfg ClientConfig, log zerolog.Logger, opts ...ClientOption) Client {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	codec := NewCodec(cfg.MaxMessageSize)
+	if cfg.LegacyFraming {
+		codec = NewLegacyCodec(cfg.MaxMessageSize)
+	}
+
 	return &client{
 		cfg:   cfg,
 		id:    uuid.New().String(),
-		codec: NewCodec(cfg.MaxMessageSize),
+		codec: codec,
 		log:   log.With().Str("component", "client").Logger(),
 	}
 }
 
 // Connect establishes connection to the server.
 func (c *client) Connect(ctx context.Context) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.connectMu.Lock()
+	defer c.connectMu.Unlock()
 
-	if c.connected.Load() {
+	if c.started.Load() {
 		return ErrAlreadyConnected
 	}
 
-	connCtx, cancel := context.WithTimeout(ctx, c.cfg.ConnectTimeout)
-	defer cancel()
-
-	dialer := &net.Dialer{
-		Timeout:   c.cfg.ConnectTimeout,
-		KeepAlive: 30 * time.Second,
+	conn, writer, welcome, err := c.dial(ctx)
+	if err != nil {
+		return err
 	}
 
-	conn, err := dialer.DialContext(connCtx, "tcp", c.cfg.ServerAddr)
-	if err != nil {
-		return fmt.Errorf("failed to connect: %w", err)
+	c.mu.Lock()
+	if c.cancel != nil {
+		c.cancel() // Left over from a connection that was lost without AutoReconnect
 	}
+	ctx, c.cancel = context.WithCancel(context.Background())
+	done := c.attach(ctx, conn, writer, welcome)
+	c.mu.Unlock()
 
-	c.conn = conn
-	c.writer = NewStreamWriter(conn, c.codec)
 	c.connected.Store(true)
-
-	ctx, c.cancel = context.WithCancel(context.Background())
+	c.started.Store(true)
 
 	c.wg.Add(1)
-	go c.receiveLoop(ctx)
+	go c.supervise(ctx, done)
 
 	c.log.Info().
 		Str("server", c.cfg.ServerAddr).
 		Str("client_id", c.id).
+		Str("conn_id", welcome.ConnectionId).
+		Uint32("protocol_version", welcome.ProtocolVersion).
+		Strs("capabilities", welcome.Capabilities).
+		Bool("auto_reconnect", c.cfg.AutoReconnect).
 		Msg("Connected to server")
 
+	c.setState(StateConnected, nil)
 	return nil
 }
 
-// Disconnect closes the connection.
+// dial opens a connection to the server and performs the handshake.
+func (c *client) dial(ctx context.Context) (net.Conn, *StreamWriter, *pb.Welcome, error) {
+	transport, address, err := resolveTransport(c.cfg.ServerAddr, c.cfg.Transport)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	connCtx, cancel := context.WithTimeout(ctx, c.cfg.ConnectTimeout)
+	defer cancel()
+
+	conn, err := transport.Dial(connCtx, address)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to connect: %w", err)
+	}
+
+	if c.cfg.TLS != nil {
+		tlsConn, err := clientTLSHandshake(connCtx, conn, c.cfg.TLS, tlsServerName(address))
+		if err != nil {
+			conn.Close()
+			return nil, nil, nil, fmt.Errorf("failed to connect: %w", err)
+		}
+		conn = tlsConn
+	}
+
+	writer := NewStreamWriter(conn, c.codec)
+
+	welcome, err := sendHello(conn, writer, c.codec, &pb.Hello{
+		ChainId:         c.cfg.ChainID,
+		Name:            c.cfg.Name,
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    c.cfg.Capabilities,
+	}, c.cfg.Signer, c.cfg.ConnectTimeout)
+	if err != nil {
+		conn.Close()
+		return nil, nil, nil, err
+	}
+
+	return conn, writer, welcome, nil
+}
+
+// attach makes a connection that completed the handshake the current one and
+// starts reading from it. The returned channel receives the error that ended
+// the receive loop. c.mu must be held.
+func (c *client) attach(ctx context.Context, conn net.Conn, writer *StreamWriter, welcome *pb.Welcome) <-chan error {
+	if hasCapability(welcome.Capabilities, CapabilityDeflate) {
+		writer.EnableCompression()
+	}
+
+	c.conn = conn
+	c.writer = writer
+	c.sequence.restart()
+	c.serverInfo = ServerInfo{
+		ConnectionID:    welcome.ConnectionId,
+		ProtocolVersion: welcome.ProtocolVersion,
+		Capabilities:    welcome.Capabilities,
+		MessageTypes:    welcome.MessageTypes,
+	}
+
+	// Heartbeats of this connection stop with its receive loop
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.heartbeat = nil
+	if c.cfg.HeartbeatInterval > 0 && welcome.ProtocolVersion >= heartbeatVersion {
+		c.heartbeat = newHeartbeat(c.cfg.HeartbeatInterval, c.cfg.MaxMissedHeartbeats)
+
+		c.wg.Add(1)
+		go func(hb *heartbeat) {
+			defer c.wg.Done()
+			hb.run(ctx, func(msg *pb.Message) error {
+				msg.SenderId = c.id
+				msg.Version = ProtocolVersion
+				return writer.Write(msg)
+			}, func(missed int, err error) {
+				c.log.Warn().Err(err).Int("missed", missed).Msg("Heartbeat failed, closing connection")
+				conn.Close()
+			})
+		}(c.heartbeat)
+	}
+
+	done := make(chan error, 1)
+
+	c.wg.Add(1)
+	go func(hb *heartbeat) {
+		defer c.wg.Done()
+		defer cancel()
+		done <- c.receiveLoop(ctx, conn, writer, hb)
+	}(c.heartbeat)
+
+	return done
+}
+
+// Disconnect closes the connection, or stops reconnecting. Sends still
+// queued are dropped.
 func (c *client) Disconnect(ctx context.Context) error {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	c.connectMu.Lock()
+	defer c.connectMu.Unlock()
 
-	if !c.connected.Load() {
+	if !c.started.Load() {
 		return ErrNotConnected
 	}
 
 	c.log.Info().Msg("Disconnecting")
 
+	c.mu.Lock()
+	c.started.Store(false)
 	if c.cancel != nil {
 		c.cancel()
 	}
-
 	if c.conn != nil {
 		c.conn.Close()
 	}
+	c.mu.Unlock()
 
 	done := make(chan struct{})
 	go func() {
@@ -125,12 +289,43 @@ func (c *client) Disconnect(ctx context.Context) error {
 		return ctx.Err()
 	}
 
+	c.queueMu.Lock()
 	c.connected.Store(false)
+	if len(c.queue) > 0 {
+		c.log.Warn().Int("dropped", len(c.queue)).Msg("Dropping queued messages")
+		c.queue = nil
+	}
+	c.queueMu.Unlock()
+
+	c.setState(StateDisconnected, nil)
 	return nil
 }
 
-// Send sends a message to the server.
+// Send sends a message to the server, signed if a Signer is configured.
+// Payloads the server did not announce in its Welcome are refused. With
+// AutoReconnect, messages sent while reconnecting are queued.
 func (c *client) Send(_ context.Context, msg *pb.Message) error {
+	if !c.started.Load() {
+		return ErrNotConnected
+	}
+
+	if payloadType := PayloadType(msg); !c.ServerInfo().Supports(payloadType) {
+		return fmt.Errorf("%w: %s", ErrUnsupportedMessage, payloadType)
+	}
+
+	msg.SenderId = c.id
+	msg.Version = ProtocolVersion
+
+	if c.cfg.Signer != nil {
+		if err := c.cfg.Signer.Sign(msg); err != nil {
+			return fmt.Errorf("failed to sign: %w", err)
+		}
+	}
+
+	if queued, err := c.enqueue(msg); queued {
+		return err
+	}
+
 	c.mu.RLock()
 	writer := c.writer
 	c.mu.RUnlock()
@@ -139,16 +334,87 @@ func (c *client) Send(_ context.Context, msg *pb.Message) error {
 		return ErrNotConnected
 	}
 
-	msg.SenderId = c.id
-
 	return writer.Write(msg)
 }
 
+// Request sends msg and waits for the reply the server addresses to it.
+// Without a deadline on ctx it waits at most RequestTimeout.
+func (c *client) Request(ctx context.Context, msg *pb.Message) (*pb.Message, error) {
+	if !c.connected.Load() {
+		return nil, ErrNotConnected
+	}
+	if c.ServerInfo().ProtocolVersion < requestVersion {
+		return nil, ErrRequestUnsupported
+	}
+
+	if _, ok := ctx.Deadline(); !ok {
+		timeout := c.cfg.RequestTimeout
+		if timeout <= 0 {
+			timeout = DefaultRequestTimeout
+		}
+
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	id, replies := c.requests.add()
+	defer c.requests.remove(id)
+
+	msg.CorrelationId = id
+	if err := c.Send(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case reply, ok := <-replies:
+		if !ok {
+			return nil, fmt.Errorf("%w: connection lost before reply", ErrNotConnected)
+		}
+		return reply, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: %w", ErrRequestTimeout, ctx.Err())
+		}
+		return nil, ctx.Err()
+	}
+}
+
 // SetHandler sets the message handler.
 func (c *client) SetHandler(handler MessageHandler) {
 	c.handler = handler
 }
 
+// SetErrorHandler sets the handler for message stream errors.
+func (c *client) SetErrorHandler(handler ErrorHandler) {
+	c.onError = handler
+}
+
+// SetStateHandler sets the handler for connection state changes.
+func (c *client) SetStateHandler(handler StateHandler) {
+	c.onState = handler
+}
+
+// ServerInfo returns what the server announced in its Welcome.
+func (c *client) ServerInfo() ServerInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.serverInfo
+}
+
+// RTT returns the last heartbeat round-trip time.
+func (c *client) RTT() time.Duration {
+	c.mu.RLock()
+	hb := c.heartbeat
+	c.mu.RUnlock()
+
+	if hb == nil {
+		return 0
+	}
+	rtt, _ := hb.stats()
+	return rtt
+}
+
 // IsConnected returns connection status.
 func (c *client) IsConnected() bool {
 	return c.connected.Load()
@@ -159,33 +425,99 @@ func (c *client) GetID() string {
 	return c.id
 }
 
-// receiveLoop reads messages from the server.
-func (c *client) receiveLoop(ctx context.Context) {
-	defer c.wg.Done()
+// receiveLoop reads messages from the server and answers heartbeats until
+// ctx is done or reading fails. It returns the read error, or a goAwayError
+// if the server sent a GoAway before.
+func (c *client) receiveLoop(ctx context.Context, conn net.Conn, writer *StreamWriter, hb *heartbeat) error {
 	defer func() {
-		c.connected.Store(false)
+		c.requests.failAll()
 		c.log.Info().Msg("Receive loop ended")
 	}()
 
+	reader := c.codec.acquireReader(conn)
+	defer c.codec.releaseReader(reader)
+
+	var goAway *goAwayError
+
 	for {
 		select {
 		case <-ctx.Done():
-			return
+			return nil
 		default:
-			if c.cfg.ReadTimeout > 0 {
-				_ = c.conn.SetReadDeadline(time.Now().Add(c.cfg.ReadTimeout))
+			if c.cfg.ReadTimeout > 0 && hb == nil {
+				_ = conn.SetReadDeadline(time.Now().Add(c.cfg.ReadTimeout))
 			}
 
 			var msg pb.Message
-			if err := c.codec.Decode(c.conn, &msg); err != nil {
+			if err := c.codec.Decode(reader, &msg); err != nil {
+				if errors.Is(err, ErrCorruptFrame) {
+					c.log.Warn().Err(err).Msg("Dropping corrupt frame")
+					continue
+				}
+
 				if err == io.EOF {
 					c.log.Debug().Msg("Server closed connection")
 				} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
 					continue // Read timeout, continue
-				} else {
+				} else if ctx.Err() == nil && goAway == nil {
 					c.log.Error().Err(err).Msg("Read error")
 				}
-				return
+				if goAway != nil {
+					return goAway
+				}
+				return err
+			}
+
+			switch payload := msg.Payload.(type) {
+			case *pb.Message_Ping:
+				pong := newPongMessage(payload.Ping)
+				pong.SenderId = c.id
+				pong.Version = ProtocolVersion
+				if err := writer.Write(pong); err != nil {
+					c.log.Error().Err(err).Msg("Failed to answer Ping")
+				}
+				continue
+			case *pb.Message_Pong:
+				if hb != nil {
+					hb.pong(payload.Pong, time.Now())
+				}
+				continue
+			case *pb.Message_GoAway:
+				goAway = c.goAway(payload.GoAway)
+				continue
+			}
+
+			// Replies and unknown payloads take stream positions, too
+			deliver, err := c.sequence.check(&msg)
+			if err != nil {
+				c.log.Error().
+					Err(err).
+					Uint64("epoch", msg.Epoch).
+					Uint64("sequence", msg.Sequence).
+					Msg("Message stream error")
+				if c.onError != nil {
+					c.onError(err)
+				}
+			}
+			if !deliver {
+				continue
+			}
+
+			// Replies go to the request waiting for them, never to the handler
+			if msg.ReplyTo != 0 {
+				if !c.requests.resolve(&msg) {
+					c.log.Debug().Uint64("reply_to", msg.ReplyTo).Msg("Dropping reply to an expired request")
+				}
+				continue
+			}
+
+			// Payloads from a newer protocol version are skipped
+			if PayloadType(&msg) == "" {
+				c.log.Debug().
+					Uint32("field", uint32(payloadField(&msg))).
+					Uint32("version", msg.Version).
+					Msg("Skipping unknown payload")
+				continue
 			}
 
 			if c.handler != nil {
@@ -3,17 +3,50 @@ package network
 import (
 	"bufio"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"hash/crc32"
 	"io"
 	"sync"
+	"sync/atomic"
 
 	"google.golang.org/protobuf/proto"
 )
 
+// Frame header:
+//
+//	magic   [2]byte "SP"
+//	version uint8   frameVersion
+//	flags   uint8   frameFlagCompressed
+//	length  uint32  payload length as sent, big endian
+//	crc     uint32  CRC32C of the payload as sent, big endian
+//
+// Legacy frames are a bare big-endian uint32 length whose highest bit flags a
+// compressed payload.
+const (
+	frameHeaderSize = 12
+	frameVersion    = 1
+
+	frameFlagCompressed = 1 << 0
+
+	legacyHeaderSize             = 4
+	legacyFrameCompressed uint32 = 1 << 31
+
+	// maxFrameLength keeps lengths clear of the legacy compressed bit.
+	maxFrameLength = int(legacyFrameCompressed) - 1
+)
+
+var (
+	frameMagic = [2]byte{'S', 'P'}
+	crc32c     = crc32.MakeTable(crc32.Castagnoli)
+)
+
 // Codec handles message encoding/decoding with pooling for performance.
 type Codec struct {
 	maxMessageSize int
-	bufferPool     sync.Pool
+	legacy         bool
+	unmarshal      proto.UnmarshalOptions
+	bufferPool     sync.Pool // *bufio.Reader for connection reads
 }
 
 // NewCodec creates a new codec with buffer pooling.
@@ -28,8 +61,31 @@ func NewCodec(maxMessageSize int) *Codec {
 	}
 }
 
-// Encode marshals and adds length prefix.
+// NewLegacyCodec creates a codec for peers that frame messages with a bare
+// length prefix, without magic bytes or checksum.
+func NewLegacyCodec(maxMessageSize int) *Codec {
+	c := NewCodec(maxMessageSize)
+	c.legacy = true
+	return c
+}
+
+// Encode marshals and frames a message.
 func (c *Codec) Encode(msg proto.Message) ([]byte, error) {
+	return c.encode(msg, false)
+}
+
+// encode marshals and frames a message, compressing large payloads if
+// compress is set. The size limit applies to the uncompressed payload.
+func (c *Codec) encode(msg proto.Message, compressed bool) ([]byte, error) {
+	data, err := c.marshal(msg)
+	if err != nil {
+		return nil, err
+	}
+	return c.frame(data, compressed), nil
+}
+
+// marshal serializes a message and checks it against the size limit.
+func (c *Codec) marshal(msg proto.Message) ([]byte, error) {
 	data, err := proto.Marshal(msg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal: %w", err)
@@ -40,47 +96,187 @@ func (c *Codec) Encode(msg proto.Message) ([]byte, error) {
 		return nil, fmt.Errorf("%w: message size %d exceeds max %d", ErrMessageTooLarge, dataLen, c.maxMessageSize)
 	}
 
-	if dataLen > int(^uint32(0)) {
-		return nil, fmt.Errorf("message size %d exceeds uint32 range", dataLen)
+	if dataLen > maxFrameLength {
+		return nil, fmt.Errorf("message size %d exceeds frame length range", dataLen)
+	}
+
+	return data, nil
+}
+
+// frame returns a new frame carrying a marshalled message, compressed if
+// compressed is set and it pays off. data is not modified.
+func (c *Codec) frame(data []byte, compressed bool) []byte {
+	if compressed {
+		if deflated, ok := compress(data); ok {
+			data = deflated
+		} else {
+			compressed = false
+		}
 	}
 
-	result := make([]byte, 4+dataLen)
-	binary.BigEndian.PutUint32(result[:4], uint32(dataLen))
-	copy(result[4:], data)
+	var crc uint32
+	if !c.legacy {
+		crc = crc32.Checksum(data, crc32c)
+	}
 
-	return result, nil
+	result := c.appendHeader(make([]byte, 0, c.headerSize()+len(data)), len(data), crc, compressed)
+	return append(result, data...)
 }
 
-// Decode reads a length-prefixed message.
-func (c *Codec) Decode(r io.Reader, msg proto.Message) error {
-	lengthBuf := make([]byte, 4)
-	if _, err := io.ReadFull(r, lengthBuf); err != nil {
-		return err
+// headerSize returns the size of the frame header.
+func (c *Codec) headerSize() int {
+	if c.legacy {
+		return legacyHeaderSize
 	}
+	return frameHeaderSize
+}
 
-	length := binary.BigEndian.Uint32(lengthBuf)
-	if int(length) > c.maxMessageSize {
-		return fmt.Errorf("%w: message size %d exceeds max %d", ErrMessageTooLarge, length, c.maxMessageSize)
+// appendHeader appends the header of a frame whose payload, as sent, is
+// length bytes with CRC32C crc. Legacy headers carry no checksum.
+func (c *Codec) appendHeader(dst []byte, length int, crc uint32, compressed bool) []byte {
+	if c.legacy {
+		header := uint32(length)
+		if compressed {
+			header |= legacyFrameCompressed
+		}
+		return binary.BigEndian.AppendUint32(dst, header)
+	}
+
+	var flags byte
+	if compressed {
+		flags |= frameFlagCompressed
+	}
+
+	dst = append(dst, frameMagic[0], frameMagic[1], frameVersion, flags)
+	dst = binary.BigEndian.AppendUint32(dst, uint32(length))
+	return binary.BigEndian.AppendUint32(dst, crc)
+}
+
+// Decode reads a framed message. A frame failing its checksum is consumed
+// and reported as ErrCorruptFrame, so the stream can continue with the next one.
+// Decoding a stream is cheapest from a buffered reader.
+func (c *Codec) Decode(r io.Reader, msg proto.Message) error {
+	readFrame := c.readFrame
+	if c.legacy {
+		readFrame = c.readLegacyFrame
 	}
 
-	data := make([]byte, length)
-	if _, err := io.ReadFull(r, data); err != nil {
+	payload, compressed, err := readFrame(r)
+	if err != nil {
 		return err
 	}
+	// Unmarshal copies what it keeps, so the buffer can be reused right after
+	defer putPayload(payload)
+
+	data := *payload
+	if compressed {
+		if data, err = decompress(data, c.maxMessageSize); err != nil {
+			return err
+		}
+	}
 
-	if err := proto.Unmarshal(data, msg); err != nil {
+	if err := c.unmarshal.Unmarshal(data, msg); err != nil {
 		return fmt.Errorf("failed to unmarshal: %w", err)
 	}
 
 	return nil
 }
 
+// SetUnmarshalOptions sets the options Decode unmarshals messages with, e.g.
+// DiscardUnknown. Set them before the codec is used.
+func (c *Codec) SetUnmarshalOptions(opts proto.UnmarshalOptions) {
+	c.unmarshal = opts
+}
+
+// readFrame reads a payload behind a frame header into a pooled buffer.
+func (c *Codec) readFrame(r io.Reader) (*[]byte, bool, error) {
+	// The magic is checked first, so other protocols are rejected without waiting for a full header
+	magic, err := readNext(r, len(frameMagic))
+	if err != nil {
+		return nil, false, err
+	}
+	if magic[0] != frameMagic[0] || magic[1] != frameMagic[1] {
+		return nil, false, fmt.Errorf("%w: starts with %q", ErrNotProtocol, magic)
+	}
+
+	header, err := readNext(r, frameHeaderSize-len(frameMagic))
+	if err != nil {
+		return nil, false, err
+	}
+
+	version, flags := header[0], header[1]
+	if version != frameVersion {
+		return nil, false, fmt.Errorf("%w: version %d", ErrUnsupportedFrame, version)
+	}
+	if flags&^frameFlagCompressed != 0 {
+		return nil, false, fmt.Errorf("%w: flags %#x", ErrUnsupportedFrame, flags)
+	}
+
+	length := binary.BigEndian.Uint32(header[2:])
+	if int(length) > c.maxMessageSize {
+		return nil, false, fmt.Errorf("%w: message size %d exceeds max %d", ErrMessageTooLarge, length, c.maxMessageSize)
+	}
+	checksum := binary.BigEndian.Uint32(header[6:])
+
+	payload := getPayload(int(length))
+	if _, err := io.ReadFull(r, *payload); err != nil {
+		putPayload(payload)
+		return nil, false, err
+	}
+
+	if got := crc32.Checksum(*payload, crc32c); got != checksum {
+		putPayload(payload)
+		return nil, false, fmt.Errorf("%w: checksum %08x, want %08x", ErrCorruptFrame, got, checksum)
+	}
+
+	return payload, flags&frameFlagCompressed != 0, nil
+}
+
+// readLegacyFrame reads a payload behind a bare length prefix into a pooled buffer.
+func (c *Codec) readLegacyFrame(r io.Reader) (*[]byte, bool, error) {
+	header, err := readNext(r, legacyHeaderSize)
+	if err != nil {
+		return nil, false, err
+	}
+
+	prefix := binary.BigEndian.Uint32(header)
+	length := prefix &^ legacyFrameCompressed
+	if int(length) > c.maxMessageSize {
+		return nil, false, fmt.Errorf("%w: message size %d exceeds max %d", ErrMessageTooLarge, length, c.maxMessageSize)
+	}
+
+	payload := getPayload(int(length))
+	if _, err := io.ReadFull(r, *payload); err != nil {
+		putPayload(payload)
+		return nil, false, err
+	}
+
+	return payload, prefix&legacyFrameCompressed != 0, nil
+}
+
+// frameErrorReason classifies a Decode error for the corrupted frames metric.
+// It returns an empty string for errors that are not about framing.
+func frameErrorReason(err error) string {
+	switch {
+	case errors.Is(err, ErrCorruptFrame):
+		return "checksum"
+	case errors.Is(err, ErrNotProtocol):
+		return "magic"
+	case errors.Is(err, ErrUnsupportedFrame):
+		return "version"
+	}
+	return ""
+}
+
 // StreamWriter provides efficient writing with buffering.
 type StreamWriter struct {
 	w     io.Writer
 	buf   *bufio.Writer
 	codec *Codec
 	mu    sync.Mutex
+
+	// Set once the peer agreed to compression in the handshake
+	compress atomic.Bool
 }
 
 // NewStreamWriter creates a buffered writer.
@@ -92,18 +288,35 @@ func NewStreamWriter(w io.Writer, codec *Codec) *StreamWriter {
 	}
 }
 
+// EnableCompression compresses large payloads from now on. Call it only
+// after the peer enabled CapabilityDeflate.
+func (sw *StreamWriter) EnableCompression() {
+	sw.compress.Store(true)
+}
+
 // Write sends a message.
 func (sw *StreamWriter) Write(msg proto.Message) error {
-	sw.mu.Lock()
-	defer sw.mu.Unlock()
-
-	data, err := sw.codec.Encode(msg)
+	data, err := sw.encode(msg)
 	if err != nil {
 		return err
 	}
+	return sw.writeFrame(data)
+}
 
-	if _, err := sw.buf.Write(data); err != nil {
-		return err
+// encode frames msg the way Write would send it.
+func (sw *StreamWriter) encode(msg proto.Message) ([]byte, error) {
+	return sw.codec.encode(msg, sw.compress.Load())
+}
+
+// writeFrame sends a frame returned by encode, or the parts of one back to back.
+func (sw *StreamWriter) writeFrame(parts ...[]byte) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	for _, part := range parts {
+		if _, err := sw.buf.Write(part); err != nil {
+			return err
+		}
 	}
 
 	return sw.buf.Flush()
@@ -0,0 +1,308 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// newTestBatch returns an xT request with n ERC-20 transfers shaped like RLP
+// encoded legacy transactions: shared recipients and calldata layout, random
+// signatures.
+func newTestBatch(n int) *pb.Message {
+	rng := rand.New(rand.NewSource(int64(n)))
+
+	token := make([]byte, 20)
+	rng.Read(token)
+
+	txs := make([][]byte, n)
+	for i := range txs {
+		tx := []byte{0xf8, 0xa9, byte(i), 0x84, 0x3b, 0x9a, 0xca, 0x00, 0x82, 0xea, 0x60, 0x94}
+		tx = append(tx, token...)
+		tx = append(tx, 0x80, 0xb8, 0x44, 0xa9, 0x05, 0x9c, 0xbb)
+		tx = append(tx, make([]byte, 12)...)
+		to := make([]byte, 20)
+		to[0] = byte(rng.Intn(8)) // A handful of recipients
+		tx = append(tx, to...)
+		amount := make([]byte, 32)
+		binary.BigEndian.PutUint64(amount[24:], uint64(rng.Intn(1_000_000))*1e12)
+		tx = append(tx, amount...)
+		tx = append(tx, 0x25, 0xa0)
+		sig := make([]byte, 65)
+		rng.Read(sig)
+		tx = append(tx, sig[:32]...)
+		tx = append(tx, 0xa0)
+		tx = append(tx, sig[32:64]...)
+		txs[i] = tx
+	}
+
+	return &pb.Message{Payload: &pb.Message_XtRequest{XtRequest: &pb.XTRequest{
+		Transactions: []*pb.TransactionRequest{{ChainId: []byte{0x01}, Transaction: txs}},
+	}}}
+}
+
+func TestCodec_Compression(t *testing.T) {
+	t.Parallel()
+
+	random := make([]byte, 4096)
+	rand.New(rand.NewSource(1)).Read(random)
+
+	tests := []struct {
+		name           string
+		msg            *pb.Message
+		compress       bool
+		wantCompressed bool
+	}{
+		{
+			name:     "disabled",
+			msg:      newTestBatch(100),
+			compress: false,
+		},
+		{
+			name:           "large payload",
+			msg:            newTestBatch(100),
+			compress:       true,
+			wantCompressed: true,
+		},
+		{
+			name:     "small payload",
+			msg:      newTestBatch(1),
+			compress: true,
+		},
+		{
+			name: "incompressible payload",
+			msg: &pb.Message{Payload: &pb.Message_XtRequest{XtRequest: &pb.XTRequest{
+				Transactions: []*pb.TransactionRequest{{Transaction: [][]byte{random}}},
+			}}},
+			compress: true,
+		},
+	}
+
+	codec := NewCodec(1024 * 1024)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			frame, err := codec.encode(tt.msg, tt.compress)
+			require.NoError(t, err)
+
+			assert.Equal(t, tt.wantCompressed, frame[3]&frameFlagCompressed != 0)
+			assert.Equal(t, len(frame)-frameHeaderSize, int(binary.BigEndian.Uint32(frame[4:8])))
+
+			if tt.wantCompressed {
+				assert.Less(t, len(frame), proto.Size(tt.msg))
+			}
+
+			var decoded pb.Message
+			require.NoError(t, codec.Decode(bytes.NewReader(frame), &decoded))
+			assert.True(t, proto.Equal(tt.msg, &decoded))
+		})
+	}
+}
+
+func TestCodec_LimitsDecompressedSize(t *testing.T) {
+	t.Parallel()
+
+	msg := newTestBatch(100)
+	frame, err := NewCodec(1024*1024).encode(msg, true)
+	require.NoError(t, err)
+
+	// The compressed frame fits, the message it inflates to does not
+	limit := proto.Size(msg) - 1
+	require.Less(t, len(frame), limit)
+
+	var decoded pb.Message
+	err = NewCodec(limit).Decode(bytes.NewReader(frame), &decoded)
+	assert.ErrorIs(t, err, ErrMessageTooLarge)
+}
+
+func TestCodec_Framing(t *testing.T) {
+	t.Parallel()
+
+	msg := newTestBatch(100)
+	vote := &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{Vote: true}}}
+
+	for _, legacy := range []bool{false, true} {
+		codec := NewCodec(1024 * 1024)
+		if legacy {
+			codec = NewLegacyCodec(1024 * 1024)
+		}
+
+		for _, compressed := range []bool{false, true} {
+			frame, err := codec.encode(msg, compressed)
+			require.NoError(t, err)
+
+			var decoded pb.Message
+			require.NoError(t, codec.Decode(bytes.NewReader(frame), &decoded), "legacy=%v compressed=%v", legacy, compressed)
+			assert.True(t, proto.Equal(msg, &decoded))
+		}
+	}
+
+	codec := NewCodec(1024 * 1024)
+
+	tests := []struct {
+		name    string
+		corrupt func(frame []byte)
+		wantErr error
+	}{
+		{
+			name:    "other protocol",
+			corrupt: func(frame []byte) { copy(frame, "GET / HTTP/1.1") },
+			wantErr: ErrNotProtocol,
+		},
+		{
+			name:    "newer frame version",
+			corrupt: func(frame []byte) { frame[2] = frameVersion + 1 },
+			wantErr: ErrUnsupportedFrame,
+		},
+		{
+			name:    "unknown flag",
+			corrupt: func(frame []byte) { frame[3] |= 0x80 },
+			wantErr: ErrUnsupportedFrame,
+		},
+		{
+			name:    "flipped payload bit",
+			corrupt: func(frame []byte) { frame[len(frame)-1] ^= 0x01 },
+			wantErr: ErrCorruptFrame,
+		},
+		{
+			name:    "wrong checksum",
+			corrupt: func(frame []byte) { frame[8]++ },
+			wantErr: ErrCorruptFrame,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			frame, err := codec.Encode(vote)
+			require.NoError(t, err)
+			tt.corrupt(frame)
+
+			next, err := codec.Encode(vote)
+			require.NoError(t, err)
+
+			stream := bytes.NewReader(append(frame, next...))
+
+			var decoded pb.Message
+			err = codec.Decode(stream, &decoded)
+			require.ErrorIs(t, err, tt.wantErr)
+			assert.NotEmpty(t, frameErrorReason(err))
+
+			// A corrupt frame is consumed whole, so the stream continues with the next one
+			if tt.wantErr == ErrCorruptFrame {
+				require.NoError(t, codec.Decode(stream, &decoded))
+				assert.True(t, proto.Equal(vote, &decoded))
+			}
+		})
+	}
+}
+
+func TestClient_NegotiatesCompression(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		server, client []string
+		want           []string
+	}{
+		{name: "both", server: []string{CapabilityDeflate}, client: []string{CapabilityDeflate}, want: []string{CapabilityDeflate}},
+		{name: "server only", server: []string{CapabilityDeflate}},
+		{name: "client only", client: []string{CapabilityDeflate}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv, addr := startTestServer(t, ServerConfig{Capabilities: tt.server})
+
+			received := make(chan *pb.Message, 1)
+			srv.SetHandler(func(ctx context.Context, from string, msg *pb.Message) error {
+				received <- msg
+				return srv.Send(ctx, from, msg)
+			})
+
+			c := NewClient(ClientConfig{
+				ServerAddr:     addr,
+				ConnectTimeout: time.Second,
+				MaxMessageSize: 1024 * 1024,
+				ChainID:        []byte{0x01},
+				Capabilities:   tt.client,
+			}, zerolog.Nop())
+
+			echoed := make(chan *pb.Message, 1)
+			c.SetHandler(func(_ context.Context, _ string, msg *pb.Message) error {
+				echoed <- msg
+				return nil
+			})
+
+			require.NoError(t, c.Connect(context.Background()))
+			defer c.Disconnect(context.Background())
+
+			assert.Equal(t, tt.want, c.ServerInfo().Capabilities)
+
+			msg := newTestBatch(100)
+			require.NoError(t, c.Send(context.Background(), msg))
+
+			for _, ch := range []chan *pb.Message{received, echoed} {
+				select {
+				case got := <-ch:
+					assert.True(t, proto.Equal(msg.GetXtRequest(), got.GetXtRequest()))
+				case <-time.After(time.Second):
+					t.Fatal("message not delivered")
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkCodec encodes and decodes xT batches with and without compression.
+// wire-B/op is the frame size, MB/s the uncompressed payload throughput.
+func BenchmarkCodec(b *testing.B) {
+	codec := NewCodec(10 * 1024 * 1024)
+
+	for _, n := range []int{10, 100, 1000} {
+		msg := newTestBatch(n)
+
+		for _, compressed := range []bool{false, true} {
+			name := fmt.Sprintf("txs=%d/raw", n)
+			if compressed {
+				name = fmt.Sprintf("txs=%d/deflate", n)
+			}
+
+			b.Run(name, func(b *testing.B) {
+				b.SetBytes(int64(proto.Size(msg)))
+				b.ReportAllocs()
+
+				var wire int
+				for i := 0; i < b.N; i++ {
+					frame, err := codec.encode(msg, compressed)
+					if err != nil {
+						b.Fatal(err)
+					}
+					wire = len(frame)
+
+					var decoded pb.Message
+					if err := codec.Decode(bytes.NewReader(frame), &decoded); err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(wire), "wire-B/op")
+			})
+		}
+	}
+}
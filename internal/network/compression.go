@@ -0,0 +1,113 @@
+package network
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// CapabilityDeflate enables DEFLATE compression of large payloads. Each side
+// compresses only after both announced it in the handshake.
+const CapabilityDeflate = "deflate"
+
+// compressMinSize is the smallest payload worth compressing, so votes and
+// acknowledgements stay raw.
+const compressMinSize = 1024
+
+var (
+	flateWriters = sync.Pool{
+		New: func() interface{} {
+			// BestSpeed: every connection compresses on its write path
+			w, _ := flate.NewWriter(nil, flate.BestSpeed)
+			return w
+		},
+	}
+	flateReaders = sync.Pool{
+		New: func() interface{} {
+			return flate.NewReader(nil)
+		},
+	}
+)
+
+// compress returns data DEFLATE-compressed, or false if that does not make it smaller.
+func compress(data []byte) ([]byte, bool) {
+	return deflate(data, true)
+}
+
+// compressOpen is compress for data that is completed by a storedBlock: the
+// stream is flushed to a byte boundary but has no final block.
+func compressOpen(data []byte) ([]byte, bool) {
+	return deflate(data, false)
+}
+
+// storedBlock returns data, at most 65535 bytes, as the final uncompressed
+// block of a DEFLATE stream left open by compressOpen.
+func storedBlock(data []byte) []byte {
+	n := len(data)
+	block := make([]byte, 0, 5+n)
+	block = append(block, 0x01, byte(n), byte(n>>8), ^byte(n), ^byte(n>>8)) // BFINAL, stored; LEN, NLEN
+	return append(block, data...)
+}
+
+func deflate(data []byte, final bool) ([]byte, bool) {
+	if len(data) < compressMinSize {
+		return nil, false
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(data) / 2)
+
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+
+	if _, err := w.Write(data); err != nil {
+		return nil, false
+	}
+
+	end := w.Flush
+	if final {
+		end = w.Close
+	}
+	if err := end(); err != nil {
+		return nil, false
+	}
+
+	if buf.Len() >= len(data) {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
+
+// decompress inflates data, failing with ErrMessageTooLarge beyond maxSize bytes.
+func decompress(data []byte, maxSize int) ([]byte, error) {
+	r := flateReaders.Get().(io.ReadCloser)
+	defer flateReaders.Put(r)
+
+	if err := r.(flate.Resetter).Reset(bytes.NewReader(data), nil); err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+
+	// Read one byte past the limit to tell a full message from an oversized one
+	out, err := io.ReadAll(io.LimitReader(r, int64(maxSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress: %w", err)
+	}
+	if len(out) > maxSize {
+		return nil, fmt.Errorf("%w: decompressed size exceeds max %d", ErrMessageTooLarge, maxSize)
+	}
+
+	return out, nil
+}
+
+// hasCapability reports whether capability was enabled in the handshake.
+func hasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
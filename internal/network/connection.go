@@ -9,13 +9,20 @@ import (
 // conn wraps a network connection with metadata
 type conn struct {
 	net.Conn
-	id   string
-	info ConnectionInfo
-	mu   sync.RWMutex
+	id        string
+	info      ConnectionInfo
+	heartbeat *heartbeat // Nil if the peer does not answer heartbeats
+	outbound  *outbound  // Nil for client connections
+	stopped   bool       // Reading stopped for shutdown
+	mu        sync.RWMutex
 }
 
 // NewConnection creates a new connection wrapper
 func NewConnection(netConn net.Conn, id string) Connection {
+	return newConn(netConn, id)
+}
+
+func newConn(netConn net.Conn, id string) *conn {
 	return &conn{
 		Conn: netConn,
 		id:   id,
@@ -35,7 +42,60 @@ func (c *conn) GetID() string {
 func (c *conn) GetInfo() ConnectionInfo {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
-	return c.info
+	info := c.info
+	if c.heartbeat != nil {
+		info.RTT, info.MissedHeartbeats = c.heartbeat.stats()
+	}
+	if c.outbound != nil {
+		info.QueueDepth, info.QueueDropped = c.outbound.stats()
+	}
+	return info
+}
+
+// setOutbound attaches the outbound queue whose stats GetInfo reports.
+func (c *conn) setOutbound(o *outbound) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.outbound = o
+}
+
+// setHeartbeat attaches the heartbeat whose stats GetInfo reports.
+func (c *conn) setHeartbeat(h *heartbeat) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.heartbeat = h
+}
+
+// stopReading makes blocked and later reads time out. It reports false if
+// reading was already stopped.
+func (c *conn) stopReading() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped {
+		return false
+	}
+	c.stopped = true
+	_ = c.Conn.SetReadDeadline(time.Unix(1, 0))
+	return true
+}
+
+// readingStopped reports whether stopReading was called.
+func (c *conn) readingStopped() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.stopped
+}
+
+// SetReadDeadline sets the read deadline unless reading was stopped.
+func (c *conn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.stopped {
+		return nil
+	}
+	return c.Conn.SetReadDeadline(t)
 }
 
 func (c *conn) UpdateLastSeen() {
@@ -49,3 +109,20 @@ func (c *conn) SetChainID(chainID string) {
 	defer c.mu.Unlock()
 	c.info.ChainID = chainID
 }
+
+// setIdentity records the identity of the verified client certificate.
+func (c *conn) setIdentity(identity string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.info.Identity = identity
+}
+
+// setPeer records what the peer announced in its Hello.
+func (c *conn) setPeer(chainID, name string, version uint32, capabilities []string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.info.ChainID = chainID
+	c.info.Name = name
+	c.info.ProtocolVersion = version
+	c.info.Capabilities = capabilities
+}
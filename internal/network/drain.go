@@ -0,0 +1,71 @@
+package network
+
+import (
+	"fmt"
+	"time"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// goAwayShutdown is the GoAway reason sent by Stop.
+const goAwayShutdown = "shutdown"
+
+func newGoAwayMessage(reason string, reconnectDelay time.Duration) *pb.Message {
+	return &pb.Message{
+		SenderId: serverSenderID,
+		Version:  ProtocolVersion,
+		Payload: &pb.Message_GoAway{GoAway: &pb.GoAway{
+			Reason:           reason,
+			ReconnectDelayMs: uint64(reconnectDelay.Milliseconds()),
+		}},
+	}
+}
+
+// drainConn stops reading from a connection and tells the peer to go away.
+// The receive loop ends once the message being handled is done, and the
+// connection is closed once everything queued for it, GoAway included, is
+// written. Peers before version 5 do not know GoAway and only see the close.
+func (s *server) drainConn(c *conn, out *outbound) {
+	if !c.stopReading() {
+		return // Already draining
+	}
+
+	if c.GetInfo().ProtocolVersion < goAwayVersion {
+		return
+	}
+	if err := out.send(newGoAwayMessage(goAwayShutdown, s.cfg.ReconnectHint)); err != nil {
+		s.log.Debug().Err(err).Str("conn_id", c.id).Msg("Failed to send GoAway")
+	}
+}
+
+// goAwayError ends the receive loop of a connection the server closed after a GoAway.
+type goAwayError struct {
+	reason string
+	delay  time.Duration // Suggested by the server, zero if none
+}
+
+func (e *goAwayError) Error() string {
+	return fmt.Sprintf("%s: %s", ErrServerGoingAway, e.reason)
+}
+
+func (e *goAwayError) Unwrap() error {
+	return ErrServerGoingAway
+}
+
+// goAway handles a GoAway from the server: Sends are refused, or queued with
+// AutoReconnect, while replies still pending are read until the server
+// closes the connection.
+func (c *client) goAway(msg *pb.GoAway) *goAwayError {
+	delay := time.Duration(msg.ReconnectDelayMs) * time.Millisecond
+
+	c.log.Info().
+		Str("reason", msg.Reason).
+		Dur("reconnect_delay", delay).
+		Msg("Server going away")
+
+	c.queueMu.Lock()
+	c.connected.Store(false)
+	c.queueMu.Unlock()
+
+	return &goAwayError{reason: msg.Reason, delay: delay}
+}
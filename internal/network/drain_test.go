@@ -0,0 +1,152 @@
+package network
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+type stateChange struct {
+	state ClientState
+	err   error
+}
+
+func TestServer_StopDrains(t *testing.T) {
+	t.Parallel()
+
+	const hint = 300 * time.Millisecond
+
+	srv, addr := startTestServer(t, ServerConfig{ReconnectHint: hint})
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	srv.SetHandler(func(ctx context.Context, from string, msg *pb.Message) error {
+		close(handling)
+		<-release
+		return srv.Reply(ctx, from, msg, &pb.Message{Payload: &pb.Message_Ack{Ack: &pb.Ack{}}})
+	})
+
+	c := NewClient(ClientConfig{
+		ServerAddr:     addr,
+		ConnectTimeout: time.Second,
+		MaxMessageSize: 1024 * 1024,
+		ChainID:        []byte{0x01},
+		ReconnectDelay: 10 * time.Millisecond,
+	}, zerolog.Nop(), WithAutoReconnect(50*time.Millisecond, 8))
+
+	changes := make(chan stateChange, 16)
+	c.SetStateHandler(func(state ClientState, err error) { changes <- stateChange{state, err} })
+
+	require.NoError(t, c.Connect(context.Background()))
+	defer c.Disconnect(context.Background())
+	require.Equal(t, StateConnected, (<-changes).state)
+
+	replies := make(chan error, 1)
+	go func() {
+		_, err := c.Request(context.Background(), &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{}}})
+		replies <- err
+	}()
+	<-handling
+
+	stopped := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		stopped <- srv.Stop(ctx)
+	}()
+
+	// After the GoAway, Sends are queued for the next connection
+	require.Eventually(t, func() bool { return !c.IsConnected() }, time.Second, time.Millisecond)
+	queued := &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{XtId: &pb.XtID{Hash: []byte{0x01}}}}}
+	require.NoError(t, c.Send(context.Background(), queued))
+
+	// The message being handled is still answered
+	close(release)
+	require.NoError(t, <-replies)
+	require.NoError(t, <-stopped)
+
+	change := <-changes
+	require.Equal(t, StateReconnecting, change.state)
+	assert.ErrorIs(t, change.err, ErrServerGoingAway)
+	lost := time.Now()
+
+	received := make(chan *pb.Message, 1)
+	restartTestServer(t, addr, func(_ context.Context, _ string, msg *pb.Message) error {
+		received <- msg
+		return nil
+	})
+
+	require.Equal(t, StateConnected, (<-changes).state)
+	assert.GreaterOrEqual(t, time.Since(lost), hint-10*time.Millisecond, "first attempt waits the hinted delay")
+
+	select {
+	case msg := <-received:
+		assert.Equal(t, []byte{0x01}, msg.GetVote().GetXtId().GetHash())
+	case <-time.After(5 * time.Second):
+		t.Fatal("queued message not delivered")
+	}
+}
+
+func TestServer_StopClosesConnectionsOnTimeout(t *testing.T) {
+	t.Parallel()
+
+	srv, addr := startTestServer(t, ServerConfig{})
+
+	handling := make(chan struct{})
+	release := make(chan struct{})
+	defer close(release)
+	srv.SetHandler(func(context.Context, string, *pb.Message) error {
+		close(handling)
+		<-release
+		return nil
+	})
+
+	c := NewClient(ClientConfig{
+		ServerAddr:     addr,
+		ConnectTimeout: time.Second,
+		MaxMessageSize: 1024 * 1024,
+		ChainID:        []byte{0x01},
+	}, zerolog.Nop())
+
+	changes := make(chan stateChange, 16)
+	c.SetStateHandler(func(state ClientState, err error) { changes <- stateChange{state, err} })
+
+	require.NoError(t, c.Connect(context.Background()))
+	require.Equal(t, StateConnected, (<-changes).state)
+
+	require.NoError(t, c.Send(context.Background(), &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{}}}))
+	<-handling
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, srv.Stop(ctx), context.DeadlineExceeded)
+
+	// The handler never finished, so the connection is closed without waiting for it
+	select {
+	case change := <-changes:
+		assert.Equal(t, StateDisconnected, change.state)
+		assert.ErrorIs(t, change.err, ErrServerGoingAway)
+	case <-time.After(5 * time.Second):
+		t.Fatal("connection not closed")
+	}
+}
+
+func TestServer_StopWithoutGoAwayForOlderPeers(t *testing.T) {
+	t.Parallel()
+
+	srv, addr := startTestServer(t, ServerConfig{})
+	conn, _ := dialHello(t, addr, goAwayVersion-1)
+	require.Eventually(t, func() bool { return len(srv.GetConnections()) == 1 }, time.Second, time.Millisecond)
+
+	require.NoError(t, srv.Stop(context.Background()))
+
+	var msg pb.Message
+	assert.ErrorIs(t, NewCodec(1024*1024).Decode(conn, &msg), io.EOF, "closed without GoAway")
+}
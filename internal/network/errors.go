@@ -18,6 +18,57 @@ var (
 	// ErrConnectionLimit is returned when the connection limit is reached.
 	ErrConnectionLimit = errors.New("connection limit reached")
 
+	// ErrConnectionClosed is returned when sending to a connection that is closing.
+	ErrConnectionClosed = errors.New("connection closed")
+
+	// ErrOutboundQueueFull is returned when a message is dropped because the connection's outbound queue is full.
+	ErrOutboundQueueFull = errors.New("outbound queue full")
+
+	// ErrSlowConsumer is returned when a connection is closed because its outbound queue is full.
+	ErrSlowConsumer = errors.New("slow consumer disconnected")
+
+	// ErrUnknownTransport is returned for an address whose scheme has no transport.
+	ErrUnknownTransport = errors.New("unknown transport")
+
 	// ErrMessageTooLarge is returned when a message exceeds the size limit.
 	ErrMessageTooLarge = errors.New("message too large")
+
+	// ErrNotProtocol is returned when a peer sends data that is not a protocol frame.
+	ErrNotProtocol = errors.New("not a protocol frame")
+
+	// ErrUnsupportedFrame is returned for frames with an unknown header version or flags.
+	ErrUnsupportedFrame = errors.New("unsupported frame")
+
+	// ErrCorruptFrame is returned for a frame whose payload fails its checksum.
+	ErrCorruptFrame = errors.New("corrupt frame")
+
+	// ErrHandshakeFailed is returned when a connection does not complete the Hello/Welcome handshake.
+	ErrHandshakeFailed = errors.New("handshake failed")
+
+	// ErrChainNotAllowed is returned when a client certificate announces a chain it is not allowed to speak for.
+	ErrChainNotAllowed = errors.New("chain not allowed for certificate")
+
+	// ErrUnsupportedMessage is returned when sending a payload the server does not accept.
+	ErrUnsupportedMessage = errors.New("unsupported message type")
+
+	// ErrSendQueueFull is returned by Send while reconnecting once the send queue is full.
+	ErrSendQueueFull = errors.New("send queue full")
+
+	// ErrServerGoingAway is reported when the server closed the connection after a GoAway.
+	ErrServerGoingAway = errors.New("server going away")
+
+	// ErrRequestUnsupported is returned for requests to a server that does not answer them.
+	ErrRequestUnsupported = errors.New("server does not answer requests")
+
+	// ErrRequestTimeout is returned when a request got no reply before its deadline.
+	ErrRequestTimeout = errors.New("request timed out")
+
+	// ErrSequenceGap is reported when messages of the stream were missed.
+	ErrSequenceGap = errors.New("sequence gap")
+
+	// ErrSequenceReordered is reported for duplicate or out-of-order messages of the stream.
+	ErrSequenceReordered = errors.New("sequence reordered")
+
+	// ErrStaleEpoch is reported for messages from an older publisher epoch.
+	ErrStaleEpoch = errors.New("stale publisher epoch")
 )
@@ -0,0 +1,180 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/kchojn/poc-shared-publisher/internal/auth"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// Protocol versions:
+//
+//	1: length-prefixed Message with Hello/Welcome handshake
+//	2: Message.version, UnsupportedPayload replies, Welcome.message_types
+//	3: Ping/Pong heartbeats
+//	4: Message.correlation_id and reply_to for request/response
+//	5: GoAway before the server closes a connection on shutdown
+const (
+	// ProtocolVersion is the highest protocol version spoken by this implementation.
+	ProtocolVersion uint32 = 5
+
+	// MinProtocolVersion is the oldest protocol version still accepted.
+	MinProtocolVersion uint32 = 1
+
+	// Protocol versions introducing optional behaviour
+	unsupportedReplyVersion uint32 = 2
+	heartbeatVersion        uint32 = 3
+	requestVersion          uint32 = 4
+	goAwayVersion           uint32 = 5
+
+	// DefaultHandshakeTimeout bounds the handshake when no timeout is configured.
+	DefaultHandshakeTimeout = 5 * time.Second
+)
+
+// acceptHello reads the Hello that must open every connection. With a
+// keyring, the Hello must be signed by a key of the chain it announces.
+func acceptHello(conn net.Conn, codec *Codec, keyring *auth.Keyring, timeout time.Duration) (*pb.Hello, error) {
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	var msg pb.Message
+	if err := codec.Decode(conn, &msg); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrHandshakeFailed, err)
+	}
+
+	hello := msg.GetHello()
+	if hello == nil {
+		return nil, fmt.Errorf("%w: expected Hello, got %T", ErrHandshakeFailed, msg.Payload)
+	}
+
+	if len(hello.ChainId) == 0 {
+		return nil, fmt.Errorf("%w: Hello without chain_id", ErrHandshakeFailed)
+	}
+
+	if hello.ProtocolVersion < MinProtocolVersion {
+		return nil, fmt.Errorf("%w: protocol version %d, want %d to %d",
+			ErrHandshakeFailed, hello.ProtocolVersion, MinProtocolVersion, ProtocolVersion)
+	}
+
+	if keyring != nil {
+		if err := keyring.Verify(&msg); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrHandshakeFailed, err)
+		}
+	}
+
+	return hello, nil
+}
+
+// detectFraming reads the first byte of a new connection to tell framed from
+// legacy peers. It returns conn with that byte put back. A first byte that
+// neither starts the frame magic nor a legacy length within maxMessageSize
+// comes from a peer speaking another protocol.
+func detectFraming(conn net.Conn, maxMessageSize int, timeout time.Duration) (net.Conn, bool, error) {
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+
+	if err := conn.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+	}
+	defer conn.SetReadDeadline(time.Time{})
+
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(conn, first); err != nil {
+		return nil, false, fmt.Errorf("%w: %w", ErrHandshakeFailed, err)
+	}
+
+	replayed := &replayConn{Conn: conn, r: io.MultiReader(bytes.NewReader(first), conn)}
+
+	if first[0] == frameMagic[0] {
+		return replayed, false, nil
+	}
+
+	// The Hello is never compressed, so its length prefix starts with the top byte of its length
+	if int(first[0])<<24 > maxMessageSize {
+		return nil, false, fmt.Errorf("%w: %w: starts with %q", ErrHandshakeFailed, ErrNotProtocol, first)
+	}
+
+	return replayed, true, nil
+}
+
+// replayConn is a net.Conn whose reads start with bytes already read from it.
+type replayConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *replayConn) Read(p []byte) (int, error) {
+	return c.r.Read(p)
+}
+
+// negotiateVersion returns the protocol version used on a connection: the
+// highest version both sides speak.
+func negotiateVersion(offered uint32) uint32 {
+	return min(offered, ProtocolVersion)
+}
+
+// sendHello performs the client side of the handshake and returns the Welcome.
+// The Hello is signed if signer is set.
+func sendHello(conn net.Conn, writer *StreamWriter, codec *Codec, hello *pb.Hello, signer *auth.Signer, timeout time.Duration) (*pb.Welcome, error) {
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+	}
+	defer conn.SetDeadline(time.Time{})
+
+	msg := &pb.Message{Payload: &pb.Message_Hello{Hello: hello}}
+	if signer != nil {
+		if err := signer.Sign(msg); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+		}
+	}
+
+	if err := writer.Write(msg); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+	}
+
+	var reply pb.Message
+	if err := codec.Decode(conn, &reply); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrHandshakeFailed, err)
+	}
+
+	welcome := reply.GetWelcome()
+	if welcome == nil {
+		return nil, fmt.Errorf("%w: expected Welcome, got %T", ErrHandshakeFailed, reply.Payload)
+	}
+
+	if welcome.ProtocolVersion < MinProtocolVersion || welcome.ProtocolVersion > hello.ProtocolVersion {
+		return nil, fmt.Errorf("%w: server chose protocol version %d", ErrHandshakeFailed, welcome.ProtocolVersion)
+	}
+
+	return welcome, nil
+}
+
+// negotiateCapabilities returns the offered capabilities that are supported, in offered order.
+func negotiateCapabilities(offered, supported []string) []string {
+	var enabled []string
+	for _, capability := range offered {
+		for _, s := range supported {
+			if capability == s {
+				enabled = append(enabled, capability)
+				break
+			}
+		}
+	}
+	return enabled
+}
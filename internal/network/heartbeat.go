@@ -0,0 +1,118 @@
+package network
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// DefaultMaxMissedHeartbeats is used when heartbeats are enabled without a limit.
+const DefaultMaxMissedHeartbeats = 3
+
+// heartbeat pings a peer every interval and judges it dead once it missed
+// maxMissed Pongs in a row. A Ping is missed if its Pong has not arrived by
+// the next tick, so the interval must exceed the round-trip time.
+type heartbeat struct {
+	interval  time.Duration
+	maxMissed int
+
+	mu       sync.Mutex
+	nonce    uint64 // Nonce of the last Ping
+	answered bool   // Whether the last Ping got its Pong
+	missed   int    // Consecutive missed Pongs
+	rtt      time.Duration
+}
+
+func newHeartbeat(interval time.Duration, maxMissed int) *heartbeat {
+	if maxMissed <= 0 {
+		maxMissed = DefaultMaxMissedHeartbeats
+	}
+	return &heartbeat{
+		interval:  interval,
+		maxMissed: maxMissed,
+		answered:  true,
+	}
+}
+
+// run sends a Ping every interval until ctx is done. It stops and calls
+// onDead once the peer missed too many heartbeats or a Ping cannot be sent.
+func (h *heartbeat) run(ctx context.Context, send func(*pb.Message) error, onDead func(missed int, err error)) {
+	ticker := time.NewTicker(h.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			ping, alive := h.tick(now)
+			if !alive {
+				onDead(h.maxMissed, nil)
+				return
+			}
+			if err := send(ping); err != nil {
+				onDead(0, err)
+				return
+			}
+		}
+	}
+}
+
+// tick returns the next Ping, or false if the peer is considered dead.
+func (h *heartbeat) tick(now time.Time) (*pb.Message, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.answered {
+		h.missed++
+		if h.missed >= h.maxMissed {
+			return nil, false
+		}
+	}
+
+	h.nonce++
+	h.answered = false
+
+	return &pb.Message{
+		Payload: &pb.Message_Ping{Ping: &pb.Ping{
+			Nonce:  h.nonce,
+			SentAt: now.UnixNano(),
+		}},
+	}, true
+}
+
+// pong records the answer to the last Ping and returns the round-trip time.
+// Pongs of earlier Pings are ignored.
+func (h *heartbeat) pong(pong *pb.Pong, now time.Time) (time.Duration, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if pong.Nonce != h.nonce || h.answered {
+		return 0, false
+	}
+
+	h.answered = true
+	h.missed = 0
+	h.rtt = now.Sub(time.Unix(0, pong.SentAt))
+
+	return h.rtt, true
+}
+
+// stats returns the last round-trip time and the consecutive missed heartbeats.
+func (h *heartbeat) stats() (time.Duration, int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.rtt, h.missed
+}
+
+// newPongMessage answers a Ping.
+func newPongMessage(ping *pb.Ping) *pb.Message {
+	return &pb.Message{
+		Payload: &pb.Message_Pong{Pong: &pb.Pong{
+			Nonce:  ping.Nonce,
+			SentAt: ping.SentAt,
+		}},
+	}
+}
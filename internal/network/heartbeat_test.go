@@ -0,0 +1,139 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHeartbeat(t *testing.T) {
+	t.Parallel()
+
+	start := time.Unix(1000, 0)
+
+	tests := []struct {
+		name       string
+		answered   []bool // Whether the Pong of each Ping arrives
+		wantAlive  bool
+		wantMissed int
+	}{
+		{name: "all answered", answered: []bool{true, true, true, true}, wantAlive: true, wantMissed: 0},
+		{name: "missed below limit", answered: []bool{false, false, true}, wantAlive: true, wantMissed: 0},
+		{name: "missed after recovery", answered: []bool{false, true, false}, wantAlive: true, wantMissed: 1},
+		{name: "missed limit", answered: []bool{false, false, false}, wantAlive: false, wantMissed: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			h := newHeartbeat(time.Second, 3)
+			now := start
+
+			for _, answered := range tt.answered {
+				ping, alive := h.tick(now)
+				require.True(t, alive)
+
+				if answered {
+					rtt, ok := h.pong(newPongMessage(ping.GetPing()).GetPong(), now.Add(5*time.Millisecond))
+					require.True(t, ok)
+					assert.Equal(t, 5*time.Millisecond, rtt)
+				}
+				now = now.Add(time.Second)
+			}
+
+			// The next tick judges the last Ping
+			_, alive := h.tick(now)
+			assert.Equal(t, tt.wantAlive, alive)
+
+			_, missed := h.stats()
+			assert.Equal(t, tt.wantMissed, missed)
+		})
+	}
+
+	t.Run("stale pong", func(t *testing.T) {
+		t.Parallel()
+
+		h := newHeartbeat(time.Second, 3)
+		first, _ := h.tick(start)
+		_, _ = h.tick(start.Add(time.Second))
+
+		_, ok := h.pong(newPongMessage(first.GetPing()).GetPong(), start.Add(time.Second))
+		assert.False(t, ok)
+	})
+}
+
+func TestServer_Heartbeats(t *testing.T) {
+	t.Parallel()
+
+	t.Run("healthy idle peers stay connected", func(t *testing.T) {
+		t.Parallel()
+
+		srv, addr := startTestServer(t, ServerConfig{
+			ReadTimeout:         50 * time.Millisecond,
+			HeartbeatInterval:   20 * time.Millisecond,
+			MaxMissedHeartbeats: 2,
+		})
+
+		c := NewClient(ClientConfig{
+			ServerAddr:        addr,
+			ConnectTimeout:    time.Second,
+			ReadTimeout:       50 * time.Millisecond,
+			MaxMessageSize:    1024 * 1024,
+			ChainID:           []byte{0x01},
+			HeartbeatInterval: 20 * time.Millisecond,
+		}, zerolog.Nop())
+		require.NoError(t, c.Connect(context.Background()))
+		defer c.Disconnect(context.Background())
+
+		// Well past the read timeout
+		time.Sleep(200 * time.Millisecond)
+
+		assert.True(t, c.IsConnected())
+		assert.Positive(t, c.RTT())
+
+		conns := srv.GetConnections()
+		require.Len(t, conns, 1)
+		assert.Positive(t, conns[0].RTT)
+		assert.Zero(t, conns[0].MissedHeartbeats)
+	})
+
+	t.Run("silent peers are closed", func(t *testing.T) {
+		t.Parallel()
+
+		srv, addr := startTestServer(t, ServerConfig{}, WithHeartbeat(20*time.Millisecond, 2))
+
+		disconnected := make(chan ConnectionInfo, 1)
+		srv.SetDisconnectHandler(func(info ConnectionInfo) { disconnected <- info })
+
+		// Completes the handshake but never reads, so it answers no Ping
+		dialHello(t, addr, ProtocolVersion)
+
+		select {
+		case info := <-disconnected:
+			assert.Equal(t, 2, info.MissedHeartbeats)
+		case <-time.After(2 * time.Second):
+			t.Fatal("silent connection not closed")
+		}
+	})
+
+	t.Run("peers before version 3 are not pinged", func(t *testing.T) {
+		t.Parallel()
+
+		srv, addr := startTestServer(t, ServerConfig{
+			HeartbeatInterval:   10 * time.Millisecond,
+			MaxMissedHeartbeats: 1,
+		})
+
+		dialHello(t, addr, heartbeatVersion-1)
+		time.Sleep(100 * time.Millisecond)
+
+		conns := srv.GetConnections()
+		require.Len(t, conns, 1)
+		assert.Zero(t, conns[0].MissedHeartbeats)
+	})
+}
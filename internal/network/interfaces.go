@@ -14,12 +14,22 @@ type Server interface {
 	Start(ctx context.Context) error
 	// Stop gracefully stops the server
 	Stop(ctx context.Context) error
-	// Broadcast sends a message to all connected clients except the excluded one
+	// Broadcast sends a message to all connected clients except the excluded one.
+	// Messages sent with Broadcast, Send and Reply are stamped with the epoch and
+	// the next sequence number of the client's connection, so each client sees a
+	// contiguous stream. Messages are queued per client; Broadcast and Send do
+	// not wait for them to be written.
 	Broadcast(ctx context.Context, msg *pb.Message, excludeID string) error
 	// Send sends a message to a specific client
 	Send(ctx context.Context, clientID string, msg *pb.Message) error
+	// Reply answers a request received from a client, so the client's Request returns reply
+	Reply(ctx context.Context, clientID string, request, reply *pb.Message) error
 	// SetHandler sets the message handler
 	SetHandler(handler MessageHandler)
+	// SetConnectHandler sets the handler called when a connection is accepted
+	SetConnectHandler(handler ConnectHandler)
+	// SetDisconnectHandler sets the handler called when a connection closes
+	SetDisconnectHandler(handler DisconnectHandler)
 	// GetConnections returns all active connections
 	GetConnections() []ConnectionInfo
 }
@@ -32,8 +42,19 @@ type Client interface {
 	Disconnect(ctx context.Context) error
 	// Send sends a message to the server
 	Send(ctx context.Context, msg *pb.Message) error
+	// Request sends a message to the server and waits for its reply. Messages
+	// that are not replies to a request still go to the handler.
+	Request(ctx context.Context, msg *pb.Message) (*pb.Message, error)
 	// SetHandler sets the message handler for received messages
 	SetHandler(handler MessageHandler)
+	// SetErrorHandler sets the handler for message stream errors, such as sequence gaps
+	SetErrorHandler(handler ErrorHandler)
+	// SetStateHandler sets the handler for connection state changes
+	SetStateHandler(handler StateHandler)
+	// ServerInfo returns what the server announced in the handshake
+	ServerInfo() ServerInfo
+	// RTT returns the last heartbeat round-trip time, zero without heartbeats
+	RTT() time.Duration
 	// IsConnected returns connection status
 	IsConnected() bool
 	// GetID returns the client identifier
@@ -43,6 +64,15 @@ type Client interface {
 // MessageHandler processes incoming messages
 type MessageHandler func(ctx context.Context, from string, msg *pb.Message) error
 
+// ErrorHandler is called for errors that do not close the connection
+type ErrorHandler func(err error)
+
+// ConnectHandler is called once a new connection completed the handshake and is ready to send and receive
+type ConnectHandler func(info ConnectionInfo)
+
+// DisconnectHandler is called after a connection has been closed
+type DisconnectHandler func(info ConnectionInfo)
+
 // ConnectionInfo contains information about a connection
 type ConnectionInfo struct {
 	ID          string
@@ -50,6 +80,34 @@ type ConnectionInfo struct {
 	ConnectedAt time.Time
 	LastSeen    time.Time
 	ChainID     string
+	Identity    string // Client certificate identity, empty without mutual TLS
+
+	// Announced in the handshake
+	Name            string
+	ProtocolVersion uint32
+	Capabilities    []string // Enabled on this connection
+
+	// Outbound queue
+	QueueDepth   int    // Messages waiting to be written
+	QueueDropped uint64 // Messages dropped because the queue was full
+
+	// Heartbeats, zero unless the peer answers them
+	RTT              time.Duration // Last measured round-trip time
+	MissedHeartbeats int           // Consecutive unanswered Pings
+}
+
+// ServerInfo contains what the server announced in its Welcome
+type ServerInfo struct {
+	ConnectionID    string
+	ProtocolVersion uint32   // Negotiated for the connection
+	Capabilities    []string // Enabled on the connection
+	MessageTypes    []string // Payloads the server accepts; empty before protocol version 2
+}
+
+// Supports reports whether the server accepts the payload type, such as "vote".
+// Servers before protocol version 2 do not announce their payloads and are assumed to accept all.
+func (i ServerInfo) Supports(payloadType string) bool {
+	return supportsPayload(i.MessageTypes, payloadType)
 }
 
 // Connection represents a network connection
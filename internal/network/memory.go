@@ -0,0 +1,160 @@
+package network
+
+import (
+	"context"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// defaultMemTransport serves the mem:// scheme.
+var defaultMemTransport = NewMemTransport()
+
+// MemTransport connects servers and clients of the same process through
+// in-memory pipes instead of the OS network stack, e.g. in tests. Addresses
+// are arbitrary names. Each MemTransport has its own names; mem:// addresses
+// share one.
+type MemTransport struct {
+	mu        sync.Mutex
+	listeners map[string]*memListener
+	dialed    atomic.Uint64
+}
+
+// NewMemTransport creates an in-memory transport without listeners.
+func NewMemTransport() *MemTransport {
+	return &MemTransport{listeners: make(map[string]*memListener)}
+}
+
+// Listen listens on the name address.
+func (t *MemTransport) Listen(address string) (net.Listener, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if _, ok := t.listeners[address]; ok {
+		return nil, memError("listen", address, syscall.EADDRINUSE)
+	}
+
+	l := &memListener{
+		transport: t,
+		addr:      memAddr(address),
+		conns:     make(chan net.Conn),
+		done:      make(chan struct{}),
+	}
+	t.listeners[address] = l
+	return l, nil
+}
+
+// Dial connects to the listener on the name address. It blocks until the
+// listener accepts the connection or ctx is done.
+func (t *MemTransport) Dial(ctx context.Context, address string) (net.Conn, error) {
+	t.mu.Lock()
+	l := t.listeners[address]
+	t.mu.Unlock()
+
+	if l == nil {
+		return nil, memError("dial", address, syscall.ECONNREFUSED)
+	}
+
+	local := memAddr(address + "#" + strconv.FormatUint(t.dialed.Add(1), 10))
+	server, client := net.Pipe()
+
+	select {
+	case l.conns <- &memConn{Conn: server, local: l.addr, remote: local}:
+		return &memConn{Conn: client, local: local, remote: l.addr}, nil
+	case <-l.done:
+		server.Close()
+		client.Close()
+		return nil, memError("dial", address, syscall.ECONNREFUSED)
+	case <-ctx.Done():
+		server.Close()
+		client.Close()
+		return nil, memError("dial", address, ctx.Err())
+	}
+}
+
+func memError(op, address string, err error) error {
+	return &net.OpError{Op: op, Net: "mem", Addr: memAddr(address), Err: err}
+}
+
+// memAddr is the name of an in-memory connection end.
+type memAddr string
+
+func (a memAddr) Network() string { return "mem" }
+func (a memAddr) String() string  { return string(a) }
+
+// memConn is one end of an in-memory pipe.
+type memConn struct {
+	net.Conn
+	local, remote memAddr
+}
+
+func (c *memConn) LocalAddr() net.Addr  { return c.local }
+func (c *memConn) RemoteAddr() net.Addr { return c.remote }
+
+// memListener accepts the connections dialed to its name.
+type memListener struct {
+	transport *MemTransport
+	addr      memAddr
+	conns     chan net.Conn
+	done      chan struct{}
+	closeOnce sync.Once
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+func (l *memListener) Accept() (net.Conn, error) {
+	select {
+	case <-l.done:
+		return nil, memError("accept", string(l.addr), net.ErrClosed)
+	default:
+	}
+
+	l.mu.Lock()
+	deadline := l.deadline
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case conn := <-l.conns:
+		return conn, nil
+	case <-l.done:
+		return nil, memError("accept", string(l.addr), net.ErrClosed)
+	case <-timeout:
+		return nil, memError("accept", string(l.addr), os.ErrDeadlineExceeded)
+	}
+}
+
+// SetDeadline makes Accept time out at t. The zero time waits forever.
+func (l *memListener) SetDeadline(t time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.deadline = t
+	return nil
+}
+
+// Close stops accepting and frees the name.
+func (l *memListener) Close() error {
+	l.closeOnce.Do(func() {
+		close(l.done)
+
+		l.transport.mu.Lock()
+		delete(l.transport.listeners, string(l.addr))
+		l.transport.mu.Unlock()
+	})
+	return nil
+}
+
+func (l *memListener) Addr() net.Addr {
+	return l.addr
+}
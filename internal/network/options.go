@@ -20,19 +20,52 @@ func WithTimeouts(read, write time.Duration) ServerOption {
 	}
 }
 
+// WithHeartbeat sets the Ping interval and the unanswered Pings before a connection is closed.
+func WithHeartbeat(interval time.Duration, maxMissed int) ServerOption {
+	return func(cfg *ServerConfig) {
+		cfg.HeartbeatInterval = interval
+		cfg.MaxMissedHeartbeats = maxMissed
+	}
+}
+
 // ClientOption configures a client.
 type ClientOption func(*ClientConfig)
 
-// WithReconnectDelay sets the reconnection delay.
+// WithReconnectDelay sets the delay before the first reconnect attempt.
 func WithReconnectDelay(delay time.Duration) ClientOption {
 	return func(cfg *ClientConfig) {
 		cfg.ReconnectDelay = delay
 	}
 }
 
+// WithAutoReconnect re-establishes lost connections, backing off up to maxDelay
+// between attempts and queueing up to queueSize Sends meanwhile.
+func WithAutoReconnect(maxDelay time.Duration, queueSize int) ClientOption {
+	return func(cfg *ClientConfig) {
+		cfg.AutoReconnect = true
+		cfg.MaxReconnectDelay = maxDelay
+		cfg.SendQueueSize = queueSize
+	}
+}
+
 // WithConnectTimeout sets the connection timeout.
 func WithConnectTimeout(timeout time.Duration) ClientOption {
 	return func(cfg *ClientConfig) {
 		cfg.ConnectTimeout = timeout
 	}
 }
+
+// WithRequestTimeout sets how long Request waits for a reply when its context has no deadline.
+func WithRequestTimeout(timeout time.Duration) ClientOption {
+	return func(cfg *ClientConfig) {
+		cfg.RequestTimeout = timeout
+	}
+}
+
+// WithClientHeartbeat sets the Ping interval and the unanswered Pings before the connection is closed.
+func WithClientHeartbeat(interval time.Duration, maxMissed int) ClientOption {
+	return func(cfg *ClientConfig) {
+		cfg.HeartbeatInterval = interval
+		cfg.MaxMissedHeartbeats = maxMissed
+	}
+}
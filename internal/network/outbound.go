@@ -0,0 +1,245 @@
+package network
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kchojn/poc-shared-publisher/pkg/metrics"
+)
+
+// QueuePolicy decides what happens to a message sent to a connection whose
+// outbound queue is full.
+type QueuePolicy string
+
+const (
+	QueueDropOldest QueuePolicy = "drop_oldest" // The oldest queued message is dropped to make room
+	QueueDropNewest QueuePolicy = "drop_newest" // The new message is dropped
+	QueueDisconnect QueuePolicy = "disconnect"  // The connection is closed
+)
+
+// DefaultOutboundQueueSize bounds each connection's outbound queue when no SendQueueSize is configured.
+const DefaultOutboundQueueSize = 256
+
+// outbound is the queue of frames waiting to be written to a connection. A
+// dedicated goroutine drains it, so a slow peer only holds up its own queue.
+type outbound struct {
+	connID  string
+	conn    net.Conn
+	writer  *StreamWriter
+	size    int
+	policy  QueuePolicy
+	timeout time.Duration // Per frame, zero waits forever
+	log     zerolog.Logger
+
+	mu       sync.Mutex
+	queue    [][][]byte // Frames, each as parts written back to back
+	sequence uint64     // Stream position of the last stamped frame
+	closed   bool
+	draining bool          // No more frames are accepted, run closes once the queue is written
+	ready    chan struct{} // Signalled when frames are queued
+	done     chan struct{} // Closed by close
+	stopped  chan struct{} // Closed when run returns
+	dropped  uint64
+}
+
+func newOutbound(connID string, conn net.Conn, writer *StreamWriter, size int, policy QueuePolicy, timeout time.Duration, log zerolog.Logger) *outbound {
+	if size <= 0 {
+		size = DefaultOutboundQueueSize
+	}
+	if policy == "" {
+		policy = QueueDisconnect
+	}
+
+	return &outbound{
+		connID:  connID,
+		conn:    conn,
+		writer:  writer,
+		size:    size,
+		policy:  policy,
+		timeout: timeout,
+		log:     log,
+		ready:   make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+}
+
+// send encodes msg for the connection and queues it.
+func (o *outbound) send(msg proto.Message) error {
+	frame, err := o.writer.encode(msg)
+	if err != nil {
+		return err
+	}
+	return o.enqueue(frame)
+}
+
+// sendStamped queues a message at the next position of the connection's
+// stream, so the peer sees a contiguous sequence of stamped messages. A
+// message the queue policy rejects takes no position.
+func (o *outbound) sendStamped(frames *sharedFrames, epoch uint64) error {
+	body := frames.bodyFor(o.writer)
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	sequence := o.sequence + 1
+	if err := o.enqueueLocked(body.frame(epoch, sequence)...); err != nil {
+		return err
+	}
+	o.sequence = sequence
+
+	return nil
+}
+
+// enqueue queues a frame, or its parts, applying the queue policy if the queue is full.
+func (o *outbound) enqueue(frame ...[]byte) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.enqueueLocked(frame...)
+}
+
+// enqueueLocked is enqueue with o.mu held.
+func (o *outbound) enqueueLocked(frame ...[]byte) error {
+	if o.closed || o.draining {
+		return ErrConnectionClosed
+	}
+
+	if len(o.queue) >= o.size {
+		switch o.policy {
+		case QueueDropOldest:
+			o.queue = o.queue[1:]
+			o.drop()
+		case QueueDropNewest:
+			o.drop()
+			return fmt.Errorf("%w: %d frames queued", ErrOutboundQueueFull, len(o.queue))
+		default:
+			o.log.Warn().Int("queued", len(o.queue)).Msg("Outbound queue full, closing connection")
+			o.conn.Close()
+			return fmt.Errorf("%w: %d frames queued", ErrSlowConsumer, len(o.queue))
+		}
+	}
+
+	o.queue = append(o.queue, frame)
+	metrics.ConnectionQueueDepth.WithLabelValues(o.connID).Set(float64(len(o.queue)))
+
+	o.signal()
+	return nil
+}
+
+// signal wakes the writer goroutine.
+func (o *outbound) signal() {
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
+
+// drop counts a dropped frame. o.mu must be held.
+func (o *outbound) drop() {
+	o.dropped++
+	metrics.ConnectionQueueDropped.WithLabelValues(o.connID).Inc()
+}
+
+// run writes queued frames until close is called, a write fails or the queue
+// is drained. A write that does not complete within the timeout closes the
+// connection.
+func (o *outbound) run() {
+	defer close(o.stopped)
+
+	for {
+		select {
+		case <-o.done:
+			return
+		case <-o.ready:
+		}
+
+		for {
+			frame, ok := o.next()
+			if !ok {
+				break
+			}
+
+			if o.timeout > 0 {
+				_ = o.conn.SetWriteDeadline(time.Now().Add(o.timeout))
+			}
+			if err := o.writer.writeFrame(frame...); err != nil {
+				var ne net.Error
+				if errors.As(err, &ne) && ne.Timeout() {
+					o.log.Warn().Dur("timeout", o.timeout).Msg("Write timed out, closing connection")
+				} else {
+					o.log.Debug().Err(err).Msg("Write failed, closing connection")
+				}
+				o.conn.Close()
+				o.close()
+				return
+			}
+		}
+
+		if o.isDraining() {
+			o.close()
+			return
+		}
+	}
+}
+
+// drain stops accepting frames and waits until the queued ones are written,
+// or writing them failed. The writer goroutine must be running.
+func (o *outbound) drain() {
+	o.mu.Lock()
+	o.draining = true
+	o.mu.Unlock()
+
+	o.signal()
+	<-o.stopped
+}
+
+func (o *outbound) isDraining() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.draining
+}
+
+// next pops the oldest queued frame.
+func (o *outbound) next() ([][]byte, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed || len(o.queue) == 0 {
+		return nil, false
+	}
+
+	frame := o.queue[0]
+	o.queue[0] = nil
+	o.queue = o.queue[1:]
+	metrics.ConnectionQueueDepth.WithLabelValues(o.connID).Set(float64(len(o.queue)))
+	return frame, true
+}
+
+// stats returns the number of queued and dropped frames.
+func (o *outbound) stats() (int, uint64) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.queue), o.dropped
+}
+
+// close stops the writer goroutine. Frames still queued are discarded.
+func (o *outbound) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.closed {
+		return
+	}
+	o.closed = true
+	o.queue = nil
+	close(o.done)
+
+	metrics.ConnectionQueueDepth.DeleteLabelValues(o.connID)
+	metrics.ConnectionQueueDropped.DeleteLabelValues(o.connID)
+}
@@ -0,0 +1,186 @@
+package network
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// newStalledOutbound returns a running queue of the given size whose peer
+// reads nothing until told to, with frame "0" taken by the writer goroutine.
+func newStalledOutbound(t *testing.T, size int, policy QueuePolicy, timeout time.Duration) (*outbound, net.Conn) {
+	t.Helper()
+
+	local, peer := net.Pipe()
+	t.Cleanup(func() { local.Close(); peer.Close() })
+
+	out := newOutbound("test", local, NewStreamWriter(local, NewCodec(1024)), size, policy, timeout, zerolog.Nop())
+	t.Cleanup(out.close)
+	go out.run()
+
+	require.NoError(t, out.enqueue([]byte("0")))
+	require.Eventually(t, func() bool {
+		depth, _ := out.stats()
+		return depth == 0
+	}, time.Second, time.Millisecond, "writer takes the first frame")
+
+	return out, peer
+}
+
+func TestOutbound_QueuePolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		policy      QueuePolicy
+		wantErr     error  // Of the frame that does not fit
+		wantWritten string // Read by the peer afterwards
+	}{
+		{name: "drop oldest", policy: QueueDropOldest, wantWritten: "023"},
+		{name: "drop newest", policy: QueueDropNewest, wantErr: ErrOutboundQueueFull, wantWritten: "012"},
+		{name: "disconnect", policy: QueueDisconnect, wantErr: ErrSlowConsumer},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			out, peer := newStalledOutbound(t, 2, tt.policy, 0)
+
+			require.NoError(t, out.enqueue([]byte("1")))
+			require.NoError(t, out.enqueue([]byte("2")))
+
+			err := out.enqueue([]byte("3"))
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			if tt.policy == QueueDisconnect {
+				_, err := io.ReadAll(peer)
+				assert.NoError(t, err, "connection is closed")
+				return
+			}
+
+			depth, dropped := out.stats()
+			assert.Equal(t, 2, depth)
+			assert.Equal(t, uint64(1), dropped)
+
+			written := make([]byte, len(tt.wantWritten))
+			_, err = io.ReadFull(peer, written)
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantWritten, string(written))
+		})
+	}
+}
+
+func TestOutbound_WriteTimeout(t *testing.T) {
+	t.Parallel()
+
+	out, _ := newStalledOutbound(t, 2, QueueDisconnect, 20*time.Millisecond)
+
+	// The stalled write times out and takes the connection down
+	require.Eventually(t, func() bool {
+		return out.enqueue([]byte("1")) == ErrConnectionClosed
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestOutbound_Drain(t *testing.T) {
+	t.Parallel()
+
+	out, peer := newStalledOutbound(t, 4, QueueDisconnect, 0)
+	require.NoError(t, out.enqueue([]byte("1")))
+	require.NoError(t, out.enqueue([]byte("2")))
+
+	drained := make(chan struct{})
+	go func() {
+		out.drain()
+		close(drained)
+	}()
+
+	require.Eventually(t, func() bool {
+		return out.enqueue([]byte("3")) == ErrConnectionClosed
+	}, time.Second, time.Millisecond, "no frames are accepted while draining")
+
+	// Frames queued before are still written
+	written := make([]byte, 3)
+	_, err := io.ReadFull(peer, written)
+	require.NoError(t, err)
+	assert.Equal(t, "012", string(written))
+
+	select {
+	case <-drained:
+	case <-time.After(time.Second):
+		t.Fatal("drain did not return once the queue was written")
+	}
+}
+
+func TestServer_EvictsSlowConsumer(t *testing.T) {
+	t.Parallel()
+
+	// Writes never time out here, so only the full queue can evict the slow consumer
+	srv, addr := startTestServer(t, ServerConfig{
+		MaxMessageSize: 10 * 1024 * 1024,
+		WriteTimeout:   time.Minute,
+		SendQueueSize:  4,
+	})
+
+	// The slow consumer completes the handshake and then stops reading
+	slow, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer slow.Close()
+
+	codec := NewCodec(10 * 1024 * 1024)
+	_, err = sendHello(slow, NewStreamWriter(slow, codec), codec, &pb.Hello{ChainId: []byte{0x02}, ProtocolVersion: ProtocolVersion}, nil, time.Second)
+	require.NoError(t, err)
+
+	c := NewClient(ClientConfig{
+		ServerAddr:     addr,
+		ConnectTimeout: time.Second,
+		MaxMessageSize: 10 * 1024 * 1024,
+		ChainID:        []byte{0x01},
+	}, zerolog.Nop())
+
+	received := make(chan struct{}, 1)
+	c.SetHandler(func(context.Context, string, *pb.Message) error {
+		received <- struct{}{}
+		return nil
+	})
+	require.NoError(t, c.Connect(context.Background()))
+	defer c.Disconnect(context.Background())
+
+	require.Eventually(t, func() bool { return len(srv.GetConnections()) == 2 }, time.Second, time.Millisecond)
+
+	// Once the socket buffers are full, writes to the slow consumer stall and
+	// its queue fills up. Broadcasts keep returning and reaching the fast
+	// client, the one that finds the queue full evicts the slow consumer.
+	batch := newTestBatch(2000)
+	evicted := false
+	for i := 0; i < 200 && !evicted; i++ {
+		err := srv.Broadcast(context.Background(), proto.Clone(batch).(*pb.Message), "")
+		if err != nil {
+			require.ErrorIs(t, err, ErrSlowConsumer)
+			evicted = true
+		}
+
+		select {
+		case <-received:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("fast client did not get broadcast %d", i)
+		}
+	}
+	require.True(t, evicted, "slow consumer was never evicted")
+
+	require.Eventually(t, func() bool { return len(srv.GetConnections()) == 1 }, 5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "0x01", srv.GetConnections()[0].ChainID)
+}
@@ -0,0 +1,80 @@
+package network
+
+import (
+	"strconv"
+
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/reflect/protoreflect"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+var payloadOneof = (&pb.Message{}).ProtoReflect().Descriptor().Oneofs().ByName("payload")
+
+// PayloadType returns the Message field name of the payload, such as
+// "xt_request", or "" if msg has no payload this build knows.
+func PayloadType(msg *pb.Message) string {
+	if field := msg.ProtoReflect().WhichOneof(payloadOneof); field != nil {
+		return string(field.Name())
+	}
+	return ""
+}
+
+// payloadField returns the Message field number of the payload. A payload
+// added in a newer protocol version is kept in the unknown fields; its field
+// number is the first unknown length-delimited field. Zero means no payload.
+func payloadField(msg *pb.Message) protoreflect.FieldNumber {
+	if field := msg.ProtoReflect().WhichOneof(payloadOneof); field != nil {
+		return field.Number()
+	}
+
+	unknown := msg.ProtoReflect().GetUnknown()
+	for len(unknown) > 0 {
+		num, typ, n := protowire.ConsumeField(unknown)
+		if n < 0 {
+			return 0
+		}
+		if typ == protowire.BytesType {
+			return num
+		}
+		unknown = unknown[n:]
+	}
+	return 0
+}
+
+// supportsPayload reports whether payloadType is in types; an empty list
+// supports every payload this build knows.
+func supportsPayload(types []string, payloadType string) bool {
+	if payloadType == "" {
+		return false
+	}
+	if len(types) == 0 {
+		return true
+	}
+	for _, t := range types {
+		if t == payloadType {
+			return true
+		}
+	}
+	return false
+}
+
+func newUnsupportedMessage(msg *pb.Message) *pb.Message {
+	return &pb.Message{
+		SenderId: serverSenderID,
+		Payload: &pb.Message_Unsupported{
+			Unsupported: &pb.UnsupportedPayload{
+				Field: uint32(payloadField(msg)),
+				Type:  PayloadType(msg),
+			},
+		},
+	}
+}
+
+// payloadLabel names an unsupported payload for metrics.
+func payloadLabel(unsupported *pb.UnsupportedPayload) string {
+	if unsupported.Type != "" {
+		return unsupported.Type
+	}
+	return "field_" + strconv.FormatUint(uint64(unsupported.Field), 10)
+}
@@ -0,0 +1,86 @@
+package network
+
+import (
+	"bufio"
+	"io"
+	"math/bits"
+	"sync"
+)
+
+// Payload buffers are pooled by size class: powers of two from
+// 1<<minPayloadClass to 1<<maxPayloadClass bytes. Larger payloads are
+// allocated per frame.
+const (
+	minPayloadClass = 9  // 512B
+	maxPayloadClass = 22 // 4MiB
+)
+
+var payloadPools [maxPayloadClass - minPayloadClass + 1]sync.Pool
+
+// getPayload returns a buffer of length n, pooled if n fits a size class.
+func getPayload(n int) *[]byte {
+	class := max(bits.Len(uint(n-1)), minPayloadClass)
+	if n == 0 || class > maxPayloadClass {
+		buf := make([]byte, n)
+		return &buf
+	}
+
+	if buf, ok := payloadPools[class-minPayloadClass].Get().(*[]byte); ok {
+		*buf = (*buf)[:n]
+		return buf
+	}
+	buf := make([]byte, n, 1<<class)
+	return &buf
+}
+
+// putPayload returns a buffer from getPayload to its pool. The buffer must
+// not be used afterwards.
+func putPayload(buf *[]byte) {
+	c := cap(*buf)
+	if c == 0 || c&(c-1) != 0 {
+		return // Not from a size class
+	}
+	class := bits.Len(uint(c)) - 1
+	if class < minPayloadClass || class > maxPayloadClass {
+		return
+	}
+	*buf = (*buf)[:0]
+	payloadPools[class-minPayloadClass].Put(buf)
+}
+
+// acquireReader returns a pooled buffered reader of r for decoding a stream
+// of frames. Release it with releaseReader once r is no longer read.
+func (c *Codec) acquireReader(r io.Reader) *bufio.Reader {
+	br := c.bufferPool.Get().(*bufio.Reader)
+	br.Reset(r)
+	return br
+}
+
+// releaseReader returns a reader from acquireReader to the pool. Bytes it
+// buffered but Decode did not consume are lost.
+func (c *Codec) releaseReader(br *bufio.Reader) {
+	br.Reset(nil)
+	c.bufferPool.Put(br)
+}
+
+// readNext returns the next n bytes of r. Bytes peeked from a buffered reader
+// are only valid until its next read, but need no allocation.
+func readNext(r io.Reader, n int) ([]byte, error) {
+	if br, ok := r.(*bufio.Reader); ok && n <= br.Size() {
+		data, err := br.Peek(n)
+		if err != nil {
+			if err == io.EOF && len(data) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		_, _ = br.Discard(n)
+		return data, nil
+	}
+
+	data := make([]byte, n)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
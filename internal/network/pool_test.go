@@ -0,0 +1,191 @@
+package network
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+func TestPayloadPool(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		size    int
+		wantCap int
+	}{
+		{size: 0, wantCap: 0},
+		{size: 1, wantCap: 512},
+		{size: 512, wantCap: 512},
+		{size: 513, wantCap: 1024},
+		{size: 4 << 20, wantCap: 4 << 20},
+		{size: 4<<20 + 1, wantCap: 4<<20 + 1}, // Too large to pool
+	}
+
+	for _, tt := range tests {
+		buf := getPayload(tt.size)
+		assert.Len(t, *buf, tt.size)
+		assert.Equal(t, tt.wantCap, cap(*buf), "size %d", tt.size)
+		putPayload(buf)
+	}
+}
+
+func TestCodec_DecodeBuffered(t *testing.T) {
+	t.Parallel()
+
+	codec := NewCodec(1024 * 1024)
+
+	msgs := []*pb.Message{
+		{Payload: &pb.Message_Vote{Vote: &pb.Vote{Vote: true}}},
+		newTestBatch(100),
+		{Payload: &pb.Message_Ping{Ping: &pb.Ping{Nonce: 7}}},
+	}
+
+	var stream []byte
+	for _, msg := range msgs {
+		frame, err := codec.encode(msg, msg.GetXtRequest() != nil)
+		require.NoError(t, err)
+		stream = append(stream, frame...)
+	}
+
+	reader := codec.acquireReader(bytes.NewReader(stream[:len(stream)-1]))
+	defer codec.releaseReader(reader)
+
+	var decoded []*pb.Message
+	for range msgs[:2] {
+		var msg pb.Message
+		require.NoError(t, codec.Decode(reader, &msg))
+		decoded = append(decoded, &msg)
+	}
+
+	// Decoded messages do not share the pooled buffers, which the next frames reuse
+	for i := 0; i < 10; i++ {
+		buf := getPayload(len(stream))
+		for j := range *buf {
+			(*buf)[j] = 0xff
+		}
+		putPayload(buf)
+	}
+	for i, msg := range decoded {
+		assert.True(t, proto.Equal(msgs[i], msg))
+	}
+
+	var msg pb.Message
+	assert.ErrorIs(t, codec.Decode(reader, &msg), io.ErrUnexpectedEOF, "truncated last frame")
+
+	// A stream ending between frames ends with io.EOF
+	reader.Reset(bytes.NewReader(stream))
+	for range msgs {
+		require.NoError(t, codec.Decode(reader, &msg))
+	}
+	assert.ErrorIs(t, codec.Decode(reader, &msg), io.EOF)
+}
+
+func TestCodec_UnmarshalOptions(t *testing.T) {
+	t.Parallel()
+
+	msg := &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{Vote: true}}}
+	msg.ProtoReflect().SetUnknown([]byte{0xa8, 0x1f, 0x01}) // Field 501, varint 1
+
+	frame, err := NewCodec(1024).Encode(msg)
+	require.NoError(t, err)
+
+	for _, discard := range []bool{false, true} {
+		codec := NewCodec(1024)
+		codec.SetUnmarshalOptions(proto.UnmarshalOptions{DiscardUnknown: discard})
+
+		var decoded pb.Message
+		require.NoError(t, codec.Decode(bytes.NewReader(frame), &decoded))
+		assert.Equal(t, discard, len(decoded.ProtoReflect().GetUnknown()) == 0)
+		assert.True(t, decoded.GetVote().GetVote())
+	}
+}
+
+// loopReader replays the same bytes forever, like a connection under sustained load.
+type loopReader struct {
+	data []byte
+	off  int
+}
+
+func (r *loopReader) Read(p []byte) (int, error) {
+	n := copy(p, r.data[r.off:])
+	r.off = (r.off + n) % len(r.data)
+	return n, nil
+}
+
+// BenchmarkDecode decodes a stream of frames. unpooled reads every header and
+// payload into a new slice, conn decodes from the connection directly and
+// pooled through a pooled buffered reader, as the receive loops do.
+func BenchmarkDecode(b *testing.B) {
+	codec := NewCodec(10 * 1024 * 1024)
+
+	vote := &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{SenderChainId: []byte{0x01}, XtId: &pb.XtID{Hash: make([]byte, 32)}, Vote: true}}}
+
+	for _, bench := range []struct {
+		name string
+		msg  *pb.Message
+	}{
+		{name: "vote", msg: vote},
+		{name: "txs=100", msg: newTestBatch(100)},
+		{name: "txs=1000", msg: newTestBatch(1000)},
+	} {
+		frame, err := codec.Encode(bench.msg)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.Run(bench.name+"/unpooled", func(b *testing.B) {
+			r := &loopReader{data: frame}
+			b.SetBytes(int64(len(frame)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				header := make([]byte, frameHeaderSize)
+				if _, err := io.ReadFull(r, header); err != nil {
+					b.Fatal(err)
+				}
+				data := make([]byte, len(frame)-frameHeaderSize)
+				if _, err := io.ReadFull(r, data); err != nil {
+					b.Fatal(err)
+				}
+
+				var msg pb.Message
+				if err := proto.Unmarshal(data, &msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(bench.name+"/conn", func(b *testing.B) {
+			r := &loopReader{data: frame}
+			b.SetBytes(int64(len(frame)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				var msg pb.Message
+				if err := codec.Decode(r, &msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+
+		b.Run(bench.name+"/pooled", func(b *testing.B) {
+			r := codec.acquireReader(&loopReader{data: frame})
+			defer codec.releaseReader(r)
+			b.SetBytes(int64(len(frame)))
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				var msg pb.Message
+				if err := codec.Decode(r, &msg); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
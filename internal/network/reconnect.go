@@ -0,0 +1,221 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+const (
+	// DefaultReconnectDelay is the first reconnect backoff when no ReconnectDelay is configured.
+	DefaultReconnectDelay = 500 * time.Millisecond
+
+	// DefaultMaxReconnectDelay caps the reconnect backoff when no MaxReconnectDelay is configured.
+	DefaultMaxReconnectDelay = 30 * time.Second
+
+	// DefaultSendQueueSize bounds the Sends buffered while reconnecting when no SendQueueSize is configured.
+	DefaultSendQueueSize = 1024
+)
+
+// ClientState is the connection state of a client.
+type ClientState int32
+
+const (
+	StateDisconnected ClientState = iota // Not connected and not trying to
+	StateConnected                       // Handshake completed, Sends are written
+	StateReconnecting                    // Connection lost, Sends are queued until it is re-established
+)
+
+func (s ClientState) String() string {
+	switch s {
+	case StateConnected:
+		return "connected"
+	case StateReconnecting:
+		return "reconnecting"
+	}
+	return "disconnected"
+}
+
+// StateHandler is called when the client's connection state changes. err is
+// what caused the change, nil for Connect and Disconnect.
+type StateHandler func(state ClientState, err error)
+
+// backoff computes reconnect delays: doubling from base up to max, each
+// randomized to between half and the full delay so clients that lost the
+// same server do not reconnect in lockstep.
+type backoff struct {
+	base, max time.Duration
+	next      time.Duration
+}
+
+func newBackoff(base, limit time.Duration) *backoff {
+	if base <= 0 {
+		base = DefaultReconnectDelay
+	}
+	if limit <= 0 {
+		limit = DefaultMaxReconnectDelay
+	}
+	return &backoff{base: base, max: max(base, limit)}
+}
+
+// delay returns the time to wait before the next attempt.
+func (b *backoff) delay() time.Duration {
+	if b.next == 0 {
+		b.next = b.base
+	}
+	d := b.next
+	b.next = min(2*b.next, b.max)
+
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+// supervise follows the connection whose receive loop reports to done. A lost
+// connection is re-established with AutoReconnect, and reported as
+// disconnected otherwise.
+func (c *client) supervise(ctx context.Context, done <-chan error) {
+	defer c.wg.Done()
+
+	for {
+		var err error
+		select {
+		case <-ctx.Done():
+			return
+		case err = <-done:
+		}
+
+		if ctx.Err() != nil {
+			return // Disconnect
+		}
+
+		c.queueMu.Lock()
+		c.connected.Store(false)
+		c.queueMu.Unlock()
+
+		if !c.cfg.AutoReconnect {
+			c.started.Store(false)
+			c.setState(StateDisconnected, err)
+			return
+		}
+
+		// A server going away suggests when to come back
+		var (
+			goAway *goAwayError
+			first  time.Duration
+		)
+		if errors.As(err, &goAway) {
+			first = goAway.delay
+			c.log.Info().Dur("delay", first).Msg("Server went away, reconnecting")
+		} else {
+			c.log.Warn().Err(err).Msg("Connection lost, reconnecting")
+		}
+		c.setState(StateReconnecting, err)
+
+		if done = c.reconnect(ctx, first); done == nil {
+			return
+		}
+	}
+}
+
+// reconnect dials until a connection completes the handshake or ctx is done.
+// The first attempt waits first if positive, later ones back off. It returns
+// the done channel of the new connection, nil if ctx is done.
+func (c *client) reconnect(ctx context.Context, first time.Duration) <-chan error {
+	b := newBackoff(c.cfg.ReconnectDelay, c.cfg.MaxReconnectDelay)
+
+	for attempt := 1; ; attempt++ {
+		delay := first
+		if attempt > 1 || delay <= 0 {
+			delay = b.delay()
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+
+		conn, writer, welcome, err := c.dial(ctx)
+		if err != nil {
+			c.log.Warn().Err(err).Int("attempt", attempt).Dur("delay", delay).Msg("Reconnect failed")
+			continue
+		}
+
+		c.mu.Lock()
+		if ctx.Err() != nil {
+			c.mu.Unlock()
+			conn.Close()
+			return nil
+		}
+		done := c.attach(ctx, conn, writer, welcome)
+		c.mu.Unlock()
+
+		if err := c.flushQueue(writer); err != nil {
+			c.log.Warn().Err(err).Msg("Failed to send queued messages")
+		}
+
+		c.log.Info().Int("attempt", attempt).Msg("Reconnected")
+		c.setState(StateConnected, nil)
+		return done
+	}
+}
+
+// enqueue buffers msg while the client is reconnecting. It reports false if
+// the client is connected and msg should be written instead.
+func (c *client) enqueue(msg *pb.Message) (bool, error) {
+	c.queueMu.Lock()
+	defer c.queueMu.Unlock()
+
+	if c.connected.Load() || !c.cfg.AutoReconnect || !c.started.Load() {
+		return false, nil
+	}
+
+	size := c.cfg.SendQueueSize
+	if size <= 0 {
+		size = DefaultSendQueueSize
+	}
+	if len(c.queue) >= size {
+		return true, ErrSendQueueFull
+	}
+
+	c.queue = append(c.queue, msg)
+	return true, nil
+}
+
+// flushQueue writes the messages queued while reconnecting, in order, and
+// marks the client connected once the queue is empty, so later Sends cannot
+// overtake queued ones. Messages not written stay queued for the next connection.
+func (c *client) flushQueue(writer *StreamWriter) error {
+	for {
+		c.queueMu.Lock()
+		queued := c.queue
+		c.queue = nil
+		if len(queued) == 0 {
+			c.connected.Store(true)
+			c.queueMu.Unlock()
+			return nil
+		}
+		c.queueMu.Unlock()
+
+		for i, msg := range queued {
+			if err := writer.Write(msg); err != nil {
+				c.queueMu.Lock()
+				c.queue = append(queued[i:], c.queue...)
+				c.queueMu.Unlock()
+				return err
+			}
+		}
+	}
+}
+
+// setState reports a state change to the state handler.
+func (c *client) setState(state ClientState, err error) {
+	if ClientState(c.state.Swap(int32(state))) == state {
+		return
+	}
+	if c.onState != nil {
+		c.onState(state, err)
+	}
+}
@@ -0,0 +1,136 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+func TestBackoff(t *testing.T) {
+	t.Parallel()
+
+	b := newBackoff(100*time.Millisecond, time.Second)
+
+	for _, want := range []time.Duration{100, 200, 400, 800, 1000, 1000} {
+		want *= time.Millisecond
+
+		delay := b.delay()
+		assert.GreaterOrEqual(t, delay, want/2)
+		assert.LessOrEqual(t, delay, want)
+	}
+}
+
+// restartTestServer starts a server on the address of a stopped one.
+func restartTestServer(t *testing.T, addr string, handler MessageHandler) *server {
+	t.Helper()
+
+	srv := NewServer(ServerConfig{ListenAddr: addr, MaxMessageSize: 1024 * 1024, MaxConnections: 10}, zerolog.Nop()).(*server)
+	srv.SetHandler(handler)
+	require.NoError(t, srv.Start(context.Background()))
+	t.Cleanup(func() { _ = srv.Stop(context.Background()) })
+	return srv
+}
+
+func recordStates(c Client) <-chan ClientState {
+	states := make(chan ClientState, 16)
+	c.SetStateHandler(func(state ClientState, _ error) { states <- state })
+	return states
+}
+
+func waitForState(t *testing.T, states <-chan ClientState, want ClientState) {
+	t.Helper()
+
+	select {
+	case got := <-states:
+		require.Equal(t, want, got)
+	case <-time.After(5 * time.Second):
+		t.Fatalf("client did not become %s", want)
+	}
+}
+
+func TestClient_Reconnects(t *testing.T) {
+	t.Parallel()
+
+	srv, addr := startTestServer(t, ServerConfig{})
+
+	c := NewClient(ClientConfig{
+		ServerAddr:     addr,
+		ConnectTimeout: time.Second,
+		MaxMessageSize: 1024 * 1024,
+		ChainID:        []byte{0x01},
+		ReconnectDelay: 10 * time.Millisecond,
+	}, zerolog.Nop(), WithAutoReconnect(50*time.Millisecond, 8))
+	states := recordStates(c)
+
+	require.NoError(t, c.Connect(context.Background()))
+	defer c.Disconnect(context.Background())
+	waitForState(t, states, StateConnected)
+	firstConn := c.ServerInfo().ConnectionID
+
+	// Sends while the publisher is down are queued, and fail once the queue is full
+	require.NoError(t, srv.Stop(context.Background()))
+	waitForState(t, states, StateReconnecting)
+	assert.False(t, c.IsConnected())
+
+	for i := 0; i < 8; i++ {
+		vote := &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{XtId: &pb.XtID{Hash: []byte{byte(i)}}}}}
+		require.NoError(t, c.Send(context.Background(), vote))
+	}
+	assert.ErrorIs(t, c.Send(context.Background(), &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{}}}), ErrSendQueueFull)
+
+	received := make(chan *pb.Message, 8)
+	restartTestServer(t, addr, func(_ context.Context, _ string, msg *pb.Message) error {
+		received <- msg
+		return nil
+	})
+
+	waitForState(t, states, StateConnected)
+	assert.NotEqual(t, firstConn, c.ServerInfo().ConnectionID, "handshake is run again")
+
+	for i := 0; i < 8; i++ {
+		select {
+		case msg := <-received:
+			assert.Equal(t, []byte{byte(i)}, msg.GetVote().GetXtId().GetHash(), "queued messages keep their order")
+		case <-time.After(5 * time.Second):
+			t.Fatalf("queued message %d not delivered", i)
+		}
+	}
+
+	require.NoError(t, c.Disconnect(context.Background()))
+	waitForState(t, states, StateDisconnected)
+}
+
+func TestClient_ReportsLostConnection(t *testing.T) {
+	t.Parallel()
+
+	srv, addr := startTestServer(t, ServerConfig{})
+
+	c := NewClient(ClientConfig{
+		ServerAddr:     addr,
+		ConnectTimeout: time.Second,
+		MaxMessageSize: 1024 * 1024,
+		ChainID:        []byte{0x01},
+	}, zerolog.Nop())
+	states := recordStates(c)
+
+	require.NoError(t, c.Connect(context.Background()))
+	waitForState(t, states, StateConnected)
+
+	require.NoError(t, srv.Stop(context.Background()))
+	waitForState(t, states, StateDisconnected)
+
+	// Without AutoReconnect the client stays down until connected again
+	assert.ErrorIs(t, c.Send(context.Background(), &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{}}}), ErrNotConnected)
+	assert.ErrorIs(t, c.Disconnect(context.Background()), ErrNotConnected)
+
+	restartTestServer(t, addr, nil)
+	require.NoError(t, c.Connect(context.Background()))
+	defer c.Disconnect(context.Background())
+	waitForState(t, states, StateConnected)
+}
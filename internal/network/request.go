@@ -0,0 +1,76 @@
+package network
+
+import (
+	"sync"
+	"time"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// DefaultRequestTimeout bounds a request whose context has no deadline.
+const DefaultRequestTimeout = 10 * time.Second
+
+// pendingRequests matches replies to the requests waiting for them by
+// correlation ID.
+type pendingRequests struct {
+	mu      sync.Mutex
+	next    uint64
+	waiting map[uint64]chan *pb.Message
+}
+
+// add registers a new request and returns its correlation ID and the channel
+// its reply is delivered on. The channel is closed if the connection is lost.
+func (p *pendingRequests) add() (uint64, <-chan *pb.Message) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.waiting == nil {
+		p.waiting = make(map[uint64]chan *pb.Message)
+	}
+
+	p.next++
+	ch := make(chan *pb.Message, 1)
+	p.waiting[p.next] = ch
+
+	return p.next, ch
+}
+
+// remove forgets a request that stopped waiting.
+func (p *pendingRequests) remove(id uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.waiting, id)
+}
+
+// resolve delivers a reply to its request. It returns false if no request
+// waits for it, e.g. because the request already timed out.
+func (p *pendingRequests) resolve(reply *pb.Message) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	ch, ok := p.waiting[reply.ReplyTo]
+	if !ok {
+		return false
+	}
+	delete(p.waiting, reply.ReplyTo)
+	ch <- reply
+
+	return true
+}
+
+// failAll releases every waiting request after the connection was lost.
+func (p *pendingRequests) failAll() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for id, ch := range p.waiting {
+		close(ch)
+		delete(p.waiting, id)
+	}
+}
+
+// newReply addresses reply to the request it answers.
+func newReply(request, reply *pb.Message) *pb.Message {
+	reply.ReplyTo = request.CorrelationId
+	return reply
+}
@@ -0,0 +1,115 @@
+package network
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+func TestClient_Request(t *testing.T) {
+	t.Parallel()
+
+	const (
+		answer = iota + 1
+		ignore
+		hangUp
+	)
+
+	srv, addr := startTestServer(t, ServerConfig{})
+	srv.SetHandler(func(ctx context.Context, from string, msg *pb.Message) error {
+		switch msg.GetVote().GetSenderChainId()[0] {
+		case answer:
+			// An unsolicited message first, then the reply
+			if err := srv.Send(ctx, from, &pb.Message{Payload: &pb.Message_Decided{Decided: &pb.Decided{}}}); err != nil {
+				return err
+			}
+			return srv.Reply(ctx, from, msg, &pb.Message{Payload: &pb.Message_Ack{Ack: &pb.Ack{}}})
+		case hangUp:
+			conn, _ := srv.connections.Load(from)
+			return conn.(Connection).Close()
+		}
+		return nil
+	})
+
+	newVote := func(behaviour byte) *pb.Message {
+		return &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{SenderChainId: []byte{behaviour}}}}
+	}
+
+	connect := func(t *testing.T) (Client, <-chan *pb.Message) {
+		t.Helper()
+
+		c := NewClient(ClientConfig{
+			ServerAddr:     addr,
+			ConnectTimeout: time.Second,
+			MaxMessageSize: 1024 * 1024,
+			RequestTimeout: 50 * time.Millisecond,
+			ChainID:        []byte{0x01},
+		}, zerolog.Nop())
+
+		handled := make(chan *pb.Message, 10)
+		c.SetHandler(func(_ context.Context, _ string, msg *pb.Message) error {
+			handled <- msg
+			return nil
+		})
+
+		require.NoError(t, c.Connect(context.Background()))
+		t.Cleanup(func() { _ = c.Disconnect(context.Background()) })
+
+		return c, handled
+	}
+
+	t.Run("returns the reply and hands other messages to the handler", func(t *testing.T) {
+		t.Parallel()
+
+		c, handled := connect(t)
+
+		for i := 0; i < 3; i++ {
+			reply, err := c.Request(context.Background(), newVote(answer))
+			require.NoError(t, err)
+			assert.NotNil(t, reply.GetAck())
+			assert.NotZero(t, reply.ReplyTo)
+		}
+
+		require.Eventually(t, func() bool { return len(handled) == 3 }, time.Second, 5*time.Millisecond)
+		for len(handled) > 0 {
+			msg := <-handled
+			assert.NotNil(t, msg.GetDecided())
+			assert.Zero(t, msg.ReplyTo)
+		}
+	})
+
+	t.Run("times out without a reply", func(t *testing.T) {
+		t.Parallel()
+
+		c, handled := connect(t)
+
+		_, err := c.Request(context.Background(), newVote(ignore))
+		assert.ErrorIs(t, err, ErrRequestTimeout)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		_, err = c.Request(ctx, newVote(ignore))
+		assert.ErrorIs(t, err, context.Canceled)
+		assert.NotErrorIs(t, err, ErrRequestTimeout)
+
+		assert.Empty(t, handled)
+	})
+
+	t.Run("fails when the connection is lost", func(t *testing.T) {
+		t.Parallel()
+
+		c, _ := connect(t)
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+
+		_, err := c.Request(ctx, newVote(hangUp))
+		assert.ErrorIs(t, err, ErrNotConnected)
+	})
+}
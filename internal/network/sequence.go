@@ -0,0 +1,50 @@
+package network
+
+import (
+	"fmt"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// sequenceTracker checks the message stream of a publisher connection for
+// gaps and reordering. Messages with a zero sequence number are not part of
+// the stream.
+type sequenceTracker struct {
+	epoch uint64
+	last  uint64
+}
+
+// restart starts tracking the stream of a new connection. Sequences start
+// over per connection, while an epoch older than the last one seen is still
+// reported as stale.
+func (t *sequenceTracker) restart() {
+	t.last = 0
+}
+
+// check reports whether msg should be delivered and an error describing any
+// anomaly. Gapped messages are delivered; duplicates, reordered messages and
+// messages from an older epoch are not.
+func (t *sequenceTracker) check(msg *pb.Message) (bool, error) {
+	if msg.Sequence == 0 {
+		return true, nil
+	}
+
+	switch {
+	case msg.Epoch > t.epoch:
+		// First message seen, or the publisher restarted with a new epoch
+		t.epoch = msg.Epoch
+		t.last = msg.Sequence
+		return true, nil
+	case msg.Epoch < t.epoch:
+		return false, fmt.Errorf("%w: got %d, current %d", ErrStaleEpoch, msg.Epoch, t.epoch)
+	case msg.Sequence <= t.last:
+		return false, fmt.Errorf("%w: got %d after %d", ErrSequenceReordered, msg.Sequence, t.last)
+	case msg.Sequence > t.last+1:
+		expected := t.last + 1
+		t.last = msg.Sequence
+		return true, fmt.Errorf("%w: expected %d, got %d", ErrSequenceGap, expected, msg.Sequence)
+	default:
+		t.last = msg.Sequence
+		return true, nil
+	}
+}
@@ -0,0 +1,97 @@
+package network
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+func TestSequenceTracker(t *testing.T) {
+	t.Parallel()
+
+	type step struct {
+		epoch, sequence uint64
+		deliver         bool
+		err             error
+		restart         bool // A new connection starts before the message
+	}
+
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "in order",
+			steps: []step{
+				{epoch: 1, sequence: 5, deliver: true},
+				{epoch: 1, sequence: 6, deliver: true},
+				{epoch: 1, sequence: 7, deliver: true},
+			},
+		},
+		{
+			name: "unsequenced messages are ignored",
+			steps: []step{
+				{epoch: 1, sequence: 1, deliver: true},
+				{deliver: true},
+				{epoch: 1, sequence: 2, deliver: true},
+			},
+		},
+		{
+			name: "gap is delivered and reported",
+			steps: []step{
+				{epoch: 1, sequence: 1, deliver: true},
+				{epoch: 1, sequence: 4, deliver: true, err: ErrSequenceGap},
+				{epoch: 1, sequence: 5, deliver: true},
+			},
+		},
+		{
+			name: "duplicates and reordering are dropped",
+			steps: []step{
+				{epoch: 1, sequence: 1, deliver: true},
+				{epoch: 1, sequence: 3, deliver: true, err: ErrSequenceGap},
+				{epoch: 1, sequence: 2, err: ErrSequenceReordered},
+				{epoch: 1, sequence: 3, err: ErrSequenceReordered},
+			},
+		},
+		{
+			name: "new epoch restarts the sequence",
+			steps: []step{
+				{epoch: 1, sequence: 9, deliver: true},
+				{epoch: 2, sequence: 1, deliver: true},
+				{epoch: 1, sequence: 10, err: ErrStaleEpoch},
+				{epoch: 2, sequence: 2, deliver: true},
+			},
+		},
+		{
+			name: "new connection restarts the sequence, not the epoch",
+			steps: []step{
+				{epoch: 2, sequence: 5, deliver: true},
+				{epoch: 2, sequence: 1, deliver: true, restart: true},
+				{epoch: 2, sequence: 2, deliver: true},
+				{epoch: 1, sequence: 1, err: ErrStaleEpoch, restart: true},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			var tracker sequenceTracker
+			for i, s := range tt.steps {
+				if s.restart {
+					tracker.restart()
+				}
+				deliver, err := tracker.check(&pb.Message{Epoch: s.epoch, Sequence: s.sequence})
+				assert.Equal(t, s.deliver, deliver, "step %d", i)
+				if s.err != nil {
+					assert.ErrorIs(t, err, s.err, "step %d", i)
+				} else {
+					assert.NoError(t, err, "step %d", i)
+				}
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package network
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
 	"net"
@@ -12,39 +14,105 @@ import (
 	"github.com/google/uuid"
 	"github.com/rs/zerolog"
 
+	"github.com/kchojn/poc-shared-publisher/internal/auth"
 	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/pkg/metrics"
 )
 
 // ServerConfig contains server configuration.
 type ServerConfig struct {
-	ListenAddr     string
-	ReadTimeout    time.Duration
+	// ListenAddr is the address to listen on. Its scheme selects the
+	// transport: tcp:// (the default without a scheme), unix:// or mem://.
+	ListenAddr string
+	// Transport listens instead of the transport of the ListenAddr scheme
+	Transport   Transport
+	ReadTimeout time.Duration
+	// WriteTimeout bounds writing each message. A connection whose write
+	// does not complete in time is closed. Zero waits forever.
 	WriteTimeout   time.Duration
 	MaxMessageSize int
+	// MaxConnections bounds open connections, including those still in the
+	// handshake. Zero allows any number.
 	MaxConnections int
+	// SendQueueSize bounds the messages waiting to be written per connection.
+	// SendQueuePolicy decides what happens when it is full. Zero values use
+	// DefaultOutboundQueueSize and QueueDisconnect.
+	SendQueueSize   int
+	SendQueuePolicy QueuePolicy
+	// HandshakeTimeout bounds the time a new connection has to send its Hello.
+	// Zero uses DefaultHandshakeTimeout.
+	HandshakeTimeout time.Duration
+	// TLS serves connections over TLS when set. With ClientAuth requiring
+	// verified certificates, clients authenticate with mutual TLS.
+	TLS *tls.Config
+	// ClientChains maps client certificate identities (common name, or first
+	// DNS name) to the chain ID each may announce in its Hello, e.g. "0x01".
+	// Connections with other identities or chains are closed. Empty allows
+	// any chain.
+	ClientChains map[string]string
+	// Keyring, when set, requires every Hello to be signed by an allowlisted
+	// key of the chain it announces, so a connection cannot claim another
+	// chain's xTs. Unsigned Hellos are refused.
+	Keyring *auth.Keyring
+	// LegacyFraming also accepts peers that frame messages with a bare length
+	// prefix instead of the frame header. The framing is detected per connection.
+	LegacyFraming bool
+	// Capabilities lists the optional features the server can enable
+	Capabilities []string
+	// MessageTypes lists the payloads the handler accepts, by Message field name.
+	// Other payloads are answered with UnsupportedPayload. Empty accepts every known payload.
+	MessageTypes []string
+	// HeartbeatInterval is the time between Pings to each connection. Connections
+	// that answer heartbeats are closed after MaxMissedHeartbeats unanswered
+	// Pings instead of on ReadTimeout. Zero disables heartbeats.
+	HeartbeatInterval   time.Duration
+	MaxMissedHeartbeats int
+	// ReconnectHint is the reconnect delay suggested to clients in the GoAway
+	// sent on Stop. Zero leaves the delay to the clients.
+	ReconnectHint time.Duration
+	// Epoch is stamped, with a per-connection sequence number, on every message
+	// sent with Send, Reply or Broadcast. Zero uses the start time in
+	// milliseconds, so a restarted publisher always starts a newer epoch.
+	Epoch uint64
 }
 
+const serverSenderID = "publisher"
+
 // server implements the Server interface
 type server struct {
-	cfg      ServerConfig
-	listener net.Listener
-	handler  MessageHandler
-	codec    *Codec
-	log      zerolog.Logger
-
-	connections sync.Map // map[string]Connection
-	writers     sync.Map // map[string]*StreamWriter
-
-	running atomic.Bool
-	wg      sync.WaitGroup
+	cfg          ServerConfig
+	listener     net.Listener
+	handler      MessageHandler
+	onConnect    ConnectHandler
+	onDisconnect DisconnectHandler
+	codec        *Codec
+	legacyCodec  *Codec
+	log          zerolog.Logger
+
+	connections sync.Map     // map[string]Connection
+	writers     sync.Map     // map[string]*outbound
+	accepted    atomic.Int64 // Open connections, including those still in the handshake
+
+	// Broadcasts are queued one at a time, so every connection sees them in the same order
+	broadcastMu sync.Mutex
+	epoch       uint64
+
+	running  atomic.Bool
+	draining atomic.Bool
+	wg       sync.WaitGroup
 }
 
 // NewServer creates a new server instance.
-func NewServer(cfg ServerConfig, log zerolog.Logger) Server {
+func NewServer(cfg ServerConfig, log zerolog.Logger, opts ...ServerOption) Server {
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
 	return &server{
-		cfg:   cfg,
-		codec: NewCodec(cfg.MaxMessageSize),
-		log:   log.With().Str("component", "server").Logger(),
+		cfg:         cfg,
+		codec:       NewCodec(cfg.MaxMessageSize),
+		legacyCodec: NewLegacyCodec(cfg.MaxMessageSize),
+		log:         log.With().Str("component", "server").Logger(),
 	}
 }
 
@@ -54,16 +122,30 @@ func (s *server) Start(ctx context.Context) error {
 		return ErrServerRunning
 	}
 
-	listener, err := net.Listen("tcp", s.cfg.ListenAddr)
+	transport, address, err := resolveTransport(s.cfg.ListenAddr, s.cfg.Transport)
+	if err != nil {
+		s.running.Store(false)
+		return err
+	}
+
+	listener, err := transport.Listen(address)
 	if err != nil {
 		s.running.Store(false)
 		return fmt.Errorf("failed to listen: %w", err)
 	}
 	s.listener = listener
+	s.draining.Store(false)
+
+	s.epoch = s.cfg.Epoch
+	if s.epoch == 0 {
+		s.epoch = uint64(time.Now().UnixMilli())
+	}
 
 	s.log.Info().
 		Str("addr", s.cfg.ListenAddr).
+		Bool("tls", s.cfg.TLS != nil).
 		Int("max_connections", s.cfg.MaxConnections).
+		Uint64("epoch", s.epoch).
 		Msg("Server started")
 
 	s.wg.Add(1)
@@ -72,7 +154,10 @@ func (s *server) Start(ctx context.Context) error {
 	return nil
 }
 
-// Stop gracefully stops the server.
+// Stop gracefully stops the server. It stops accepting connections, sends
+// every client a GoAway and stops reading from it. A connection is closed
+// once the message being handled is done and its queued messages are
+// written. Connections still open when ctx is done are closed right away.
 func (s *server) Stop(ctx context.Context) error {
 	if !s.running.CompareAndSwap(true, false) {
 		return ErrServerNotRunning
@@ -85,10 +170,11 @@ func (s *server) Stop(ctx context.Context) error {
 		s.log.Error().Err(err).Msg("Failed to close listener")
 	}
 
-	// Close all connections
+	// Connections completing the handshake from now on drain themselves
+	s.draining.Store(true)
 	s.connections.Range(func(key, value interface{}) bool {
-		if conn, ok := value.(Connection); ok {
-			conn.Close()
+		if out, ok := s.writers.Load(key); ok {
+			s.drainConn(value.(*conn), out.(*outbound))
 		}
 		return true
 	})
@@ -104,7 +190,13 @@ func (s *server) Stop(ctx context.Context) error {
 	case <-done:
 		s.log.Info().Msg("Server stopped gracefully")
 	case <-ctx.Done():
-		s.log.Warn().Msg("Server stop timeout")
+		s.log.Warn().Msg("Server stop timeout, closing connections")
+		s.connections.Range(func(key, value interface{}) bool {
+			if conn, ok := value.(Connection); ok {
+				conn.Close()
+			}
+			return true
+		})
 		return ctx.Err()
 	}
 
@@ -116,6 +208,16 @@ func (s *server) SetHandler(handler MessageHandler) {
 	s.handler = handler
 }
 
+// SetConnectHandler sets the handler called when a connection is accepted.
+func (s *server) SetConnectHandler(handler ConnectHandler) {
+	s.onConnect = handler
+}
+
+// SetDisconnectHandler sets the handler called when a connection closes.
+func (s *server) SetDisconnectHandler(handler DisconnectHandler) {
+	s.onDisconnect = handler
+}
+
 // acceptLoop accepts new connections.
 func (s *server) acceptLoop(ctx context.Context) {
 	defer s.wg.Done()
@@ -125,8 +227,10 @@ func (s *server) acceptLoop(ctx context.Context) {
 		case <-ctx.Done():
 			return
 		default:
-			// Accept with timeout
-			s.listener.(*net.TCPListener).SetDeadline(time.Now().Add(time.Second))
+			// Accept with timeout, so ctx is checked every second
+			if l, ok := s.listener.(deadlineListener); ok {
+				_ = l.SetDeadline(time.Now().Add(time.Second))
+			}
 
 			netConn, err := s.listener.Accept()
 			if err != nil {
@@ -139,22 +243,18 @@ func (s *server) acceptLoop(ctx context.Context) {
 				return
 			}
 
-			// Check connection limit
-			connCount := 0
-			s.connections.Range(func(_, _ interface{}) bool {
-				connCount++
-				return true
-			})
-
-			if s.cfg.MaxConnections > 0 && connCount >= s.cfg.MaxConnections {
+			// Check connection limit, counting connections still in the handshake
+			connCount := s.accepted.Load()
+			if s.cfg.MaxConnections > 0 && connCount >= int64(s.cfg.MaxConnections) {
 				s.log.Warn().
-					Int("current", connCount).
+					Int64("current", connCount).
 					Int("max", s.cfg.MaxConnections).
 					Msg(ErrConnectionLimit.Error())
 				netConn.Close()
 				continue
 			}
 
+			s.accepted.Add(1)
 			s.wg.Add(1)
 			go s.handleConnection(ctx, netConn)
 		}
@@ -164,43 +264,181 @@ func (s *server) acceptLoop(ctx context.Context) {
 // handleConnection handles a client connection.
 func (s *server) handleConnection(ctx context.Context, netConn net.Conn) {
 	defer s.wg.Done()
+	defer s.accepted.Add(-1)
 
 	// Generate connection ID
 	connID := uuid.New().String()
-	conn := NewConnection(netConn, connID)
 
 	log := s.log.With().
 		Str("conn_id", connID).
 		Str("remote_addr", netConn.RemoteAddr().String()).
 		Logger()
 
+	var identity string
+	if s.cfg.TLS != nil {
+		tlsConn, err := serverTLSHandshake(ctx, netConn, s.cfg.TLS, s.cfg.HandshakeTimeout)
+		if err != nil {
+			logRejection(log, err)
+			netConn.Close()
+			return
+		}
+		netConn = tlsConn
+		identity = peerIdentity(tlsConn.ConnectionState())
+		if identity != "" {
+			log = log.With().Str("identity", identity).Logger()
+		}
+	}
+
+	codec := s.codec
+	if s.cfg.LegacyFraming {
+		replayed, legacy, err := detectFraming(netConn, s.cfg.MaxMessageSize, s.cfg.HandshakeTimeout)
+		if err != nil {
+			logRejection(log, err)
+			netConn.Close()
+			return
+		}
+		netConn = replayed
+		if legacy {
+			codec = s.legacyCodec
+			log = log.With().Bool("legacy_framing", true).Logger()
+		}
+	}
+
+	conn := newConn(netConn, connID)
+	conn.setIdentity(identity)
+	writer := NewStreamWriter(conn, codec)
+
+	// The Hello/Welcome handshake must complete before the connection is used
+	hello, err := acceptHello(conn, codec, s.cfg.Keyring, s.cfg.HandshakeTimeout)
+	if err != nil {
+		logRejection(log, err)
+		writer.Close()
+		conn.Close()
+		return
+	}
+
+	if err := s.authorizeChain(identity, hello.ChainId); err != nil {
+		logRejection(log, fmt.Errorf("%w: %w", ErrHandshakeFailed, err))
+		writer.Close()
+		conn.Close()
+		return
+	}
+
+	version := negotiateVersion(hello.ProtocolVersion)
+	capabilities := negotiateCapabilities(hello.Capabilities, s.cfg.Capabilities)
+	conn.setPeer(pb.FormatChainID(hello.ChainId), hello.Name, version, capabilities)
+
+	welcome := &pb.Message{
+		SenderId: serverSenderID,
+		Version:  ProtocolVersion,
+		Payload: &pb.Message_Welcome{Welcome: &pb.Welcome{
+			ConnectionId:    connID,
+			ProtocolVersion: version,
+			Capabilities:    capabilities,
+			MessageTypes:    s.cfg.MessageTypes,
+		}},
+	}
+	if err := writer.Write(welcome); err != nil {
+		log.Warn().Err(err).Msg("Failed to send Welcome")
+		writer.Close()
+		conn.Close()
+		return
+	}
+
+	if hasCapability(capabilities, CapabilityDeflate) {
+		writer.EnableCompression()
+	}
+
+	// From here on all writes go through the outbound queue
+	out := newOutbound(connID, conn, writer, s.cfg.SendQueueSize, s.cfg.SendQueuePolicy, s.cfg.WriteTimeout, log)
+	conn.setOutbound(out)
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		out.run()
+	}()
+
+	log = log.With().
+		Str("chain_id", conn.GetInfo().ChainID).
+		Str("name", hello.Name).
+		Logger()
+
 	// Store connection
 	s.connections.Store(connID, conn)
-	writer := NewStreamWriter(conn, s.codec)
-	s.writers.Store(connID, writer)
+	s.writers.Store(connID, out)
 
 	defer func() {
+		if conn.readingStopped() {
+			out.drain() // Replies to the last message and the GoAway
+		}
 		conn.Close()
 		s.connections.Delete(connID)
 		s.writers.Delete(connID)
-		writer.Close()
+		out.close()
+		metrics.ConnectionRTT.DeleteLabelValues(connID)
 		log.Info().Msg("Connection closed")
+
+		if s.onDisconnect != nil {
+			s.onDisconnect(conn.GetInfo())
+		}
 	}()
 
 	log.Info().Msg("New connection")
 
+	// Stop may have missed a connection stored while it was draining the others
+	if s.draining.Load() {
+		s.drainConn(conn, out)
+	}
+
+	// Peers that answer heartbeats are judged by missed Pongs, not by read deadlines
+	var hb *heartbeat
+	if s.cfg.HeartbeatInterval > 0 && version >= heartbeatVersion {
+		hb = newHeartbeat(s.cfg.HeartbeatInterval, s.cfg.MaxMissedHeartbeats)
+		conn.setHeartbeat(hb)
+
+		hbCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		go hb.run(hbCtx, func(msg *pb.Message) error {
+			msg.SenderId = serverSenderID
+			msg.Version = ProtocolVersion
+			return out.send(msg)
+		}, func(missed int, err error) {
+			log.Warn().Err(err).Int("missed", missed).Msg("Heartbeat failed, closing connection")
+			conn.Close()
+		})
+	}
+
+	if s.onConnect != nil {
+		s.onConnect(conn.GetInfo())
+	}
+
+	reader := codec.acquireReader(conn)
+	defer codec.releaseReader(reader)
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		default:
-			if s.cfg.ReadTimeout > 0 {
+			if s.cfg.ReadTimeout > 0 && hb == nil {
 				_ = conn.SetReadDeadline(time.Now().Add(s.cfg.ReadTimeout))
 			}
 
 			var msg pb.Message
-			if err := s.codec.Decode(conn, &msg); err != nil {
-				if err == io.EOF {
+			if err := codec.Decode(reader, &msg); err != nil {
+				if reason := frameErrorReason(err); reason != "" {
+					metrics.FramesCorrupted.WithLabelValues(reason).Inc()
+				}
+				if errors.Is(err, ErrCorruptFrame) {
+					log.Warn().Err(err).Msg("Dropping corrupt frame")
+					continue
+				}
+
+				if conn.readingStopped() {
+					log.Debug().Msg("Stopped reading for shutdown")
+				} else if err == io.EOF {
 					log.Debug().Msg("Client disconnected")
 				} else if ne, ok := err.(net.Error); ok && ne.Timeout() {
 					log.Debug().Msg("Read timeout")
@@ -212,6 +450,29 @@ func (s *server) handleConnection(ctx context.Context, netConn net.Conn) {
 
 			conn.UpdateLastSeen()
 
+			switch payload := msg.Payload.(type) {
+			case *pb.Message_Ping:
+				pong := newPongMessage(payload.Ping)
+				pong.SenderId = serverSenderID
+				pong.Version = ProtocolVersion
+				if err := out.send(pong); err != nil {
+					log.Error().Err(err).Msg("Failed to answer Ping")
+				}
+				continue
+			case *pb.Message_Pong:
+				if hb != nil {
+					if rtt, ok := hb.pong(payload.Pong, time.Now()); ok {
+						metrics.ConnectionRTT.WithLabelValues(connID).Set(rtt.Seconds())
+					}
+				}
+				continue
+			}
+
+			if !supportsPayload(s.cfg.MessageTypes, PayloadType(&msg)) {
+				s.rejectPayload(conn, out, &msg, log)
+				continue
+			}
+
 			if s.handler != nil {
 				if err := s.handler(ctx, connID, &msg); err != nil {
 					log.Error().Err(err).Msg("Handler error")
@@ -221,71 +482,114 @@ func (s *server) handleConnection(ctx context.Context, netConn net.Conn) {
 	}
 }
 
-// Broadcast sends a message to all clients except excluded.
+// logRejection logs why a new connection was closed before the handshake completed.
+func logRejection(log zerolog.Logger, err error) {
+	if errors.Is(err, ErrNotProtocol) {
+		log.Warn().Err(err).Msg("Rejecting non-protocol peer")
+		return
+	}
+	log.Warn().Err(err).Msg("Rejecting connection")
+}
+
+// rejectPayload answers a payload the handler does not accept. Peers from
+// before version 2 do not know UnsupportedPayload and get no reply.
+func (s *server) rejectPayload(conn *conn, out *outbound, msg *pb.Message, log zerolog.Logger) {
+	reply := newReply(msg, newUnsupportedMessage(msg))
+	metrics.MessagesUnsupported.WithLabelValues(payloadLabel(reply.GetUnsupported())).Inc()
+
+	log.Warn().
+		Uint32("field", reply.GetUnsupported().Field).
+		Str("type", reply.GetUnsupported().Type).
+		Uint32("version", msg.Version).
+		Msg("Unsupported payload")
+
+	// Never answer an UnsupportedPayload, so two peers cannot loop
+	if msg.GetUnsupported() != nil || conn.GetInfo().ProtocolVersion < unsupportedReplyVersion {
+		return
+	}
+
+	reply.Version = ProtocolVersion
+	if err := out.send(reply); err != nil {
+		log.Error().Err(err).Msg("Failed to reply to unsupported payload")
+	}
+}
+
+// Broadcast queues a message for all clients except excluded. It does not
+// wait for the messages to be written, so a slow client delays no one else.
+// Each client gets the message at the next position of its own stream.
 func (s *server) Broadcast(ctx context.Context, msg *pb.Message, excludeID string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.broadcastMu.Lock()
+	defer s.broadcastMu.Unlock()
+
+	// Marshalled once, framed once per framing in use, shared by all connections
+	frames, err := s.newFrames(msg)
+	if err != nil {
+		return err
+	}
+
 	var (
-		wg      sync.WaitGroup
-		errChan = make(chan error, 1)
-		sent    atomic.Int32
+		firstErr error
+		sent     int
 	)
-
 	s.writers.Range(func(key, value interface{}) bool {
 		connID := key.(string)
-		writer := value.(*StreamWriter)
-
 		if connID == excludeID {
 			return true
 		}
 
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-
-			if err := writer.Write(msg); err != nil {
-				s.log.Error().
-					Str("conn_id", connID).
-					Err(err).
-					Msg("Broadcast write error")
-				select {
-				case errChan <- err:
-				default:
-				}
-			} else {
-				sent.Add(1)
+		out := value.(*outbound)
+		if err := out.sendStamped(frames, s.epoch); err != nil {
+			s.log.Error().
+				Str("conn_id", connID).
+				Err(err).
+				Msg("Broadcast write error")
+			if firstErr == nil {
+				firstErr = err
 			}
-		}()
-
+			return true
+		}
+		sent++
 		return true
 	})
 
-	done := make(chan struct{})
-	go func() {
-		wg.Wait()
-		close(done)
-	}()
-
-	select {
-	case <-done:
-		s.log.Debug().
-			Int32("sent", sent.Load()).
-			Msg("Broadcast complete")
-	case <-ctx.Done():
-		return ctx.Err()
-	case err := <-errChan:
-		return err
-	}
+	s.log.Debug().
+		Str("type", PayloadType(msg)).
+		Int("sent", sent).
+		Msg("Broadcast queued")
 
-	return nil
+	return firstErr
 }
 
-// Send sends a message to a specific client.
+// Send queues a message for a specific client.
 func (s *server) Send(_ context.Context, clientID string, msg *pb.Message) error {
-	writer, ok := s.writers.Load(clientID)
+	out, ok := s.writers.Load(clientID)
 	if !ok {
 		return fmt.Errorf("client %s not found", clientID)
 	}
 
-	return writer.(*StreamWriter).Write(msg)
+	frames, err := s.newFrames(msg)
+	if err != nil {
+		return err
+	}
+
+	return out.(*outbound).sendStamped(frames, s.epoch)
+}
+
+// newFrames prepares a message for the connection streams. The epoch and
+// sequence are stamped per connection.
+func (s *server) newFrames(msg *pb.Message) (*sharedFrames, error) {
+	msg.Version = ProtocolVersion
+	msg.Epoch, msg.Sequence = 0, 0
+	return newSharedFrames(s.codec, msg)
+}
+
+// Reply answers a request from a specific client.
+func (s *server) Reply(ctx context.Context, clientID string, request, reply *pb.Message) error {
+	return s.Send(ctx, clientID, newReply(request, reply))
 }
 
 // GetConnections returns all active connections.
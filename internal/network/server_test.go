@@ -0,0 +1,563 @@
+package network
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kchojn/poc-shared-publisher/internal/auth"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// startTestServer starts a server on a free local port and returns its address.
+func startTestServer(t *testing.T, cfg ServerConfig, opts ...ServerOption) (*server, string) {
+	t.Helper()
+
+	cfg.ListenAddr = "127.0.0.1:0"
+	if cfg.MaxMessageSize == 0 {
+		cfg.MaxMessageSize = 1024 * 1024
+	}
+	if cfg.MaxConnections == 0 {
+		cfg.MaxConnections = 10
+	}
+
+	srv := NewServer(cfg, zerolog.Nop(), opts...).(*server)
+	require.NoError(t, srv.Start(context.Background()))
+	t.Cleanup(func() { _ = srv.Stop(context.Background()) })
+
+	return srv, srv.listener.Addr().String()
+}
+
+func TestServer_Handshake(t *testing.T) {
+	t.Parallel()
+
+	srv, addr := startTestServer(t, ServerConfig{Capabilities: []string{"a"}})
+
+	connected := make(chan ConnectionInfo, 1)
+	srv.SetConnectHandler(func(info ConnectionInfo) { connected <- info })
+
+	c := NewClient(ClientConfig{
+		ServerAddr:     addr,
+		ConnectTimeout: time.Second,
+		MaxMessageSize: 1024 * 1024,
+		ChainID:        []byte{0xab, 0x01},
+		Name:           "seq-ab",
+		Capabilities:   []string{"b", "a"},
+	}, zerolog.Nop())
+	require.NoError(t, c.Connect(context.Background()))
+	defer c.Disconnect(context.Background())
+
+	select {
+	case info := <-connected:
+		assert.Equal(t, "0xab01", info.ChainID)
+		assert.Equal(t, "seq-ab", info.Name)
+		assert.Equal(t, ProtocolVersion, info.ProtocolVersion)
+		assert.Equal(t, []string{"a"}, info.Capabilities)
+	case <-time.After(time.Second):
+		t.Fatal("connect handler not called")
+	}
+
+	conns := srv.GetConnections()
+	require.Len(t, conns, 1)
+	assert.Equal(t, "0xab01", conns[0].ChainID)
+}
+
+func TestServer_RequiresSignedHello(t *testing.T) {
+	t.Parallel()
+
+	pubA, keyA, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	pubB, keyB, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	keyring, err := auth.NewKeyring(map[string][]string{
+		"0x01": {hex.EncodeToString(pubA)},
+		"0x02": {hex.EncodeToString(pubB)},
+	})
+	require.NoError(t, err)
+
+	srv, addr := startTestServer(t, ServerConfig{Keyring: keyring})
+
+	tests := []struct {
+		name   string
+		signer *auth.Signer
+		wantOK bool
+	}{
+		{name: "signed by its chain", signer: auth.NewSigner([]byte{0x01}, keyA), wantOK: true},
+		{name: "unsigned"},
+		{name: "signed by another chain", signer: auth.NewSigner([]byte{0x02}, keyB)},
+		{name: "signed with another chain's key", signer: auth.NewSigner([]byte{0x01}, keyB)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewClient(ClientConfig{
+				ServerAddr:     addr,
+				ConnectTimeout: time.Second,
+				MaxMessageSize: 1024 * 1024,
+				ChainID:        []byte{0x01},
+				Signer:         tt.signer,
+			}, zerolog.Nop())
+
+			err := c.Connect(context.Background())
+			if !tt.wantOK {
+				require.ErrorIs(t, err, ErrHandshakeFailed)
+				return
+			}
+			require.NoError(t, err)
+			defer c.Disconnect(context.Background())
+
+			require.Eventually(t, func() bool { return len(srv.GetConnections()) == 1 }, time.Second, time.Millisecond)
+			assert.Equal(t, "0x01", srv.GetConnections()[0].ChainID)
+		})
+	}
+}
+
+func TestServer_RejectsFailedHandshake(t *testing.T) {
+	t.Parallel()
+
+	codec := NewCodec(1024 * 1024)
+
+	tests := []struct {
+		name  string
+		hello *pb.Message // nil sends nothing
+	}{
+		{
+			name: "no hello",
+		},
+		{
+			name: "other message first",
+			hello: &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{
+				SenderChainId: []byte{0x01},
+			}}},
+		},
+		{
+			name: "missing chain ID",
+			hello: &pb.Message{Payload: &pb.Message_Hello{Hello: &pb.Hello{
+				ProtocolVersion: ProtocolVersion,
+			}}},
+		},
+		{
+			name: "unsupported version",
+			hello: &pb.Message{Payload: &pb.Message_Hello{Hello: &pb.Hello{
+				ChainId:         []byte{0x01},
+				ProtocolVersion: MinProtocolVersion - 1,
+			}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv, addr := startTestServer(t, ServerConfig{HandshakeTimeout: 100 * time.Millisecond})
+
+			connected := make(chan struct{}, 1)
+			srv.SetConnectHandler(func(ConnectionInfo) { connected <- struct{}{} })
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			if tt.hello != nil {
+				require.NoError(t, NewStreamWriter(conn, codec).Write(tt.hello))
+			}
+
+			// The server closes the connection without a Welcome
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(2*time.Second)))
+			var msg pb.Message
+			require.Error(t, codec.Decode(conn, &msg))
+			assert.Nil(t, msg.GetWelcome())
+
+			assert.Empty(t, srv.GetConnections())
+			assert.Empty(t, connected)
+		})
+	}
+}
+
+func TestClient_ConnectFailsWithoutWelcome(t *testing.T) {
+	t.Parallel()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		time.Sleep(2 * time.Second) // Never answers the Hello
+	}()
+
+	c := NewClient(ClientConfig{
+		ServerAddr:     listener.Addr().String(),
+		ConnectTimeout: 100 * time.Millisecond,
+		MaxMessageSize: 1024,
+		ChainID:        []byte{0x01},
+	}, zerolog.Nop())
+
+	err = c.Connect(context.Background())
+	require.ErrorIs(t, err, ErrHandshakeFailed)
+	assert.False(t, c.IsConnected())
+}
+
+// dialHello opens a raw connection and completes the handshake at version.
+func dialHello(t *testing.T, addr string, version uint32) (net.Conn, *pb.Welcome) {
+	t.Helper()
+
+	conn, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	codec := NewCodec(1024 * 1024)
+	welcome, err := sendHello(conn, NewStreamWriter(conn, codec), codec, &pb.Hello{
+		ChainId:         []byte{0x01},
+		ProtocolVersion: version,
+	}, nil, time.Second)
+	require.NoError(t, err)
+
+	return conn, welcome
+}
+
+func TestServer_NegotiatesVersion(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name    string
+		offered uint32
+		want    uint32
+	}{
+		{name: "oldest", offered: MinProtocolVersion, want: MinProtocolVersion},
+		{name: "current", offered: ProtocolVersion, want: ProtocolVersion},
+		{name: "newer client", offered: ProtocolVersion + 3, want: ProtocolVersion},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv, addr := startTestServer(t, ServerConfig{MessageTypes: []string{"vote"}})
+
+			_, welcome := dialHello(t, addr, tt.offered)
+			assert.Equal(t, tt.want, welcome.ProtocolVersion)
+			assert.Equal(t, []string{"vote"}, welcome.MessageTypes)
+
+			require.Eventually(t, func() bool { return len(srv.GetConnections()) == 1 }, time.Second, 5*time.Millisecond)
+			assert.Equal(t, tt.want, srv.GetConnections()[0].ProtocolVersion)
+		})
+	}
+}
+
+func TestServer_RejectsUnsupportedPayloads(t *testing.T) {
+	t.Parallel()
+
+	srv, addr := startTestServer(t, ServerConfig{MessageTypes: []string{"vote"}})
+
+	handled := make(chan *pb.Message, 10)
+	srv.SetHandler(func(_ context.Context, _ string, msg *pb.Message) error {
+		handled <- msg
+		return nil
+	})
+
+	codec := NewCodec(1024 * 1024)
+	conn, _ := dialHello(t, addr, ProtocolVersion)
+	writer := NewStreamWriter(conn, codec)
+
+	read := func() *pb.Message {
+		t.Helper()
+		require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+		var msg pb.Message
+		require.NoError(t, codec.Decode(conn, &msg))
+		return &msg
+	}
+
+	// A known payload the handler does not accept
+	require.NoError(t, writer.Write(&pb.Message{
+		CorrelationId: 7,
+		Payload:       &pb.Message_XtRequest{XtRequest: &pb.XTRequest{}},
+	}))
+	msg := read()
+	assert.Equal(t, uint64(7), msg.ReplyTo, "the reply is addressed to the request")
+	reply := msg.GetUnsupported()
+	require.NotNil(t, reply)
+	assert.Equal(t, uint32(2), reply.Field)
+	assert.Equal(t, "xt_request", reply.Type)
+
+	// A payload from a newer protocol version: field 99, one empty message
+	unknown := &pb.Message{}
+	unknown.ProtoReflect().SetUnknown([]byte{0x9a, 0x06, 0x00})
+	require.NoError(t, writer.Write(unknown))
+	reply = read().GetUnsupported()
+	require.NotNil(t, reply)
+	assert.Equal(t, uint32(99), reply.Field)
+	assert.Empty(t, reply.Type)
+
+	// The connection stays open for supported payloads
+	require.NoError(t, writer.Write(&pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{}}}))
+	select {
+	case msg := <-handled:
+		assert.NotNil(t, msg.GetVote())
+	case <-time.After(time.Second):
+		t.Fatal("vote not handled")
+	}
+	assert.Empty(t, handled)
+}
+
+func TestClient_RefusesPayloadsTheServerDoesNotAccept(t *testing.T) {
+	t.Parallel()
+
+	_, addr := startTestServer(t, ServerConfig{MessageTypes: []string{"vote"}})
+
+	c := NewClient(ClientConfig{
+		ServerAddr:     addr,
+		ConnectTimeout: time.Second,
+		MaxMessageSize: 1024 * 1024,
+		ChainID:        []byte{0x01},
+	}, zerolog.Nop())
+	require.NoError(t, c.Connect(context.Background()))
+	defer c.Disconnect(context.Background())
+
+	info := c.ServerInfo()
+	assert.Equal(t, ProtocolVersion, info.ProtocolVersion)
+	assert.True(t, info.Supports("vote"))
+	assert.False(t, info.Supports("xt_request"))
+
+	err := c.Send(context.Background(), &pb.Message{Payload: &pb.Message_XtRequest{XtRequest: &pb.XTRequest{}}})
+	assert.ErrorIs(t, err, ErrUnsupportedMessage)
+	assert.NoError(t, c.Send(context.Background(), &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{}}}))
+}
+
+func TestServer_RejectsNonProtocolPeers(t *testing.T) {
+	t.Parallel()
+
+	for _, legacy := range []bool{false, true} {
+		t.Run(fmt.Sprintf("legacy framing %v", legacy), func(t *testing.T) {
+			t.Parallel()
+
+			_, addr := startTestServer(t, ServerConfig{
+				HandshakeTimeout: 10 * time.Second,
+				LegacyFraming:    legacy,
+			})
+
+			conn, err := net.Dial("tcp", addr)
+			require.NoError(t, err)
+			defer conn.Close()
+
+			_, err = conn.Write([]byte("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+			require.NoError(t, err)
+
+			// Closed on the first bytes, long before the handshake timeout
+			require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+			_, err = conn.Read(make([]byte, 1))
+			require.Error(t, err)
+			assert.NotErrorIs(t, err, os.ErrDeadlineExceeded, "connection left open")
+		})
+	}
+}
+
+func TestServer_LegacyFraming(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name          string
+		serverLegacy  bool
+		clientLegacy  bool
+		wantConnected bool
+	}{
+		{name: "framed client", serverLegacy: true, clientLegacy: false, wantConnected: true},
+		{name: "legacy client", serverLegacy: true, clientLegacy: true, wantConnected: true},
+		{name: "legacy client without the switch", serverLegacy: false, clientLegacy: true, wantConnected: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			srv, addr := startTestServer(t, ServerConfig{LegacyFraming: tt.serverLegacy})
+
+			received := make(chan *pb.Message, 1)
+			srv.SetHandler(func(ctx context.Context, from string, msg *pb.Message) error {
+				received <- msg
+				return srv.Send(ctx, from, msg)
+			})
+
+			c := NewClient(ClientConfig{
+				ServerAddr:     addr,
+				ConnectTimeout: time.Second,
+				MaxMessageSize: 1024 * 1024,
+				ChainID:        []byte{0x01},
+				Capabilities:   []string{CapabilityDeflate},
+				LegacyFraming:  tt.clientLegacy,
+			}, zerolog.Nop())
+
+			err := c.Connect(context.Background())
+			if !tt.wantConnected {
+				assert.ErrorIs(t, err, ErrHandshakeFailed)
+				return
+			}
+			require.NoError(t, err)
+			defer c.Disconnect(context.Background())
+
+			msg := newTestBatch(100)
+			require.NoError(t, c.Send(context.Background(), msg))
+
+			select {
+			case got := <-received:
+				assert.True(t, proto.Equal(msg.GetXtRequest(), got.GetXtRequest()))
+			case <-time.After(time.Second):
+				t.Fatal("message not delivered")
+			}
+		})
+	}
+}
+
+func TestServer_DropsCorruptFrames(t *testing.T) {
+	t.Parallel()
+
+	srv, addr := startTestServer(t, ServerConfig{})
+
+	handled := make(chan *pb.Message, 10)
+	srv.SetHandler(func(_ context.Context, _ string, msg *pb.Message) error {
+		handled <- msg
+		return nil
+	})
+
+	conn, _ := dialHello(t, addr, ProtocolVersion)
+	codec := NewCodec(1024 * 1024)
+
+	corrupt, err := codec.Encode(&pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{Vote: false}}})
+	require.NoError(t, err)
+	corrupt[len(corrupt)-1] ^= 0xff
+
+	valid, err := codec.Encode(&pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{Vote: true}}})
+	require.NoError(t, err)
+
+	_, err = conn.Write(append(corrupt, valid...))
+	require.NoError(t, err)
+
+	select {
+	case msg := <-handled:
+		assert.True(t, msg.GetVote().GetVote(), "only the intact frame is handled")
+	case <-time.After(time.Second):
+		t.Fatal("frame after the corrupt one not handled")
+	}
+	assert.Len(t, srv.GetConnections(), 1)
+}
+
+func TestClient_SignsMessages(t *testing.T) {
+	t.Parallel()
+
+	srv, addr := startTestServer(t, ServerConfig{})
+
+	received := make(chan *pb.Message, 1)
+	srv.SetHandler(func(_ context.Context, _ string, msg *pb.Message) error {
+		received <- msg
+		return nil
+	})
+
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	c := NewClient(ClientConfig{
+		ServerAddr:     addr,
+		ConnectTimeout: time.Second,
+		MaxMessageSize: 1024 * 1024,
+		ChainID:        []byte{0x01},
+		Signer:         auth.NewSigner([]byte{0x01}, key),
+	}, zerolog.Nop())
+	require.NoError(t, c.Connect(context.Background()))
+	defer c.Disconnect(context.Background())
+
+	require.NoError(t, c.Send(context.Background(), &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{SenderChainId: []byte{0x01}}}}))
+
+	keyring, err := auth.NewKeyring(map[string][]string{"0x01": {hex.EncodeToString(key.Public().(ed25519.PublicKey))}})
+	require.NoError(t, err)
+
+	select {
+	case msg := <-received:
+		assert.NoError(t, keyring.Verify(msg))
+	case <-time.After(time.Second):
+		t.Fatal("message not delivered")
+	}
+}
+
+func TestServer_SequencesEachConnection(t *testing.T) {
+	t.Parallel()
+
+	srv, addr := startTestServer(t, ServerConfig{Epoch: 42})
+
+	connA, welcomeA := dialHello(t, addr, ProtocolVersion)
+	connB, welcomeB := dialHello(t, addr, ProtocolVersion)
+	require.Eventually(t, func() bool {
+		return len(srv.GetConnections()) == 2
+	}, time.Second, time.Millisecond)
+
+	ctx := context.Background()
+	newMsg := func() *pb.Message {
+		return &pb.Message{SenderId: "test", Payload: &pb.Message_Ack{Ack: &pb.Ack{}}}
+	}
+
+	require.NoError(t, srv.Send(ctx, welcomeA.ConnectionId, newMsg()))
+	require.NoError(t, srv.Broadcast(ctx, newMsg(), ""))
+	require.NoError(t, srv.Broadcast(ctx, newMsg(), welcomeA.ConnectionId))
+	require.NoError(t, srv.Send(ctx, welcomeB.ConnectionId, newMsg()))
+
+	// Targeted and excluding sends leave no gaps in either stream
+	for _, tc := range []struct {
+		conn net.Conn
+		want int
+	}{{connA, 2}, {connB, 3}} {
+		codec := NewCodec(1024 * 1024)
+		require.NoError(t, tc.conn.SetReadDeadline(time.Now().Add(time.Second)))
+		for i := 1; i <= tc.want; i++ {
+			var msg pb.Message
+			require.NoError(t, codec.Decode(tc.conn, &msg))
+			assert.Equal(t, uint64(42), msg.Epoch)
+			assert.Equal(t, uint64(i), msg.Sequence)
+		}
+	}
+}
+
+func TestServer_LimitsConnectionsInHandshake(t *testing.T) {
+	t.Parallel()
+
+	srv, addr := startTestServer(t, ServerConfig{MaxConnections: 1, HandshakeTimeout: 5 * time.Second})
+
+	// A peer that never sends its Hello still takes the only slot
+	idle, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return srv.accepted.Load() == 1
+	}, time.Second, time.Millisecond)
+
+	rejected, err := net.Dial("tcp", addr)
+	require.NoError(t, err)
+	defer rejected.Close()
+	require.NoError(t, rejected.SetReadDeadline(time.Now().Add(time.Second)))
+	_, err = rejected.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF, "the connection over the limit is closed")
+
+	// The slot is freed once the idle peer goes away
+	require.NoError(t, idle.Close())
+	require.Eventually(t, func() bool {
+		return srv.accepted.Load() == 0
+	}, time.Second, time.Millisecond)
+
+	dialHello(t, addr, ProtocolVersion)
+	require.Eventually(t, func() bool {
+		return len(srv.GetConnections()) == 1
+	}, time.Second, time.Millisecond)
+}
@@ -0,0 +1,158 @@
+package network
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"time"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// LoadServerTLS builds the TLS configuration of a server from PEM files.
+// With clientCAFile set, clients must present a certificate signed by one of
+// its CAs (mutual TLS).
+func LoadServerTLS(certFile, keyFile, clientCAFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load certificate: %w", err)
+	}
+
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCAFile != "" {
+		pool, err := loadCertPool(clientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return cfg, nil
+}
+
+// LoadClientTLS builds the TLS configuration of a client from PEM files. The
+// server certificate is verified against caFile, or the system roots if it is
+// empty. certFile and keyFile are the client certificate for mutual TLS and
+// may be empty.
+func LoadClientTLS(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		pool, err := loadCertPool(caFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.RootCAs = pool
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
+
+func loadCertPool(file string) (*x509.CertPool, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA file: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("no certificates in CA file %s", file)
+	}
+	return pool, nil
+}
+
+// serverTLSHandshake runs the server side of the TLS handshake on a new
+// connection, bounded by the handshake timeout.
+func serverTLSHandshake(ctx context.Context, conn net.Conn, cfg *tls.Config, timeout time.Duration) (*tls.Conn, error) {
+	if timeout <= 0 {
+		timeout = DefaultHandshakeTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	tlsConn := tls.Server(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("%w: tls: %w", ErrHandshakeFailed, err)
+	}
+	return tlsConn, nil
+}
+
+// clientTLSHandshake runs the client side of the TLS handshake on a dialed
+// connection. Without a ServerName in cfg, the server certificate is verified
+// against serverName.
+func clientTLSHandshake(ctx context.Context, conn net.Conn, cfg *tls.Config, serverName string) (*tls.Conn, error) {
+	if cfg.ServerName == "" {
+		cfg = cfg.Clone()
+		cfg.ServerName = serverName
+	}
+
+	tlsConn := tls.Client(conn, cfg)
+	if err := tlsConn.HandshakeContext(ctx); err != nil {
+		return nil, fmt.Errorf("tls: %w", err)
+	}
+	return tlsConn, nil
+}
+
+// tlsServerName returns the host of a TCP address, which server certificates
+// are verified against by default; "" for other addresses.
+func tlsServerName(address string) string {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return ""
+	}
+	return host
+}
+
+// peerIdentity returns the identity of the verified client certificate of a
+// TLS connection: its subject common name, or its first DNS name. It is empty
+// without a client certificate.
+func peerIdentity(state tls.ConnectionState) string {
+	if len(state.PeerCertificates) == 0 {
+		return ""
+	}
+
+	cert := state.PeerCertificates[0]
+	if cert.Subject.CommonName != "" {
+		return cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return cert.DNSNames[0]
+	}
+	return ""
+}
+
+// authorizeChain checks that the peer with the given certificate identity may
+// announce chainID. Without ClientChains any chain is allowed.
+func (s *server) authorizeChain(identity string, chainID []byte) error {
+	if len(s.cfg.ClientChains) == 0 {
+		return nil
+	}
+
+	allowed, ok := s.cfg.ClientChains[identity]
+	if !ok {
+		return fmt.Errorf("%w: certificate %q", ErrChainNotAllowed, identity)
+	}
+	if id, err := pb.ParseChainID(allowed); err != nil || !bytes.Equal(id, chainID) {
+		return fmt.Errorf("%w: certificate %q announced chain %s, allowed %s",
+			ErrChainNotAllowed, identity, pb.FormatChainID(chainID), allowed)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package network
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// testPKI is a CA issuing certificates into PEM files of a temporary directory.
+type testPKI struct {
+	t    *testing.T
+	dir  string
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+
+	caFile string
+}
+
+func newTestPKI(t *testing.T, name string) *testPKI {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	p := &testPKI{t: t, dir: t.TempDir(), cert: cert, key: key}
+	p.caFile = p.write(name+"-ca.pem", "CERTIFICATE", der)
+	return p
+}
+
+// issue creates a certificate for commonName and returns its cert and key files.
+func (p *testPKI) issue(commonName string, usage x509.ExtKeyUsage) (certFile, keyFile string) {
+	p.t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(p.t, err)
+
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	require.NoError(p.t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, p.cert, &key.PublicKey, p.key)
+	require.NoError(p.t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(p.t, err)
+
+	return p.write(commonName+".pem", "CERTIFICATE", der), p.write(commonName+"-key.pem", "EC PRIVATE KEY", keyDER)
+}
+
+func (p *testPKI) write(name, blockType string, der []byte) string {
+	p.t.Helper()
+
+	path := filepath.Join(p.dir, name)
+	require.NoError(p.t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func TestServer_TLS(t *testing.T) {
+	t.Parallel()
+
+	pki := newTestPKI(t, "publisher")
+	serverCert, serverKey := pki.issue("localhost", x509.ExtKeyUsageServerAuth)
+	seqCert, seqKey := pki.issue("sequencer-a", x509.ExtKeyUsageClientAuth)
+	strangerCert, strangerKey := pki.issue("stranger", x509.ExtKeyUsageClientAuth)
+
+	other := newTestPKI(t, "other")
+
+	tests := []struct {
+		name         string
+		mutual       bool
+		plain        bool   // Client connects without TLS
+		caFile       string // Defaults to the publisher CA
+		cert, key    string
+		chainID      []byte
+		wantIdentity string
+		wantErr      bool
+	}{
+		{
+			name:    "tls",
+			chainID: []byte{0x01},
+		},
+		{
+			name:         "mutual tls",
+			mutual:       true,
+			cert:         seqCert,
+			key:          seqKey,
+			chainID:      []byte{0x01},
+			wantIdentity: "sequencer-a",
+		},
+		{
+			name:    "client without certificate",
+			mutual:  true,
+			chainID: []byte{0x01},
+			wantErr: true,
+		},
+		{
+			name:    "certificate of another chain",
+			mutual:  true,
+			cert:    seqCert,
+			key:     seqKey,
+			chainID: []byte{0x02},
+			wantErr: true,
+		},
+		{
+			name:    "identity not allowed",
+			mutual:  true,
+			cert:    strangerCert,
+			key:     strangerKey,
+			chainID: []byte{0x01},
+			wantErr: true,
+		},
+		{
+			name:    "plain client",
+			plain:   true,
+			chainID: []byte{0x01},
+			wantErr: true,
+		},
+		{
+			name:    "untrusted server",
+			caFile:  other.caFile,
+			chainID: []byte{0x01},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			cfg := ServerConfig{HandshakeTimeout: time.Second}
+			clientCA := ""
+			if tt.mutual {
+				clientCA = pki.caFile
+				cfg.ClientChains = map[string]string{"sequencer-a": "0x01"}
+			}
+			serverTLS, err := LoadServerTLS(serverCert, serverKey, clientCA)
+			require.NoError(t, err)
+			cfg.TLS = serverTLS
+
+			srv, addr := startTestServer(t, cfg)
+
+			connected := make(chan ConnectionInfo, 1)
+			srv.SetConnectHandler(func(info ConnectionInfo) { connected <- info })
+
+			clientCfg := ClientConfig{
+				ServerAddr:     addr,
+				ConnectTimeout: time.Second,
+				MaxMessageSize: 1024 * 1024,
+				ChainID:        tt.chainID,
+			}
+			if !tt.plain {
+				caFile := tt.caFile
+				if caFile == "" {
+					caFile = pki.caFile
+				}
+				clientCfg.TLS, err = LoadClientTLS(caFile, tt.cert, tt.key)
+				require.NoError(t, err)
+			}
+
+			c := NewClient(clientCfg, zerolog.Nop())
+			err = c.Connect(context.Background())
+			if tt.wantErr {
+				require.Error(t, err)
+				assert.Empty(t, srv.GetConnections())
+				return
+			}
+			require.NoError(t, err)
+			defer c.Disconnect(context.Background())
+
+			select {
+			case info := <-connected:
+				assert.Equal(t, tt.wantIdentity, info.Identity)
+				assert.Equal(t, pb.FormatChainID(tt.chainID), info.ChainID)
+			case <-time.After(time.Second):
+				t.Fatal("connection not registered")
+			}
+		})
+	}
+}
+
+func TestLoadTLS_RejectsInvalidFiles(t *testing.T) {
+	t.Parallel()
+
+	pki := newTestPKI(t, "publisher")
+	cert, key := pki.issue("localhost", x509.ExtKeyUsageServerAuth)
+	missing := filepath.Join(t.TempDir(), "missing.pem")
+
+	_, err := LoadServerTLS(cert, missing, "")
+	assert.Error(t, err)
+
+	_, err = LoadServerTLS(cert, key, key)
+	assert.Error(t, err, "a key is not a CA certificate")
+
+	_, err = LoadClientTLS(missing, "", "")
+	assert.Error(t, err)
+
+	_, err = LoadClientTLS(pki.caFile, cert, "")
+	assert.Error(t, err, "a certificate needs its key")
+}
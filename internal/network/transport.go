@@ -0,0 +1,93 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// Transport opens the connections of an address scheme. Addresses passed to
+// it have the scheme stripped, e.g. "/run/publisher.sock" for
+// "unix:///run/publisher.sock".
+type Transport interface {
+	// Listen listens for connections on address.
+	Listen(address string) (net.Listener, error)
+	// Dial connects to a listener on address.
+	Dial(ctx context.Context, address string) (net.Conn, error)
+}
+
+// transports serves the address schemes. Addresses without a scheme use TCP.
+var transports = map[string]Transport{
+	"tcp":  tcpTransport{},
+	"unix": unixTransport{},
+	"mem":  defaultMemTransport,
+}
+
+// resolveTransport splits addr into its scheme and address and returns the
+// transport of the scheme, or override if it is not nil.
+func resolveTransport(addr string, override Transport) (Transport, string, error) {
+	scheme, address, found := strings.Cut(addr, "://")
+	if !found {
+		scheme, address = "tcp", addr
+	}
+
+	if override != nil {
+		return override, address, nil
+	}
+
+	transport, ok := transports[strings.ToLower(scheme)]
+	if !ok {
+		return nil, "", fmt.Errorf("%w: %q", ErrUnknownTransport, scheme)
+	}
+	return transport, address, nil
+}
+
+// deadlineListener is a listener whose Accept can time out.
+type deadlineListener interface {
+	SetDeadline(t time.Time) error
+}
+
+// tcpTransport connects over TCP, the default.
+type tcpTransport struct{}
+
+func (tcpTransport) Listen(address string) (net.Listener, error) {
+	return net.Listen("tcp", address)
+}
+
+func (tcpTransport) Dial(ctx context.Context, address string) (net.Conn, error) {
+	dialer := &net.Dialer{KeepAlive: 30 * time.Second}
+	return dialer.DialContext(ctx, "tcp", address)
+}
+
+// unixTransport connects over Unix domain sockets, for sequencers on the
+// publisher's host.
+type unixTransport struct{}
+
+func (unixTransport) Listen(address string) (net.Listener, error) {
+	removeStaleSocket(address)
+	return net.Listen("unix", address)
+}
+
+func (unixTransport) Dial(ctx context.Context, address string) (net.Conn, error) {
+	var dialer net.Dialer
+	return dialer.DialContext(ctx, "unix", address)
+}
+
+// removeStaleSocket removes the socket file left behind by a process that did
+// not close its listener, which would make Listen fail. A socket something
+// still accepts on is kept.
+func removeStaleSocket(path string) {
+	info, err := os.Stat(path)
+	if err != nil || info.Mode()&os.ModeSocket == 0 {
+		return
+	}
+
+	if conn, err := net.DialTimeout("unix", path, time.Second); err == nil {
+		conn.Close()
+		return
+	}
+	_ = os.Remove(path)
+}
@@ -0,0 +1,170 @@
+package network
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+func TestResolveTransport(t *testing.T) {
+	t.Parallel()
+
+	mem := NewMemTransport()
+
+	tests := []struct {
+		name        string
+		addr        string
+		override    Transport
+		wantScheme  Transport
+		wantAddress string
+		wantErr     error
+	}{
+		{name: "no scheme", addr: ":8080", wantScheme: tcpTransport{}, wantAddress: ":8080"},
+		{name: "tcp", addr: "tcp://127.0.0.1:8080", wantScheme: tcpTransport{}, wantAddress: "127.0.0.1:8080"},
+		{name: "unix", addr: "unix:///run/publisher.sock", wantScheme: unixTransport{}, wantAddress: "/run/publisher.sock"},
+		{name: "mem", addr: "mem://publisher", wantScheme: defaultMemTransport, wantAddress: "publisher"},
+		{name: "override", addr: "mem://publisher", override: mem, wantScheme: mem, wantAddress: "publisher"},
+		{name: "unknown scheme", addr: "udp://127.0.0.1:8080", wantErr: ErrUnknownTransport},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			transport, address, err := resolveTransport(tt.addr, tt.override)
+			if tt.wantErr != nil {
+				assert.ErrorIs(t, err, tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.wantScheme, transport)
+			assert.Equal(t, tt.wantAddress, address)
+		})
+	}
+}
+
+func TestTransports(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		addr func(t *testing.T) string
+	}{
+		{name: "tcp", addr: func(*testing.T) string { return "tcp://127.0.0.1:0" }},
+		{name: "unix", addr: func(t *testing.T) string { return "unix://" + filepath.Join(t.TempDir(), "publisher.sock") }},
+		{name: "mem", addr: func(t *testing.T) string { return "mem://" + t.Name() }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			addr := tt.addr(t)
+			srv := NewServer(ServerConfig{ListenAddr: addr, MaxMessageSize: 1024 * 1024}, zerolog.Nop()).(*server)
+			srv.SetHandler(func(ctx context.Context, from string, msg *pb.Message) error {
+				return srv.Reply(ctx, from, msg, &pb.Message{Payload: &pb.Message_Ack{Ack: &pb.Ack{}}})
+			})
+			require.NoError(t, srv.Start(context.Background()))
+			defer srv.Stop(context.Background())
+
+			if tt.name == "tcp" {
+				addr = "tcp://" + srv.listener.Addr().String()
+			}
+
+			c := NewClient(ClientConfig{
+				ServerAddr:     addr,
+				ConnectTimeout: time.Second,
+				MaxMessageSize: 1024 * 1024,
+				ChainID:        []byte{0x01},
+			}, zerolog.Nop())
+			require.NoError(t, c.Connect(context.Background()))
+			defer c.Disconnect(context.Background())
+
+			reply, err := c.Request(context.Background(), &pb.Message{Payload: &pb.Message_Vote{Vote: &pb.Vote{}}})
+			require.NoError(t, err)
+			assert.NotNil(t, reply.GetAck())
+		})
+	}
+}
+
+func TestMemTransport(t *testing.T) {
+	t.Parallel()
+
+	mem := NewMemTransport()
+	ctx := context.Background()
+
+	_, err := mem.Dial(ctx, "publisher")
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED, "nothing listens")
+
+	l, err := mem.Listen("publisher")
+	require.NoError(t, err)
+	_, err = mem.Listen("publisher")
+	assert.ErrorIs(t, err, syscall.EADDRINUSE)
+
+	_, err = defaultMemTransport.Dial(ctx, "publisher")
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED, "transports do not share names")
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := l.Accept()
+		assert.NoError(t, err)
+		accepted <- conn
+	}()
+
+	client, err := mem.Dial(ctx, "publisher")
+	require.NoError(t, err)
+	defer client.Close()
+	server := <-accepted
+	defer server.Close()
+
+	assert.Equal(t, "publisher", client.RemoteAddr().String())
+	assert.Equal(t, client.LocalAddr(), server.RemoteAddr())
+
+	go client.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	_, err = server.Read(buf)
+	require.NoError(t, err)
+	assert.Equal(t, "hello", string(buf))
+
+	// Accept times out like a TCP listener's
+	require.NoError(t, l.(deadlineListener).SetDeadline(time.Now().Add(10*time.Millisecond)))
+	_, err = l.Accept()
+	var ne net.Error
+	require.ErrorAs(t, err, &ne)
+	assert.True(t, ne.Timeout())
+
+	require.NoError(t, l.Close())
+	_, err = l.Accept()
+	assert.ErrorIs(t, err, net.ErrClosed)
+	_, err = mem.Dial(ctx, "publisher")
+	assert.ErrorIs(t, err, syscall.ECONNREFUSED)
+}
+
+func TestUnixTransport_RemovesStaleSocket(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "publisher.sock")
+
+	// A listener that exits without removing its socket file
+	stale, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	require.NoError(t, stale.Close())
+
+	l, err := unixTransport{}.Listen(path)
+	require.NoError(t, err)
+	defer l.Close()
+
+	// A socket still accepting connections is not taken over
+	_, err = unixTransport{}.Listen(path)
+	assert.Error(t, err)
+}
@@ -0,0 +1,28 @@
+package proto
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+// FormatChainID formats a raw chain ID the way it is used as a map key, metric
+// label and in the API: "0x" followed by the lowercase hex of every byte.
+func FormatChainID(id []byte) string {
+	return fmt.Sprintf("0x%x", id)
+}
+
+// ParseChainID parses a hex chain ID with or without the "0x" prefix. An odd
+// number of digits is read with a leading zero, so "0x1" is the chain 0x01.
+func ParseChainID(s string) ([]byte, error) {
+	digits := strings.TrimPrefix(strings.ToLower(s), "0x")
+	if len(digits)%2 == 1 {
+		digits = "0" + digits
+	}
+
+	id, err := hex.DecodeString(digits)
+	if err != nil || len(id) == 0 {
+		return nil, fmt.Errorf("invalid chain ID %q", s)
+	}
+	return id, nil
+}
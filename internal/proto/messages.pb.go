@@ -119,13 +119,930 @@ func (x *TransactionRequest) GetTransaction() [][]byte {
 	return nil
 }
 
+// Cross-chain transaction identifier (SHA-256 of the XTRequest)
+type XtID struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Hash          []byte                 `protobuf:"bytes,1,opt,name=hash,proto3" json:"hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *XtID) Reset() {
+	*x = XtID{}
+	mi := &file_messages_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *XtID) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*XtID) ProtoMessage() {}
+
+func (x *XtID) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use XtID.ProtoReflect.Descriptor instead.
+func (*XtID) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *XtID) GetHash() []byte {
+	if x != nil {
+		return x.Hash
+	}
+	return nil
+}
+
+// Participant vote on a cross-chain transaction
+type Vote struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SenderChainId []byte                 `protobuf:"bytes,1,opt,name=sender_chain_id,json=senderChainId,proto3" json:"sender_chain_id,omitempty"` // Chain the voting sequencer is responsible for
+	XtId          *XtID                  `protobuf:"bytes,2,opt,name=xt_id,json=xtId,proto3" json:"xt_id,omitempty"`
+	Vote          bool                   `protobuf:"varint,3,opt,name=vote,proto3" json:"vote,omitempty"` // true = commit, false = abort
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Vote) Reset() {
+	*x = Vote{}
+	mi := &file_messages_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Vote) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Vote) ProtoMessage() {}
+
+func (x *Vote) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Vote.ProtoReflect.Descriptor instead.
+func (*Vote) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Vote) GetSenderChainId() []byte {
+	if x != nil {
+		return x.SenderChainId
+	}
+	return nil
+}
+
+func (x *Vote) GetXtId() *XtID {
+	if x != nil {
+		return x.XtId
+	}
+	return nil
+}
+
+func (x *Vote) GetVote() bool {
+	if x != nil {
+		return x.Vote
+	}
+	return false
+}
+
+// Coordinator decision on a cross-chain transaction
+type Decided struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	XtId          *XtID                  `protobuf:"bytes,1,opt,name=xt_id,json=xtId,proto3" json:"xt_id,omitempty"`
+	Decision      bool                   `protobuf:"varint,2,opt,name=decision,proto3" json:"decision,omitempty"` // true = commit, false = abort
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Decided) Reset() {
+	*x = Decided{}
+	mi := &file_messages_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Decided) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Decided) ProtoMessage() {}
+
+func (x *Decided) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Decided.ProtoReflect.Descriptor instead.
+func (*Decided) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *Decided) GetXtId() *XtID {
+	if x != nil {
+		return x.XtId
+	}
+	return nil
+}
+
+func (x *Decided) GetDecision() bool {
+	if x != nil {
+		return x.Decision
+	}
+	return false
+}
+
+// Participant chains of an xT that no connected sequencer serves, sent to the submitter
+type Unroutable struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	XtId          *XtID                  `protobuf:"bytes,1,opt,name=xt_id,json=xtId,proto3" json:"xt_id,omitempty"`
+	ChainIds      [][]byte               `protobuf:"bytes,2,rep,name=chain_ids,json=chainIds,proto3" json:"chain_ids,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Unroutable) Reset() {
+	*x = Unroutable{}
+	mi := &file_messages_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Unroutable) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Unroutable) ProtoMessage() {}
+
+func (x *Unroutable) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Unroutable.ProtoReflect.Descriptor instead.
+func (*Unroutable) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Unroutable) GetXtId() *XtID {
+	if x != nil {
+		return x.XtId
+	}
+	return nil
+}
+
+func (x *Unroutable) GetChainIds() [][]byte {
+	if x != nil {
+		return x.ChainIds
+	}
+	return nil
+}
+
+// Start of a synchronous slot, broadcast by the publisher
+type StartSlot struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Slot          uint64                 `protobuf:"varint,1,opt,name=slot,proto3" json:"slot,omitempty"`
+	Timestamp     int64                  `protobuf:"varint,2,opt,name=timestamp,proto3" json:"timestamp,omitempty"` // Slot start, unix milliseconds
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StartSlot) Reset() {
+	*x = StartSlot{}
+	mi := &file_messages_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StartSlot) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StartSlot) ProtoMessage() {}
+
+func (x *StartSlot) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StartSlot.ProtoReflect.Descriptor instead.
+func (*StartSlot) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *StartSlot) GetSlot() uint64 {
+	if x != nil {
+		return x.Slot
+	}
+	return 0
+}
+
+func (x *StartSlot) GetTimestamp() int64 {
+	if x != nil {
+		return x.Timestamp
+	}
+	return 0
+}
+
+// Request to seal the block of the current slot
+type RequestSeal struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Slot          uint64                 `protobuf:"varint,1,opt,name=slot,proto3" json:"slot,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RequestSeal) Reset() {
+	*x = RequestSeal{}
+	mi := &file_messages_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RequestSeal) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RequestSeal) ProtoMessage() {}
+
+func (x *RequestSeal) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RequestSeal.ProtoReflect.Descriptor instead.
+func (*RequestSeal) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *RequestSeal) GetSlot() uint64 {
+	if x != nil {
+		return x.Slot
+	}
+	return 0
+}
+
+// Sequencer acknowledgement that it sealed its block for the slot
+type BlockSealed struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Slot          uint64                 `protobuf:"varint,1,opt,name=slot,proto3" json:"slot,omitempty"`
+	ChainId       []byte                 `protobuf:"bytes,2,opt,name=chain_id,json=chainId,proto3" json:"chain_id,omitempty"`
+	BlockNumber   uint64                 `protobuf:"varint,3,opt,name=block_number,json=blockNumber,proto3" json:"block_number,omitempty"`
+	BlockHash     []byte                 `protobuf:"bytes,4,opt,name=block_hash,json=blockHash,proto3" json:"block_hash,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BlockSealed) Reset() {
+	*x = BlockSealed{}
+	mi := &file_messages_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BlockSealed) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BlockSealed) ProtoMessage() {}
+
+func (x *BlockSealed) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BlockSealed.ProtoReflect.Descriptor instead.
+func (*BlockSealed) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *BlockSealed) GetSlot() uint64 {
+	if x != nil {
+		return x.Slot
+	}
+	return 0
+}
+
+func (x *BlockSealed) GetChainId() []byte {
+	if x != nil {
+		return x.ChainId
+	}
+	return nil
+}
+
+func (x *BlockSealed) GetBlockNumber() uint64 {
+	if x != nil {
+		return x.BlockNumber
+	}
+	return 0
+}
+
+func (x *BlockSealed) GetBlockHash() []byte {
+	if x != nil {
+		return x.BlockHash
+	}
+	return nil
+}
+
+// Handshake: first frame a sequencer sends on a new connection
+type Hello struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ChainId         []byte                 `protobuf:"bytes,1,opt,name=chain_id,json=chainId,proto3" json:"chain_id,omitempty"`                          // Chain the sequencer serves
+	Name            string                 `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`                                               // Human-readable sequencer name
+	ProtocolVersion uint32                 `protobuf:"varint,3,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"` // Highest protocol version spoken by the sequencer
+	Capabilities    []string               `protobuf:"bytes,4,rep,name=capabilities,proto3" json:"capabilities,omitempty"`                               // Optional features the sequencer supports
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Hello) Reset() {
+	*x = Hello{}
+	mi := &file_messages_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Hello) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Hello) ProtoMessage() {}
+
+func (x *Hello) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Hello.ProtoReflect.Descriptor instead.
+func (*Hello) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Hello) GetChainId() []byte {
+	if x != nil {
+		return x.ChainId
+	}
+	return nil
+}
+
+func (x *Hello) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Hello) GetProtocolVersion() uint32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+func (x *Hello) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+// Handshake: publisher reply accepting a Hello
+type Welcome struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId    string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`           // Connection ID assigned by the publisher
+	ProtocolVersion uint32                 `protobuf:"varint,2,opt,name=protocol_version,json=protocolVersion,proto3" json:"protocol_version,omitempty"` // Protocol version used on the connection
+	Capabilities    []string               `protobuf:"bytes,3,rep,name=capabilities,proto3" json:"capabilities,omitempty"`                               // Capabilities enabled on the connection
+	MessageTypes    []string               `protobuf:"bytes,4,rep,name=message_types,json=messageTypes,proto3" json:"message_types,omitempty"`           // Payloads the publisher accepts, by Message field name
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *Welcome) Reset() {
+	*x = Welcome{}
+	mi := &file_messages_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Welcome) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Welcome) ProtoMessage() {}
+
+func (x *Welcome) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Welcome.ProtoReflect.Descriptor instead.
+func (*Welcome) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Welcome) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *Welcome) GetProtocolVersion() uint32 {
+	if x != nil {
+		return x.ProtocolVersion
+	}
+	return 0
+}
+
+func (x *Welcome) GetCapabilities() []string {
+	if x != nil {
+		return x.Capabilities
+	}
+	return nil
+}
+
+func (x *Welcome) GetMessageTypes() []string {
+	if x != nil {
+		return x.MessageTypes
+	}
+	return nil
+}
+
+// Reply to a payload the receiver does not support; the connection stays open
+type UnsupportedPayload struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Field         uint32                 `protobuf:"varint,1,opt,name=field,proto3" json:"field,omitempty"` // Message field number of the payload
+	Type          string                 `protobuf:"bytes,2,opt,name=type,proto3" json:"type,omitempty"`    // Message field name of the payload, empty if unknown to the receiver
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UnsupportedPayload) Reset() {
+	*x = UnsupportedPayload{}
+	mi := &file_messages_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UnsupportedPayload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UnsupportedPayload) ProtoMessage() {}
+
+func (x *UnsupportedPayload) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UnsupportedPayload.ProtoReflect.Descriptor instead.
+func (*UnsupportedPayload) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *UnsupportedPayload) GetField() uint32 {
+	if x != nil {
+		return x.Field
+	}
+	return 0
+}
+
+func (x *UnsupportedPayload) GetType() string {
+	if x != nil {
+		return x.Type
+	}
+	return ""
+}
+
+// Publisher reply accepting a request
+type Ack struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	XtId          *XtID                  `protobuf:"bytes,1,opt,name=xt_id,json=xtId,proto3" json:"xt_id,omitempty"` // xT the request created or voted on, empty for other requests
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ack) Reset() {
+	*x = Ack{}
+	mi := &file_messages_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ack) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ack) ProtoMessage() {}
+
+func (x *Ack) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ack.ProtoReflect.Descriptor instead.
+func (*Ack) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *Ack) GetXtId() *XtID {
+	if x != nil {
+		return x.XtId
+	}
+	return nil
+}
+
+// Publisher reply rejecting a request, or reporting a later failure of an accepted xT
+type Error struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Code          string                 `protobuf:"bytes,1,opt,name=code,proto3" json:"code,omitempty"`             // Machine-readable reason, see internal/types/errors.go
+	Message       string                 `protobuf:"bytes,2,opt,name=message,proto3" json:"message,omitempty"`       // Human-readable details
+	XtId          *XtID                  `protobuf:"bytes,3,opt,name=xt_id,json=xtId,proto3" json:"xt_id,omitempty"` // xT the error refers to, if any
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Error) Reset() {
+	*x = Error{}
+	mi := &file_messages_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Error) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Error) ProtoMessage() {}
+
+func (x *Error) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Error.ProtoReflect.Descriptor instead.
+func (*Error) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Error) GetCode() string {
+	if x != nil {
+		return x.Code
+	}
+	return ""
+}
+
+func (x *Error) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Error) GetXtId() *XtID {
+	if x != nil {
+		return x.XtId
+	}
+	return nil
+}
+
+// Heartbeat, answered with a Pong echoing its fields
+type Ping struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Nonce         uint64                 `protobuf:"varint,1,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	SentAt        int64                  `protobuf:"varint,2,opt,name=sent_at,json=sentAt,proto3" json:"sent_at,omitempty"` // Sender clock, Unix nanoseconds
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Ping) Reset() {
+	*x = Ping{}
+	mi := &file_messages_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Ping) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Ping) ProtoMessage() {}
+
+func (x *Ping) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Ping.ProtoReflect.Descriptor instead.
+func (*Ping) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *Ping) GetNonce() uint64 {
+	if x != nil {
+		return x.Nonce
+	}
+	return 0
+}
+
+func (x *Ping) GetSentAt() int64 {
+	if x != nil {
+		return x.SentAt
+	}
+	return 0
+}
+
+type Pong struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Nonce         uint64                 `protobuf:"varint,1,opt,name=nonce,proto3" json:"nonce,omitempty"`
+	SentAt        int64                  `protobuf:"varint,2,opt,name=sent_at,json=sentAt,proto3" json:"sent_at,omitempty"` // Echoed from the Ping
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Pong) Reset() {
+	*x = Pong{}
+	mi := &file_messages_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Pong) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Pong) ProtoMessage() {}
+
+func (x *Pong) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Pong.ProtoReflect.Descriptor instead.
+func (*Pong) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *Pong) GetNonce() uint64 {
+	if x != nil {
+		return x.Nonce
+	}
+	return 0
+}
+
+func (x *Pong) GetSentAt() int64 {
+	if x != nil {
+		return x.SentAt
+	}
+	return 0
+}
+
+// Sent by a publisher that is shutting down. No new requests are read from the
+// connection; replies still pending follow, then the publisher closes it.
+type GoAway struct {
+	state            protoimpl.MessageState `protogen:"open.v1"`
+	Reason           string                 `protobuf:"bytes,1,opt,name=reason,proto3" json:"reason,omitempty"`                                                // Human-readable reason, e.g. "shutdown"
+	ReconnectDelayMs uint64                 `protobuf:"varint,2,opt,name=reconnect_delay_ms,json=reconnectDelayMs,proto3" json:"reconnect_delay_ms,omitempty"` // Suggested wait before reconnecting, 0 leaves it to the client
+	unknownFields    protoimpl.UnknownFields
+	sizeCache        protoimpl.SizeCache
+}
+
+func (x *GoAway) Reset() {
+	*x = GoAway{}
+	mi := &file_messages_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GoAway) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GoAway) ProtoMessage() {}
+
+func (x *GoAway) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GoAway.ProtoReflect.Descriptor instead.
+func (*GoAway) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *GoAway) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+func (x *GoAway) GetReconnectDelayMs() uint64 {
+	if x != nil {
+		return x.ReconnectDelayMs
+	}
+	return 0
+}
+
+// ed25519 signature of a sequencer over the payload of a Message. Envelope
+// fields are not signed, so a relayed message keeps its original signature.
+type Signature struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ChainId       []byte                 `protobuf:"bytes,1,opt,name=chain_id,json=chainId,proto3" json:"chain_id,omitempty"`       // Chain whose key signed
+	PublicKey     []byte                 `protobuf:"bytes,2,opt,name=public_key,json=publicKey,proto3" json:"public_key,omitempty"` // Signing key, must be allowlisted for chain_id
+	Signature     []byte                 `protobuf:"bytes,3,opt,name=signature,proto3" json:"signature,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Signature) Reset() {
+	*x = Signature{}
+	mi := &file_messages_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Signature) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Signature) ProtoMessage() {}
+
+func (x *Signature) ProtoReflect() protoreflect.Message {
+	mi := &file_messages_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Signature.ProtoReflect.Descriptor instead.
+func (*Signature) Descriptor() ([]byte, []int) {
+	return file_messages_proto_rawDescGZIP(), []int{17}
+}
+
+func (x *Signature) GetChainId() []byte {
+	if x != nil {
+		return x.ChainId
+	}
+	return nil
+}
+
+func (x *Signature) GetPublicKey() []byte {
+	if x != nil {
+		return x.PublicKey
+	}
+	return nil
+}
+
+func (x *Signature) GetSignature() []byte {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
 // Wrapper for all messages
 type Message struct {
-	state    protoimpl.MessageState `protogen:"open.v1"`
-	SenderId string                 `protobuf:"bytes,1,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"` // Identifier of the sender
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	SenderId      string                 `protobuf:"bytes,1,opt,name=sender_id,json=senderId,proto3" json:"sender_id,omitempty"`                  // Identifier of the sender
+	Version       uint32                 `protobuf:"varint,13,opt,name=version,proto3" json:"version,omitempty"`                                  // Protocol version the sender encoded the message with, 0 for version 1
+	Sequence      uint64                 `protobuf:"varint,8,opt,name=sequence,proto3" json:"sequence,omitempty"`                                 // Position in the connection's publisher stream, 0 if unsequenced
+	Epoch         uint64                 `protobuf:"varint,9,opt,name=epoch,proto3" json:"epoch,omitempty"`                                       // Publisher epoch the sequence belongs to; sequences restart per epoch and connection
+	CorrelationId uint64                 `protobuf:"varint,19,opt,name=correlation_id,json=correlationId,proto3" json:"correlation_id,omitempty"` // Set by a sender that waits for a reply, unique per connection; 0 otherwise
+	ReplyTo       uint64                 `protobuf:"varint,20,opt,name=reply_to,json=replyTo,proto3" json:"reply_to,omitempty"`                   // correlation_id of the request this message answers, 0 if unsolicited
+	Signature     *Signature             `protobuf:"bytes,21,opt,name=signature,proto3" json:"signature,omitempty"`                               // Signature of the sequencer that created the payload, if signed
 	// Types that are valid to be assigned to Payload:
 	//
 	//	*Message_XtRequest
+	//	*Message_Vote
+	//	*Message_Decided
+	//	*Message_StartSlot
+	//	*Message_RequestSeal
+	//	*Message_BlockSealed
+	//	*Message_Hello
+	//	*Message_Welcome
+	//	*Message_Unroutable
+	//	*Message_Unsupported
+	//	*Message_Ack
+	//	*Message_Error
+	//	*Message_Ping
+	//	*Message_Pong
+	//	*Message_GoAway
 	Payload       isMessage_Payload `protobuf_oneof:"payload"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
@@ -133,7 +1050,7 @@ type Message struct {
 
 func (x *Message) Reset() {
 	*x = Message{}
-	mi := &file_messages_proto_msgTypes[2]
+	mi := &file_messages_proto_msgTypes[18]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -145,7 +1062,7 @@ func (x *Message) String() string {
 func (*Message) ProtoMessage() {}
 
 func (x *Message) ProtoReflect() protoreflect.Message {
-	mi := &file_messages_proto_msgTypes[2]
+	mi := &file_messages_proto_msgTypes[18]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -158,7 +1075,7 @@ func (x *Message) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use Message.ProtoReflect.Descriptor instead.
 func (*Message) Descriptor() ([]byte, []int) {
-	return file_messages_proto_rawDescGZIP(), []int{2}
+	return file_messages_proto_rawDescGZIP(), []int{18}
 }
 
 func (x *Message) GetSenderId() string {
@@ -168,6 +1085,48 @@ func (x *Message) GetSenderId() string {
 	return ""
 }
 
+func (x *Message) GetVersion() uint32 {
+	if x != nil {
+		return x.Version
+	}
+	return 0
+}
+
+func (x *Message) GetSequence() uint64 {
+	if x != nil {
+		return x.Sequence
+	}
+	return 0
+}
+
+func (x *Message) GetEpoch() uint64 {
+	if x != nil {
+		return x.Epoch
+	}
+	return 0
+}
+
+func (x *Message) GetCorrelationId() uint64 {
+	if x != nil {
+		return x.CorrelationId
+	}
+	return 0
+}
+
+func (x *Message) GetReplyTo() uint64 {
+	if x != nil {
+		return x.ReplyTo
+	}
+	return 0
+}
+
+func (x *Message) GetSignature() *Signature {
+	if x != nil {
+		return x.Signature
+	}
+	return nil
+}
+
 func (x *Message) GetPayload() isMessage_Payload {
 	if x != nil {
 		return x.Payload
@@ -184,6 +1143,132 @@ func (x *Message) GetXtRequest() *XTRequest {
 	return nil
 }
 
+func (x *Message) GetVote() *Vote {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_Vote); ok {
+			return x.Vote
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetDecided() *Decided {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_Decided); ok {
+			return x.Decided
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetStartSlot() *StartSlot {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_StartSlot); ok {
+			return x.StartSlot
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetRequestSeal() *RequestSeal {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_RequestSeal); ok {
+			return x.RequestSeal
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetBlockSealed() *BlockSealed {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_BlockSealed); ok {
+			return x.BlockSealed
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetHello() *Hello {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_Hello); ok {
+			return x.Hello
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetWelcome() *Welcome {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_Welcome); ok {
+			return x.Welcome
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetUnroutable() *Unroutable {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_Unroutable); ok {
+			return x.Unroutable
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetUnsupported() *UnsupportedPayload {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_Unsupported); ok {
+			return x.Unsupported
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetAck() *Ack {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_Ack); ok {
+			return x.Ack
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetError() *Error {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_Error); ok {
+			return x.Error
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetPing() *Ping {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_Ping); ok {
+			return x.Ping
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetPong() *Pong {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_Pong); ok {
+			return x.Pong
+		}
+	}
+	return nil
+}
+
+func (x *Message) GetGoAway() *GoAway {
+	if x != nil {
+		if x, ok := x.Payload.(*Message_GoAway); ok {
+			return x.GoAway
+		}
+	}
+	return nil
+}
+
 type isMessage_Payload interface {
 	isMessage_Payload()
 }
@@ -192,8 +1277,92 @@ type Message_XtRequest struct {
 	XtRequest *XTRequest `protobuf:"bytes,2,opt,name=xt_request,json=xtRequest,proto3,oneof"`
 }
 
+type Message_Vote struct {
+	Vote *Vote `protobuf:"bytes,3,opt,name=vote,proto3,oneof"`
+}
+
+type Message_Decided struct {
+	Decided *Decided `protobuf:"bytes,4,opt,name=decided,proto3,oneof"`
+}
+
+type Message_StartSlot struct {
+	StartSlot *StartSlot `protobuf:"bytes,5,opt,name=start_slot,json=startSlot,proto3,oneof"`
+}
+
+type Message_RequestSeal struct {
+	RequestSeal *RequestSeal `protobuf:"bytes,6,opt,name=request_seal,json=requestSeal,proto3,oneof"`
+}
+
+type Message_BlockSealed struct {
+	BlockSealed *BlockSealed `protobuf:"bytes,7,opt,name=block_sealed,json=blockSealed,proto3,oneof"`
+}
+
+type Message_Hello struct {
+	Hello *Hello `protobuf:"bytes,10,opt,name=hello,proto3,oneof"`
+}
+
+type Message_Welcome struct {
+	Welcome *Welcome `protobuf:"bytes,11,opt,name=welcome,proto3,oneof"`
+}
+
+type Message_Unroutable struct {
+	Unroutable *Unroutable `protobuf:"bytes,12,opt,name=unroutable,proto3,oneof"`
+}
+
+type Message_Unsupported struct {
+	Unsupported *UnsupportedPayload `protobuf:"bytes,14,opt,name=unsupported,proto3,oneof"`
+}
+
+type Message_Ack struct {
+	Ack *Ack `protobuf:"bytes,15,opt,name=ack,proto3,oneof"`
+}
+
+type Message_Error struct {
+	Error *Error `protobuf:"bytes,16,opt,name=error,proto3,oneof"`
+}
+
+type Message_Ping struct {
+	Ping *Ping `protobuf:"bytes,17,opt,name=ping,proto3,oneof"`
+}
+
+type Message_Pong struct {
+	Pong *Pong `protobuf:"bytes,18,opt,name=pong,proto3,oneof"`
+}
+
+type Message_GoAway struct {
+	GoAway *GoAway `protobuf:"bytes,22,opt,name=go_away,json=goAway,proto3,oneof"`
+}
+
 func (*Message_XtRequest) isMessage_Payload() {}
 
+func (*Message_Vote) isMessage_Payload() {}
+
+func (*Message_Decided) isMessage_Payload() {}
+
+func (*Message_StartSlot) isMessage_Payload() {}
+
+func (*Message_RequestSeal) isMessage_Payload() {}
+
+func (*Message_BlockSealed) isMessage_Payload() {}
+
+func (*Message_Hello) isMessage_Payload() {}
+
+func (*Message_Welcome) isMessage_Payload() {}
+
+func (*Message_Unroutable) isMessage_Payload() {}
+
+func (*Message_Unsupported) isMessage_Payload() {}
+
+func (*Message_Ack) isMessage_Payload() {}
+
+func (*Message_Error) isMessage_Payload() {}
+
+func (*Message_Ping) isMessage_Payload() {}
+
+func (*Message_Pong) isMessage_Payload() {}
+
+func (*Message_GoAway) isMessage_Payload() {}
+
 var File_messages_proto protoreflect.FileDescriptor
 
 const file_messages_proto_rawDesc = "" +
@@ -203,11 +1372,94 @@ const file_messages_proto_rawDesc = "" +
 	"\ftransactions\x18\x01 \x03(\v2\x17.poc.TransactionRequestR\ftransactions\"Q\n" +
 	"\x12TransactionRequest\x12\x19\n" +
 	"\bchain_id\x18\x01 \x01(\fR\achainId\x12 \n" +
-	"\vtransaction\x18\x02 \x03(\fR\vtransaction\"b\n" +
+	"\vtransaction\x18\x02 \x03(\fR\vtransaction\"\x1a\n" +
+	"\x04XtID\x12\x12\n" +
+	"\x04hash\x18\x01 \x01(\fR\x04hash\"b\n" +
+	"\x04Vote\x12&\n" +
+	"\x0fsender_chain_id\x18\x01 \x01(\fR\rsenderChainId\x12\x1e\n" +
+	"\x05xt_id\x18\x02 \x01(\v2\t.poc.XtIDR\x04xtId\x12\x12\n" +
+	"\x04vote\x18\x03 \x01(\bR\x04vote\"E\n" +
+	"\aDecided\x12\x1e\n" +
+	"\x05xt_id\x18\x01 \x01(\v2\t.poc.XtIDR\x04xtId\x12\x1a\n" +
+	"\bdecision\x18\x02 \x01(\bR\bdecision\"I\n" +
+	"\n" +
+	"Unroutable\x12\x1e\n" +
+	"\x05xt_id\x18\x01 \x01(\v2\t.poc.XtIDR\x04xtId\x12\x1b\n" +
+	"\tchain_ids\x18\x02 \x03(\fR\bchainIds\"=\n" +
+	"\tStartSlot\x12\x12\n" +
+	"\x04slot\x18\x01 \x01(\x04R\x04slot\x12\x1c\n" +
+	"\ttimestamp\x18\x02 \x01(\x03R\ttimestamp\"!\n" +
+	"\vRequestSeal\x12\x12\n" +
+	"\x04slot\x18\x01 \x01(\x04R\x04slot\"~\n" +
+	"\vBlockSealed\x12\x12\n" +
+	"\x04slot\x18\x01 \x01(\x04R\x04slot\x12\x19\n" +
+	"\bchain_id\x18\x02 \x01(\fR\achainId\x12!\n" +
+	"\fblock_number\x18\x03 \x01(\x04R\vblockNumber\x12\x1d\n" +
+	"\n" +
+	"block_hash\x18\x04 \x01(\fR\tblockHash\"\x85\x01\n" +
+	"\x05Hello\x12\x19\n" +
+	"\bchain_id\x18\x01 \x01(\fR\achainId\x12\x12\n" +
+	"\x04name\x18\x02 \x01(\tR\x04name\x12)\n" +
+	"\x10protocol_version\x18\x03 \x01(\rR\x0fprotocolVersion\x12\"\n" +
+	"\fcapabilities\x18\x04 \x03(\tR\fcapabilities\"\xa2\x01\n" +
+	"\aWelcome\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\x12)\n" +
+	"\x10protocol_version\x18\x02 \x01(\rR\x0fprotocolVersion\x12\"\n" +
+	"\fcapabilities\x18\x03 \x03(\tR\fcapabilities\x12#\n" +
+	"\rmessage_types\x18\x04 \x03(\tR\fmessageTypes\">\n" +
+	"\x12UnsupportedPayload\x12\x14\n" +
+	"\x05field\x18\x01 \x01(\rR\x05field\x12\x12\n" +
+	"\x04type\x18\x02 \x01(\tR\x04type\"%\n" +
+	"\x03Ack\x12\x1e\n" +
+	"\x05xt_id\x18\x01 \x01(\v2\t.poc.XtIDR\x04xtId\"U\n" +
+	"\x05Error\x12\x12\n" +
+	"\x04code\x18\x01 \x01(\tR\x04code\x12\x18\n" +
+	"\amessage\x18\x02 \x01(\tR\amessage\x12\x1e\n" +
+	"\x05xt_id\x18\x03 \x01(\v2\t.poc.XtIDR\x04xtId\"5\n" +
+	"\x04Ping\x12\x14\n" +
+	"\x05nonce\x18\x01 \x01(\x04R\x05nonce\x12\x17\n" +
+	"\asent_at\x18\x02 \x01(\x03R\x06sentAt\"5\n" +
+	"\x04Pong\x12\x14\n" +
+	"\x05nonce\x18\x01 \x01(\x04R\x05nonce\x12\x17\n" +
+	"\asent_at\x18\x02 \x01(\x03R\x06sentAt\"N\n" +
+	"\x06GoAway\x12\x16\n" +
+	"\x06reason\x18\x01 \x01(\tR\x06reason\x12,\n" +
+	"\x12reconnect_delay_ms\x18\x02 \x01(\x04R\x10reconnectDelayMs\"c\n" +
+	"\tSignature\x12\x19\n" +
+	"\bchain_id\x18\x01 \x01(\fR\achainId\x12\x1d\n" +
+	"\n" +
+	"public_key\x18\x02 \x01(\fR\tpublicKey\x12\x1c\n" +
+	"\tsignature\x18\x03 \x01(\fR\tsignature\"\xf2\x06\n" +
 	"\aMessage\x12\x1b\n" +
-	"\tsender_id\x18\x01 \x01(\tR\bsenderId\x12/\n" +
+	"\tsender_id\x18\x01 \x01(\tR\bsenderId\x12\x18\n" +
+	"\aversion\x18\r \x01(\rR\aversion\x12\x1a\n" +
+	"\bsequence\x18\b \x01(\x04R\bsequence\x12\x14\n" +
+	"\x05epoch\x18\t \x01(\x04R\x05epoch\x12%\n" +
+	"\x0ecorrelation_id\x18\x13 \x01(\x04R\rcorrelationId\x12\x19\n" +
+	"\breply_to\x18\x14 \x01(\x04R\areplyTo\x12,\n" +
+	"\tsignature\x18\x15 \x01(\v2\x0e.poc.SignatureR\tsignature\x12/\n" +
+	"\n" +
+	"xt_request\x18\x02 \x01(\v2\x0e.poc.XTRequestH\x00R\txtRequest\x12\x1f\n" +
+	"\x04vote\x18\x03 \x01(\v2\t.poc.VoteH\x00R\x04vote\x12(\n" +
+	"\adecided\x18\x04 \x01(\v2\f.poc.DecidedH\x00R\adecided\x12/\n" +
+	"\n" +
+	"start_slot\x18\x05 \x01(\v2\x0e.poc.StartSlotH\x00R\tstartSlot\x125\n" +
+	"\frequest_seal\x18\x06 \x01(\v2\x10.poc.RequestSealH\x00R\vrequestSeal\x125\n" +
+	"\fblock_sealed\x18\a \x01(\v2\x10.poc.BlockSealedH\x00R\vblockSealed\x12\"\n" +
+	"\x05hello\x18\n" +
+	" \x01(\v2\n" +
+	".poc.HelloH\x00R\x05hello\x12(\n" +
+	"\awelcome\x18\v \x01(\v2\f.poc.WelcomeH\x00R\awelcome\x121\n" +
 	"\n" +
-	"xt_request\x18\x02 \x01(\v2\x0e.poc.XTRequestH\x00R\txtRequestB\t\n" +
+	"unroutable\x18\f \x01(\v2\x0f.poc.UnroutableH\x00R\n" +
+	"unroutable\x12;\n" +
+	"\vunsupported\x18\x0e \x01(\v2\x17.poc.UnsupportedPayloadH\x00R\vunsupported\x12\x1c\n" +
+	"\x03ack\x18\x0f \x01(\v2\b.poc.AckH\x00R\x03ack\x12\"\n" +
+	"\x05error\x18\x10 \x01(\v2\n" +
+	".poc.ErrorH\x00R\x05error\x12\x1f\n" +
+	"\x04ping\x18\x11 \x01(\v2\t.poc.PingH\x00R\x04ping\x12\x1f\n" +
+	"\x04pong\x18\x12 \x01(\v2\t.poc.PongH\x00R\x04pong\x12&\n" +
+	"\ago_away\x18\x16 \x01(\v2\v.poc.GoAwayH\x00R\x06goAwayB\t\n" +
 	"\apayloadB9Z7github.com/ssv-labs/poc-shared-publisher/internal/protob\x06proto3"
 
 var (
@@ -222,20 +1474,56 @@ func file_messages_proto_rawDescGZIP() []byte {
 	return file_messages_proto_rawDescData
 }
 
-var file_messages_proto_msgTypes = make([]protoimpl.MessageInfo, 3)
+var file_messages_proto_msgTypes = make([]protoimpl.MessageInfo, 19)
 var file_messages_proto_goTypes = []any{
 	(*XTRequest)(nil),          // 0: poc.XTRequest
 	(*TransactionRequest)(nil), // 1: poc.TransactionRequest
-	(*Message)(nil),            // 2: poc.Message
+	(*XtID)(nil),               // 2: poc.XtID
+	(*Vote)(nil),               // 3: poc.Vote
+	(*Decided)(nil),            // 4: poc.Decided
+	(*Unroutable)(nil),         // 5: poc.Unroutable
+	(*StartSlot)(nil),          // 6: poc.StartSlot
+	(*RequestSeal)(nil),        // 7: poc.RequestSeal
+	(*BlockSealed)(nil),        // 8: poc.BlockSealed
+	(*Hello)(nil),              // 9: poc.Hello
+	(*Welcome)(nil),            // 10: poc.Welcome
+	(*UnsupportedPayload)(nil), // 11: poc.UnsupportedPayload
+	(*Ack)(nil),                // 12: poc.Ack
+	(*Error)(nil),              // 13: poc.Error
+	(*Ping)(nil),               // 14: poc.Ping
+	(*Pong)(nil),               // 15: poc.Pong
+	(*GoAway)(nil),             // 16: poc.GoAway
+	(*Signature)(nil),          // 17: poc.Signature
+	(*Message)(nil),            // 18: poc.Message
 }
 var file_messages_proto_depIdxs = []int32{
-	1, // 0: poc.XTRequest.transactions:type_name -> poc.TransactionRequest
-	0, // 1: poc.Message.xt_request:type_name -> poc.XTRequest
-	2, // [2:2] is the sub-list for method output_type
-	2, // [2:2] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	1,  // 0: poc.XTRequest.transactions:type_name -> poc.TransactionRequest
+	2,  // 1: poc.Vote.xt_id:type_name -> poc.XtID
+	2,  // 2: poc.Decided.xt_id:type_name -> poc.XtID
+	2,  // 3: poc.Unroutable.xt_id:type_name -> poc.XtID
+	2,  // 4: poc.Ack.xt_id:type_name -> poc.XtID
+	2,  // 5: poc.Error.xt_id:type_name -> poc.XtID
+	17, // 6: poc.Message.signature:type_name -> poc.Signature
+	0,  // 7: poc.Message.xt_request:type_name -> poc.XTRequest
+	3,  // 8: poc.Message.vote:type_name -> poc.Vote
+	4,  // 9: poc.Message.decided:type_name -> poc.Decided
+	6,  // 10: poc.Message.start_slot:type_name -> poc.StartSlot
+	7,  // 11: poc.Message.request_seal:type_name -> poc.RequestSeal
+	8,  // 12: poc.Message.block_sealed:type_name -> poc.BlockSealed
+	9,  // 13: poc.Message.hello:type_name -> poc.Hello
+	10, // 14: poc.Message.welcome:type_name -> poc.Welcome
+	5,  // 15: poc.Message.unroutable:type_name -> poc.Unroutable
+	11, // 16: poc.Message.unsupported:type_name -> poc.UnsupportedPayload
+	12, // 17: poc.Message.ack:type_name -> poc.Ack
+	13, // 18: poc.Message.error:type_name -> poc.Error
+	14, // 19: poc.Message.ping:type_name -> poc.Ping
+	15, // 20: poc.Message.pong:type_name -> poc.Pong
+	16, // 21: poc.Message.go_away:type_name -> poc.GoAway
+	22, // [22:22] is the sub-list for method output_type
+	22, // [22:22] is the sub-list for method input_type
+	22, // [22:22] is the sub-list for extension type_name
+	22, // [22:22] is the sub-list for extension extendee
+	0,  // [0:22] is the sub-list for field type_name
 }
 
 func init() { file_messages_proto_init() }
@@ -243,8 +1531,22 @@ func file_messages_proto_init() {
 	if File_messages_proto != nil {
 		return
 	}
-	file_messages_proto_msgTypes[2].OneofWrappers = []any{
+	file_messages_proto_msgTypes[18].OneofWrappers = []any{
 		(*Message_XtRequest)(nil),
+		(*Message_Vote)(nil),
+		(*Message_Decided)(nil),
+		(*Message_StartSlot)(nil),
+		(*Message_RequestSeal)(nil),
+		(*Message_BlockSealed)(nil),
+		(*Message_Hello)(nil),
+		(*Message_Welcome)(nil),
+		(*Message_Unroutable)(nil),
+		(*Message_Unsupported)(nil),
+		(*Message_Ack)(nil),
+		(*Message_Error)(nil),
+		(*Message_Ping)(nil),
+		(*Message_Pong)(nil),
+		(*Message_GoAway)(nil),
 	}
 	type x struct{}
 	out := protoimpl.TypeBuilder{
@@ -252,7 +1554,7 @@ func file_messages_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_messages_proto_rawDesc), len(file_messages_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   3,
+			NumMessages:   19,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,27 @@
+package proto
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// XtID computes the cross-chain transaction ID of the request.
+// The ID is the SHA-256 hash of the deterministic encoding of the request,
+// so every participant derives the same ID from the relayed XTRequest.
+func (x *XTRequest) XtID() (*XtID, error) {
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(x)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal xT request: %w", err)
+	}
+
+	hash := sha256.Sum256(data)
+	return &XtID{Hash: hash[:]}, nil
+}
+
+// Hex returns the hex encoded hash of the ID.
+func (x *XtID) Hex() string {
+	return hex.EncodeToString(x.GetHash())
+}
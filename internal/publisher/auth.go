@@ -0,0 +1,56 @@
+package publisher
+
+import (
+	"fmt"
+
+	"github.com/kchojn/poc-shared-publisher/internal/auth"
+	"github.com/kchojn/poc-shared-publisher/internal/config"
+	"github.com/kchojn/poc-shared-publisher/internal/network"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/pkg/metrics"
+)
+
+// openKeyring loads the signing key allowlist unless verification is off.
+func (p *Publisher) openKeyring() error {
+	if p.cfg.Auth.Mode != config.AuthModeFlag && p.cfg.Auth.Mode != config.AuthModeEnforce {
+		return nil
+	}
+
+	keyring, err := auth.NewKeyring(p.cfg.Auth.Keys)
+	if err != nil {
+		return fmt.Errorf("failed to load auth keys: %w", err)
+	}
+	p.keyring = keyring
+
+	return nil
+}
+
+// authenticate verifies the signature of a message from a sequencer. In flag
+// mode a failure is only logged and counted, and the message is handled anyway.
+func (p *Publisher) authenticate(from string, msg *pb.Message) error {
+	if p.keyring == nil {
+		return nil
+	}
+
+	err := p.keyring.Verify(msg)
+	if err == nil {
+		return nil
+	}
+
+	reason := auth.Reason(err)
+	metrics.MessagesUnauthenticated.WithLabelValues(reason).Inc()
+
+	enforced := p.cfg.Auth.Mode == config.AuthModeEnforce
+	p.log.Warn().
+		Err(err).
+		Str("from", from).
+		Str("type", network.PayloadType(msg)).
+		Str("reason", reason).
+		Bool("rejected", enforced).
+		Msg("Message failed signature verification")
+
+	if !enforced {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,140 @@
+package publisher
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kchojn/poc-shared-publisher/internal/auth"
+	"github.com/kchojn/poc-shared-publisher/internal/config"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/internal/types"
+)
+
+func TestPublisher_VerifiesSignatures(t *testing.T) {
+	t.Parallel()
+
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+
+	_, keyA, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	_, keyB, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	authConfig := func(mode string) config.AuthConfig {
+		return config.AuthConfig{Mode: mode, Keys: map[string][]string{
+			"0x01": {hex.EncodeToString(keyA.Public().(ed25519.PublicKey))},
+			"0x02": {hex.EncodeToString(keyB.Public().(ed25519.PublicKey))},
+		}}
+	}
+
+	signed := func(chainID []byte, key ed25519.PrivateKey, msg *pb.Message) *pb.Message {
+		require.NoError(t, auth.NewSigner(chainID, key).Sign(msg))
+		return msg
+	}
+
+	tests := []struct {
+		name     string
+		mode     string
+		msg      *pb.Message
+		wantCode types.ErrorCode // Empty expects an Ack
+	}{
+		{
+			name: "signed request",
+			mode: config.AuthModeEnforce,
+			msg:  signed(chainA, keyA, newXTRequestMessage(chainA, chainB)),
+		},
+		{
+			name:     "unsigned request",
+			mode:     config.AuthModeEnforce,
+			msg:      newXTRequestMessage(chainA, chainB),
+			wantCode: types.ErrCodeUnauthenticated,
+		},
+		{
+			name:     "forged vote",
+			mode:     config.AuthModeEnforce,
+			msg:      signed(chainB, keyB, newVoteMessage(chainA, &pb.XtID{Hash: []byte{0x01}}, false)),
+			wantCode: types.ErrCodeUnauthenticated,
+		},
+		{
+			name: "unsigned request flagged",
+			mode: config.AuthModeFlag,
+			msg:  newXTRequestMessage(chainA, chainB),
+		},
+		{
+			name: "verification off",
+			mode: config.AuthModeOff,
+			msg:  newXTRequestMessage(chainA, chainB),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			cfg := newTestConfig("")
+			cfg.Auth = authConfig(tt.mode)
+
+			srv := newFakeServer()
+			srv.connectChain("conn-a", "0x01")
+			srv.connectChain("conn-b", "0x02")
+			p := New(cfg, srv, zerolog.Nop())
+			require.NoError(t, p.Start(ctx))
+
+			err := p.handleMessage(ctx, "conn-a", tt.msg)
+
+			reply := lastReply(t, srv, "conn-a")
+			if tt.wantCode == "" {
+				require.NoError(t, err)
+				assert.NotNil(t, reply.GetAck())
+				return
+			}
+
+			require.Error(t, err)
+			require.NotNil(t, reply.GetError())
+			assert.Equal(t, string(tt.wantCode), reply.GetError().Code)
+			assert.Empty(t, srv.sentTo("conn-b"), "rejected messages are not acted on")
+		})
+	}
+}
+
+func TestPublisher_RelaysSignedRequests(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+	_, keyA, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+
+	keys := map[string][]string{"0x01": {hex.EncodeToString(keyA.Public().(ed25519.PublicKey))}}
+	cfg := newTestConfig("")
+	cfg.Auth = config.AuthConfig{Mode: config.AuthModeEnforce, Keys: keys}
+
+	srv := newFakeServer()
+	srv.connectChain("conn-a", "0x01")
+	srv.connectChain("conn-b", "0x02")
+	p := New(cfg, srv, zerolog.Nop())
+	require.NoError(t, p.Start(ctx))
+
+	msg := newXTRequestMessage(chainA, chainB)
+	require.NoError(t, auth.NewSigner(chainA, keyA).Sign(msg))
+	require.NoError(t, p.handleMessage(ctx, "conn-a", msg))
+
+	relayed := srv.sentTo("conn-b")
+	require.Len(t, relayed, 1)
+
+	// The recipient verifies the origin with its own copy of the allowlist
+	keyring, err := auth.NewKeyring(keys)
+	require.NoError(t, err)
+	assert.NoError(t, keyring.Verify(relayed[0]))
+}
@@ -4,15 +4,23 @@ import (
 	"encoding/json"
 	"net/http"
 	"runtime"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
 )
 
+// defaultXTLimit is the number of xTs listed by /xt without a limit parameter.
+const defaultXTLimit = 100
+
 // HTTPHandler provides HTTP endpoints.
 type HTTPHandler struct {
 	publisher *Publisher
+	member    *Member // Set in cluster mode, where the publisher changes with leadership
 	log       zerolog.Logger
 	startTime time.Time
 }
@@ -26,6 +34,16 @@ func NewHTTPHandler(p *Publisher, log zerolog.Logger) *HTTPHandler {
 	}
 }
 
+// NewClusterHTTPHandler creates an HTTP handler for a cluster member.
+// Publisher endpoints answer 503 with the current leader on followers.
+func NewClusterHTTPHandler(m *Member, log zerolog.Logger) *HTTPHandler {
+	return &HTTPHandler{
+		member:    m,
+		log:       log.With().Str("component", "http").Logger(),
+		startTime: time.Now(),
+	}
+}
+
 // RegisterRoutes registers HTTP routes.
 func (h *HTTPHandler) RegisterRoutes() http.Handler {
 	mux := http.NewServeMux()
@@ -33,6 +51,7 @@ func (h *HTTPHandler) RegisterRoutes() http.Handler {
 	// Health and readiness
 	mux.HandleFunc("/health", h.handleHealth)
 	mux.HandleFunc("/ready", h.handleReady)
+	mux.HandleFunc("/cluster", h.handleCluster)
 
 	// Metrics
 	mux.Handle("/metrics", promhttp.Handler())
@@ -40,6 +59,8 @@ func (h *HTTPHandler) RegisterRoutes() http.Handler {
 	// Debug endpoints
 	mux.HandleFunc("/stats", h.handleStats)
 	mux.HandleFunc("/connections", h.handleConnections)
+	mux.HandleFunc("/xt", h.handleXTs)
+	mux.HandleFunc("/xt/{id}", h.handleXT)
 	mux.HandleFunc("/debug/vars", h.handleDebugVars)
 
 	return h.loggingMiddleware(mux)
@@ -64,6 +85,30 @@ func (h *HTTPHandler) loggingMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// current returns the publisher serving sequencers, or nil on cluster followers.
+func (h *HTTPHandler) current() *Publisher {
+	if h.member != nil {
+		return h.member.Publisher()
+	}
+	return h.publisher
+}
+
+// writeNotLeader tells the caller which member serves sequencers.
+func (h *HTTPHandler) writeNotLeader(w http.ResponseWriter) {
+	status := h.member.Status()
+
+	response := map[string]interface{}{
+		"status":      "not_leader",
+		"role":        status.Role,
+		"leader_id":   status.LeaderID,
+		"leader_addr": status.LeaderAddr,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(response)
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -87,8 +132,14 @@ func (h *HTTPHandler) handleHealth(w http.ResponseWriter, r *http.Request) {
 
 // handleReady returns readiness status.
 func (h *HTTPHandler) handleReady(w http.ResponseWriter, r *http.Request) {
+	pub := h.current()
+	if pub == nil {
+		h.writeNotLeader(w)
+		return
+	}
+
 	// Check if we have any connections
-	stats := h.publisher.GetStats()
+	stats := pub.GetStats()
 	connections := stats["active_connections"].(int)
 
 	status := "ready"
@@ -108,9 +159,26 @@ func (h *HTTPHandler) handleReady(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleCluster returns the cluster state, including where sequencers should connect.
+func (h *HTTPHandler) handleCluster(w http.ResponseWriter, r *http.Request) {
+	var response interface{} = map[string]interface{}{"enabled": false}
+	if h.member != nil {
+		response = h.member.Status()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // handleStats returns publisher statistics.
 func (h *HTTPHandler) handleStats(w http.ResponseWriter, r *http.Request) {
-	stats := h.publisher.GetStats()
+	pub := h.current()
+	if pub == nil {
+		h.writeNotLeader(w)
+		return
+	}
+
+	stats := pub.GetStats()
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
@@ -118,7 +186,13 @@ func (h *HTTPHandler) handleStats(w http.ResponseWriter, r *http.Request) {
 
 // handleConnections returns connection details.
 func (h *HTTPHandler) handleConnections(w http.ResponseWriter, r *http.Request) {
-	connections := h.publisher.server.GetConnections()
+	pub := h.current()
+	if pub == nil {
+		h.writeNotLeader(w)
+		return
+	}
+
+	connections := pub.server.GetConnections()
 
 	response := map[string]interface{}{
 		"count":       len(connections),
@@ -129,9 +203,90 @@ func (h *HTTPHandler) handleConnections(w http.ResponseWriter, r *http.Request)
 	json.NewEncoder(w).Encode(response)
 }
 
+// handleXTs lists recent xTs, newest first. Supported query parameters:
+// chain_id (e.g. 0x1234), state (queued, voting, committed, aborted) and limit.
+func (h *HTTPHandler) handleXTs(w http.ResponseWriter, r *http.Request) {
+	pub := h.current()
+	if pub == nil {
+		h.writeNotLeader(w)
+		return
+	}
+
+	query := r.URL.Query()
+	filter := XTFilter{
+		State: XTState(query.Get("state")),
+		Limit: defaultXTLimit,
+	}
+
+	// Compared as bytes, so 0x1, 01 and 0x01 all select chain 0x01
+	if chainID := query.Get("chain_id"); chainID != "" {
+		id, err := pb.ParseChainID(chainID)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid chain_id")
+			return
+		}
+		filter.ChainID = pb.FormatChainID(id)
+	}
+
+	switch filter.State {
+	case "", XTStateQueued, XTStateVoting, XTStateCommitted, XTStateAborted:
+	default:
+		writeError(w, http.StatusBadRequest, "invalid state")
+		return
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		filter.Limit = min(n, xtHistorySize)
+	}
+
+	xts := pub.ListXTs(filter)
+
+	response := map[string]interface{}{
+		"count": len(xts),
+		"xts":   xts,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleXT returns a single recent xT by its hex ID.
+func (h *HTTPHandler) handleXT(w http.ResponseWriter, r *http.Request) {
+	pub := h.current()
+	if pub == nil {
+		h.writeNotLeader(w)
+		return
+	}
+
+	id := strings.TrimPrefix(strings.ToLower(r.PathValue("id")), "0x")
+
+	xt, ok := pub.GetXT(id)
+	if !ok {
+		writeError(w, http.StatusNotFound, "xT not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(xt)
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
 // handleDebugVars returns debug variables.
 func (h *HTTPHandler) handleDebugVars(w http.ResponseWriter, r *http.Request) {
-	stats := h.publisher.GetStats()
+	var stats map[string]interface{}
+	if pub := h.current(); pub != nil {
+		stats = pub.GetStats()
+	}
 
 	// Add runtime stats
 	var m runtime.MemStats
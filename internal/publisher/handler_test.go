@@ -0,0 +1,121 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPHandler_XT(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainA, chainB, chainC := []byte{0x01}, []byte{0x02}, []byte{0x03}
+
+	srv := newFakeServer()
+	srv.connectChain("conn-a", "0x01")
+	srv.connectChain("conn-b", "0x02")
+	srv.connectChain("conn-c", "0x03")
+	p := New(newTestConfig(""), srv, zerolog.Nop())
+	require.NoError(t, p.Start(ctx))
+
+	committed := newXTRequestMessage(chainA, chainB)
+	committedID, err := committed.GetXtRequest().XtID()
+	require.NoError(t, err)
+
+	voting := newXTRequestMessage(chainB, chainC)
+	votingID, err := voting.GetXtRequest().XtID()
+	require.NoError(t, err)
+
+	require.NoError(t, p.handleMessage(ctx, "conn-a", committed))
+	require.NoError(t, p.handleMessage(ctx, "conn-a", voting)) // Queued behind the first on chain B
+	require.NoError(t, p.handleMessage(ctx, "conn-a", newVoteMessage(chainA, committedID, true)))
+	require.NoError(t, p.handleMessage(ctx, "conn-b", newVoteMessage(chainB, committedID, true)))
+	require.NoError(t, p.handleMessage(ctx, "conn-c", newVoteMessage(chainC, votingID, true)))
+
+	handler := NewHTTPHandler(p, zerolog.Nop()).RegisterRoutes()
+
+	get := func(t *testing.T, path string, out interface{}) int {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if out != nil && rec.Code == http.StatusOK {
+			require.NoError(t, json.Unmarshal(rec.Body.Bytes(), out))
+		}
+		return rec.Code
+	}
+
+	type list struct {
+		Count int      `json:"count"`
+		XTs   []XTInfo `json:"xts"`
+	}
+
+	tests := []struct {
+		name string
+		path string
+		want []string
+	}{
+		{name: "all, newest first", path: "/xt", want: []string{votingID.Hex(), committedID.Hex()}},
+		{name: "by chain", path: "/xt?chain_id=0x01", want: []string{committedID.Hex()}},
+		{name: "by chain without prefix", path: "/xt?chain_id=03", want: []string{votingID.Hex()}},
+		{name: "by chain without leading zero", path: "/xt?chain_id=0x1", want: []string{committedID.Hex()}},
+		{name: "by chain in upper case", path: "/xt?chain_id=0X3", want: []string{votingID.Hex()}},
+		{name: "by state", path: "/xt?state=committed", want: []string{committedID.Hex()}},
+		{name: "by chain and state", path: "/xt?chain_id=0x02&state=voting", want: []string{votingID.Hex()}},
+		{name: "no match", path: "/xt?state=aborted", want: []string{}},
+		{name: "limit", path: "/xt?limit=1", want: []string{votingID.Hex()}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got list
+			require.Equal(t, http.StatusOK, get(t, tt.path, &got))
+
+			ids := make([]string, 0, len(got.XTs))
+			for _, xt := range got.XTs {
+				ids = append(ids, xt.ID)
+			}
+			assert.Equal(t, tt.want, ids)
+			assert.Equal(t, len(tt.want), got.Count)
+		})
+	}
+
+	t.Run("single xT", func(t *testing.T) {
+		var xt XTInfo
+		require.Equal(t, http.StatusOK, get(t, "/xt/"+committedID.Hex(), &xt))
+
+		assert.Equal(t, XTStateCommitted, xt.State)
+		assert.Equal(t, "seq", xt.Sender)
+		assert.Equal(t, "conn-a", xt.ConnectionID)
+		assert.Equal(t, []string{"0x01", "0x02"}, xt.Chains)
+		assert.True(t, xt.Votes["0x01"].Vote)
+		assert.True(t, xt.Votes["0x02"].Vote)
+		assert.NotNil(t, xt.StartedAt)
+		assert.NotNil(t, xt.DecidedAt)
+		assert.NotNil(t, xt.DeliveredAt)
+	})
+
+	t.Run("votes of the released xT", func(t *testing.T) {
+		var xt XTInfo
+		require.Equal(t, http.StatusOK, get(t, "/xt/0x"+votingID.Hex(), &xt))
+
+		assert.Equal(t, XTStateVoting, xt.State)
+		assert.Len(t, xt.Votes, 1)
+		assert.Nil(t, xt.DecidedAt)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		assert.Equal(t, http.StatusNotFound, get(t, "/xt/abcd", nil))
+		assert.Equal(t, http.StatusBadRequest, get(t, "/xt?state=unknown", nil))
+		assert.Equal(t, http.StatusBadRequest, get(t, "/xt?limit=-1", nil))
+		assert.Equal(t, http.StatusBadRequest, get(t, "/xt?chain_id=0xzz", nil))
+	})
+}
@@ -0,0 +1,191 @@
+package publisher
+
+import (
+	"sync"
+	"time"
+)
+
+// xtHistorySize bounds the xTs kept for the /xt endpoints.
+const xtHistorySize = 1000
+
+// XTState is the lifecycle state of an xT as seen by the publisher.
+type XTState string
+
+const (
+	XTStateQueued    XTState = "queued"    // Waiting for its chains to leave the prepare phase
+	XTStateVoting    XTState = "voting"    // Relayed, collecting votes
+	XTStateCommitted XTState = "committed" // Decided commit
+	XTStateAborted   XTState = "aborted"   // Decided abort
+)
+
+// XTVote is the vote of a participant chain.
+type XTVote struct {
+	Vote      bool      `json:"vote"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// XTInfo describes an xT for monitoring.
+type XTInfo struct {
+	ID           string            `json:"id"`
+	Sender       string            `json:"sender"`        // Sender ID of the submitting sequencer
+	ConnectionID string            `json:"connection_id"` // Connection the request arrived on
+	Chains       []string          `json:"chains"`
+	State        XTState           `json:"state"`
+	Votes        map[string]XTVote `json:"votes"` // Keyed by chain ID
+	ReceivedAt   time.Time         `json:"received_at"`
+	StartedAt    *time.Time        `json:"started_at,omitempty"`
+	DecidedAt    *time.Time        `json:"decided_at,omitempty"`
+	DeliveredAt  *time.Time        `json:"delivered_at,omitempty"`
+}
+
+// XTFilter selects xTs; empty fields match everything.
+type XTFilter struct {
+	ChainID string
+	State   XTState
+	Limit   int
+}
+
+// xtHistory keeps the most recent xTs, evicting the oldest beyond its size.
+type xtHistory struct {
+	size int
+
+	mu    sync.Mutex
+	xts   map[string]*XTInfo
+	order []string // Oldest first
+}
+
+func newXTHistory(size int) *xtHistory {
+	return &xtHistory{
+		size: size,
+		xts:  make(map[string]*XTInfo),
+	}
+}
+
+// received records a new xT request.
+func (h *xtHistory) received(xtID, sender, connID string, chains []string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.xts[xtID]; ok {
+		return
+	}
+
+	h.xts[xtID] = &XTInfo{
+		ID:           xtID,
+		Sender:       sender,
+		ConnectionID: connID,
+		Chains:       chains,
+		State:        XTStateQueued,
+		Votes:        make(map[string]XTVote),
+		ReceivedAt:   time.Now(),
+	}
+	h.order = append(h.order, xtID)
+
+	if len(h.order) > h.size {
+		delete(h.xts, h.order[0])
+		h.order = h.order[1:]
+	}
+}
+
+// started records that the xT was relayed for voting.
+func (h *xtHistory) started(xtID string) {
+	h.update(xtID, func(info *XTInfo, now time.Time) {
+		info.State = XTStateVoting
+		info.StartedAt = &now
+	})
+}
+
+// voted records the vote of a participant chain.
+func (h *xtHistory) voted(xtID, chainID string, vote bool) {
+	h.update(xtID, func(info *XTInfo, now time.Time) {
+		for _, participant := range info.Chains {
+			if participant == chainID {
+				info.Votes[chainID] = XTVote{Vote: vote, Timestamp: now}
+				return
+			}
+		}
+	})
+}
+
+// decided records the decision.
+func (h *xtHistory) decided(xtID string, decision bool) {
+	h.update(xtID, func(info *XTInfo, now time.Time) {
+		info.State = XTStateAborted
+		if decision {
+			info.State = XTStateCommitted
+		}
+		info.DecidedAt = &now
+	})
+}
+
+// delivered records that the decision reached the sequencers.
+func (h *xtHistory) delivered(xtID string) {
+	h.update(xtID, func(info *XTInfo, now time.Time) {
+		info.DeliveredAt = &now
+	})
+}
+
+func (h *xtHistory) update(xtID string, fn func(info *XTInfo, now time.Time)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if info, ok := h.xts[xtID]; ok {
+		fn(info, time.Now())
+	}
+}
+
+// get returns a copy of an xT.
+func (h *xtHistory) get(xtID string) (XTInfo, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	info, ok := h.xts[xtID]
+	if !ok {
+		return XTInfo{}, false
+	}
+	return info.copy(), true
+}
+
+// list returns copies of the xTs matching filter, newest first.
+func (h *xtHistory) list(filter XTFilter) []XTInfo {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	result := make([]XTInfo, 0)
+	for i := len(h.order) - 1; i >= 0; i-- {
+		info := h.xts[h.order[i]]
+		if !filter.matches(info) {
+			continue
+		}
+		result = append(result, info.copy())
+		if filter.Limit > 0 && len(result) == filter.Limit {
+			break
+		}
+	}
+	return result
+}
+
+func (f XTFilter) matches(info *XTInfo) bool {
+	if f.State != "" && info.State != f.State {
+		return false
+	}
+	if f.ChainID == "" {
+		return true
+	}
+	for _, chainID := range info.Chains {
+		if chainID == f.ChainID {
+			return true
+		}
+	}
+	return false
+}
+
+func (info *XTInfo) copy() XTInfo {
+	c := *info
+	c.Chains = append([]string(nil), info.Chains...)
+	c.Votes = make(map[string]XTVote, len(info.Votes))
+	for chainID, vote := range info.Votes {
+		c.Votes[chainID] = vote
+	}
+	return c
+}
@@ -0,0 +1,193 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/kchojn/poc-shared-publisher/internal/cluster"
+	"github.com/kchojn/poc-shared-publisher/internal/config"
+	"github.com/kchojn/poc-shared-publisher/internal/network"
+)
+
+const (
+	// leadStartAttempts is how often a leader tries to start its publisher
+	// before it gives up leadership.
+	leadStartAttempts = 3
+
+	// defaultLeadRetryDelay is the first delay between start attempts without
+	// a cluster heartbeat interval; later delays double.
+	defaultLeadRetryDelay = 100 * time.Millisecond
+)
+
+// ServerFactory creates the sequencer server for a leader term. The term is
+// used as the broadcast epoch, so clients see a new epoch after a failover.
+type ServerFactory func(epoch uint64) network.Server
+
+// Member runs the publisher of a cluster node. Only the leader serves
+// sequencers; followers keep the sequencer port closed and report the leader
+// through Status, so clients can reconnect to it.
+type Member struct {
+	cfg       *config.Config
+	node      cluster.Node
+	newServer ServerFactory
+	log       zerolog.Logger
+
+	mu      sync.RWMutex
+	pub     *Publisher
+	term    uint64 // Term pub was started for
+	cancel  context.CancelFunc
+	stopped bool
+}
+
+// NewMember creates a member for node.
+func NewMember(cfg *config.Config, node cluster.Node, newServer ServerFactory, log zerolog.Logger) *Member {
+	return &Member{
+		cfg:       cfg,
+		node:      node,
+		newServer: newServer,
+		log:       log,
+	}
+}
+
+// Run follows leadership changes until ctx is cancelled. A publisher that
+// fails to start is retried, first after the cluster heartbeat interval and
+// then with doubling delays. After leadStartAttempts failures the node gives
+// up leadership, so another member serves sequencers instead.
+func (m *Member) Run(ctx context.Context) {
+	var (
+		retry    <-chan time.Time
+		attempts int
+		term     uint64
+	)
+
+	start := func() {
+		retry = nil
+		attempts++
+
+		err := m.lead(ctx, term)
+		if err == nil {
+			return
+		}
+
+		if attempts >= leadStartAttempts {
+			m.log.Error().Err(err).Uint64("term", term).Int("attempts", attempts).
+				Msg("Publisher does not start, giving up cluster leadership")
+			m.node.StepDown()
+			return
+		}
+
+		delay := m.cfg.Cluster.HeartbeatInterval << (attempts - 1)
+		if delay <= 0 {
+			delay = defaultLeadRetryDelay
+		}
+		m.log.Error().Err(err).Uint64("term", term).Dur("retry_in", delay).
+			Msg("Failed to start publisher as cluster leader")
+		retry = time.After(delay)
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case change := <-m.node.Leadership():
+			retry, attempts = nil, 0
+			if change.Leader {
+				term = change.Term
+				start()
+			} else {
+				m.follow(ctx)
+			}
+		case <-retry:
+			start()
+		}
+	}
+}
+
+// Stop stops the publisher, if this node leads, and ignores later leadership.
+func (m *Member) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	m.stopped = true
+	m.mu.Unlock()
+
+	return m.stopPublisher(ctx)
+}
+
+// Publisher returns the running publisher, or nil unless this node leads.
+func (m *Member) Publisher() *Publisher {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.pub
+}
+
+// Status returns the cluster state of the node.
+func (m *Member) Status() cluster.Status {
+	return m.node.Status()
+}
+
+// lead starts a publisher for term on top of the replicated log. Recovery
+// aborts the xTs the previous leader left undecided and resends its
+// undelivered decisions. A publisher of an earlier term, left running because
+// the loss of leadership in between was not reported, is replaced.
+func (m *Member) lead(ctx context.Context, term uint64) error {
+	if m.Publisher() != nil && m.leadingTerm() != term {
+		m.log.Warn().Uint64("term", term).Msg("Leadership regained in a new term, restarting publisher")
+		if err := m.stopPublisher(ctx); err != nil {
+			m.log.Error().Err(err).Msg("Failed to stop publisher of the previous term")
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.stopped || m.pub != nil {
+		return nil
+	}
+
+	pub := New(m.cfg, m.newServer(term), m.log)
+	pub.SetStateLog(NewReplicatedStateLog(m.node, m.cfg.Cluster.ProposeTimeout))
+
+	pubCtx, cancel := context.WithCancel(ctx)
+	if err := pub.Start(pubCtx); err != nil {
+		cancel()
+		return err
+	}
+
+	m.pub = pub
+	m.term = term
+	m.cancel = cancel
+
+	m.log.Info().Uint64("term", term).Msg("Serving sequencers as cluster leader")
+
+	return nil
+}
+
+// leadingTerm returns the term of the running publisher.
+func (m *Member) leadingTerm() uint64 {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.term
+}
+
+// follow stops serving sequencers after leadership was lost.
+func (m *Member) follow(ctx context.Context) {
+	if err := m.stopPublisher(ctx); err != nil {
+		m.log.Error().Err(err).Msg("Failed to stop publisher after losing leadership")
+	}
+}
+
+func (m *Member) stopPublisher(ctx context.Context) error {
+	m.mu.Lock()
+	pub, cancel := m.pub, m.cancel
+	m.pub, m.cancel = nil, nil
+	m.mu.Unlock()
+
+	if pub == nil {
+		return nil
+	}
+
+	defer cancel()
+	return pub.Stop(ctx)
+}
@@ -0,0 +1,235 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kchojn/poc-shared-publisher/internal/cluster"
+	"github.com/kchojn/poc-shared-publisher/internal/network"
+)
+
+func TestMember_FailoverRecoversXTs(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var peers []cluster.Peer
+	for i := 1; i <= 3; i++ {
+		peers = append(peers, cluster.Peer{
+			ID:            fmt.Sprintf("node-%d", i),
+			PublisherAddr: fmt.Sprintf("127.0.0.1:%d", 8080+i),
+		})
+	}
+
+	cfg := newTestConfig("")
+	cfg.Cluster.ProposeTimeout = 5 * time.Second
+
+	memNet := cluster.NewMemoryNetwork()
+	nodes := make(map[string]cluster.Node)
+	members := make(map[string]*Member)
+
+	for _, peer := range peers {
+		node, err := cluster.NewNode(cluster.Config{
+			NodeID:            peer.ID,
+			Peers:             peers,
+			ElectionTimeout:   100 * time.Millisecond,
+			HeartbeatInterval: 20 * time.Millisecond,
+		}, memNet.Transport(peer.ID), zerolog.Nop())
+		require.NoError(t, err)
+		memNet.Register(peer.ID, node)
+		require.NoError(t, node.Start(ctx))
+		t.Cleanup(func() { node.Stop() })
+
+		member := NewMember(cfg, node, func(uint64) network.Server { return newFakeServer() }, zerolog.Nop())
+		go member.Run(ctx)
+
+		nodes[peer.ID] = node
+		members[peer.ID] = member
+	}
+
+	// leader waits until a member other than skip serves sequencers
+	leader := func(skip string) (string, *Publisher) {
+		var (
+			id  string
+			pub *Publisher
+		)
+		require.Eventually(t, func() bool {
+			for memberID, member := range members {
+				if memberID == skip {
+					continue
+				}
+				if p := member.Publisher(); p != nil {
+					id, pub = memberID, p
+					return true
+				}
+			}
+			return false
+		}, 5*time.Second, 10*time.Millisecond)
+		return id, pub
+	}
+
+	oldID, oldPub := leader("")
+
+	for id, member := range members {
+		if id != oldID {
+			assert.Nil(t, member.Publisher(), "followers must not serve sequencers")
+			// A follower may learn about the leader after a majority already elected it
+			assert.Eventually(t, func() bool {
+				return member.Status().LeaderID == oldID
+			}, 5*time.Second, 10*time.Millisecond)
+		}
+	}
+
+	// An xT is proposed and half voted on the first leader
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+	msg := newXTRequestMessage(chainA, chainB)
+	xtID, err := msg.GetXtRequest().XtID()
+	require.NoError(t, err)
+
+	oldPub.server.(*fakeServer).connectChain("conn-a", "0x01")
+	require.NoError(t, oldPub.handleMessage(ctx, "conn-a", msg))
+	require.NoError(t, oldPub.handleMessage(ctx, "conn-a", newVoteMessage(chainA, xtID, true)))
+
+	// The leader fails; the new one aborts the xT it cannot finish
+	memNet.Disconnect(oldID)
+	require.NoError(t, nodes[oldID].Stop())
+
+	require.Eventually(t, func() bool {
+		return members[oldID].Publisher() == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.Empty(t, oldPub.coordinator.GetActiveTransactions(), "the old leader stopped its vote deadlines")
+
+	_, newPub := leader(oldID)
+	assert.Equal(t, 1, newPub.GetStats()["pending_decisions"])
+
+	srv := newPub.server.(*fakeServer)
+	srv.connectChain("conn-a2", "0x01")
+
+	sent := srv.sentTo("conn-a2")
+	require.Len(t, sent, 1)
+	require.NotNil(t, sent[0].GetDecided())
+	assert.Equal(t, xtID.Hex(), sent[0].GetDecided().XtId.Hex())
+	assert.False(t, sent[0].GetDecided().Decision)
+}
+
+// fakeNode is a cluster.Node whose leadership changes are driven by the test.
+type fakeNode struct {
+	cluster.Node
+	leadership  chan cluster.Leadership
+	steppedDown atomic.Bool
+}
+
+func newFakeNode() *fakeNode {
+	return &fakeNode{leadership: make(chan cluster.Leadership)}
+}
+
+func (n *fakeNode) Leadership() <-chan cluster.Leadership { return n.leadership }
+func (n *fakeNode) Status() cluster.Status                { return cluster.Status{} }
+func (n *fakeNode) Propose(context.Context, []byte) error { return nil }
+func (n *fakeNode) Committed(func([]byte) error) error    { return nil }
+func (n *fakeNode) StepDown()                             { n.steppedDown.Store(true) }
+
+func TestMember_RestartsPublisherForNewTerm(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu      sync.Mutex
+		servers []*fakeServer
+		epochs  []uint64
+	)
+	newServer := func(epoch uint64) network.Server {
+		mu.Lock()
+		defer mu.Unlock()
+		srv := newFakeServer()
+		servers = append(servers, srv)
+		epochs = append(epochs, epoch)
+		return srv
+	}
+
+	node := newFakeNode()
+	member := NewMember(newTestConfig(""), node, newServer, zerolog.Nop())
+	go member.Run(ctx)
+
+	node.leadership <- cluster.Leadership{Leader: true, Term: 2}
+	require.Eventually(t, func() bool { return member.Publisher() != nil }, time.Second, time.Millisecond)
+	first := member.Publisher()
+
+	// The same term again keeps the publisher
+	node.leadership <- cluster.Leadership{Leader: true, Term: 2}
+	node.leadership <- cluster.Leadership{Leader: true, Term: 2} // Handled once the previous one was
+	assert.Same(t, first, member.Publisher())
+
+	// Leadership lost and regained, reported as a single change
+	node.leadership <- cluster.Leadership{Leader: true, Term: 4}
+	require.Eventually(t, func() bool { return member.Publisher() != first }, time.Second, time.Millisecond)
+	require.NotNil(t, member.Publisher())
+
+	mu.Lock()
+	defer mu.Unlock()
+	assert.Equal(t, []uint64{2, 4}, epochs)
+	assert.True(t, servers[0].stopped.Load(), "the publisher of term 2 is stopped")
+	assert.False(t, servers[1].stopped.Load())
+}
+
+func TestMember_RetriesPublisherStart(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		failures    int
+		wantServing bool
+	}{
+		{name: "starts on a retry", failures: leadStartAttempts - 1, wantServing: true},
+		{name: "gives up leadership", failures: leadStartAttempts},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var started atomic.Int32
+			newServer := func(uint64) network.Server {
+				srv := newFakeServer()
+				if int(started.Add(1)) <= tt.failures {
+					srv.startErr = errors.New("address already in use")
+				}
+				return srv
+			}
+
+			cfg := newTestConfig("")
+			cfg.Cluster.HeartbeatInterval = time.Millisecond
+			node := newFakeNode()
+			member := NewMember(cfg, node, newServer, zerolog.Nop())
+			go member.Run(ctx)
+
+			node.leadership <- cluster.Leadership{Leader: true, Term: 1}
+
+			if tt.wantServing {
+				require.Eventually(t, func() bool { return member.Publisher() != nil }, time.Second, time.Millisecond)
+				assert.False(t, node.steppedDown.Load())
+				assert.Equal(t, int32(leadStartAttempts), started.Load())
+				return
+			}
+
+			require.Eventually(t, node.steppedDown.Load, time.Second, time.Millisecond)
+			assert.Nil(t, member.Publisher())
+			assert.Equal(t, int32(leadStartAttempts), started.Load())
+		})
+	}
+}
@@ -2,43 +2,87 @@ package publisher
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/rs/zerolog"
 
+	"github.com/kchojn/poc-shared-publisher/internal/auth"
 	"github.com/kchojn/poc-shared-publisher/internal/config"
+	"github.com/kchojn/poc-shared-publisher/internal/consensus"
 	"github.com/kchojn/poc-shared-publisher/internal/network"
 	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/internal/types"
 	"github.com/kchojn/poc-shared-publisher/pkg/metrics"
 )
 
+const publisherSenderID = "publisher"
+
+// ErrMissingChainID is returned for transaction requests without a chain ID.
+var ErrMissingChainID = types.NewError(types.ErrCodeInvalidRequest, "transaction request without chain ID")
+
+// ErrForeignChain is returned for votes and seals on behalf of a chain other
+// than the one the connection announced in its handshake.
+var ErrForeignChain = types.NewError(types.ErrCodeUnauthenticated, "message for a chain the connection does not serve")
+
+// MessageTypes lists the payloads the publisher accepts from sequencers, by
+// Message field name. The server answers other payloads with UnsupportedPayload.
+var MessageTypes = []string{"xt_request", "vote", "block_sealed"}
+
 // Publisher orchestrates the shared publisher functionality.
 type Publisher struct {
-	cfg    *config.Config
-	server network.Server
-	log    zerolog.Logger
+	cfg         *config.Config
+	server      network.Server
+	coordinator consensus.Coordinator
+	stateLog    StateLog
+	queue       *chainQueue
+	history     *xtHistory
+	slots       *slotScheduler
+	keyring     *auth.Keyring // Nil unless signatures are verified
+	log         zerolog.Logger
 
 	// State
-	mu      sync.RWMutex
-	chains  map[string]bool // Track unique chains
-	started time.Time
+	mu       sync.RWMutex
+	chains   map[string]bool             // Track unique chains
+	xtChains map[string][]string         // Participants of undecided xTs, keyed by xT ID
+	pending  map[string]*pendingDecision // Decisions awaiting delivery, keyed by xT ID
+	started  time.Time
 
 	// Metrics
 	msgCount     atomic.Uint64
 	broadcastCnt atomic.Uint64
+
+	retired    atomic.Uint64 // xTs whose decision reached every participant
+	compacting atomic.Bool
 }
 
 // New creates a new publisher instance.
 func New(cfg *config.Config, server network.Server, log zerolog.Logger) *Publisher {
-	return &Publisher{
-		cfg:    cfg,
-		server: server,
-		log:    log.With().Str("component", "publisher").Logger(),
-		chains: make(map[string]bool),
+	p := &Publisher{
+		cfg:         cfg,
+		server:      server,
+		coordinator: consensus.NewCoordinator(consensus.Config{Timeout: cfg.Consensus.Timeout}, log),
+		queue:       newChainQueue(cfg.Consensus.MaxInflightPerChain),
+		history:     newXTHistory(xtHistorySize),
+		log:         log.With().Str("component", "publisher").Logger(),
+		chains:      make(map[string]bool),
+		xtChains:    make(map[string][]string),
+		pending:     make(map[string]*pendingDecision),
 	}
+	p.coordinator.SetDecisionCallback(p.broadcastDecision)
+	p.slots = newSlotScheduler(cfg.Slot, p.broadcastConnected, log)
+
+	return p
+}
+
+// SetStateLog replaces the decision log opened from the state directory,
+// e.g. with a replicated one. It must be called before Start.
+func (p *Publisher) SetStateLog(log StateLog) {
+	p.stateLog = log
 }
 
 // Start starts the publisher.
@@ -47,15 +91,30 @@ func (p *Publisher) Start(ctx context.Context) error {
 
 	p.started = time.Now()
 
+	if err := p.openKeyring(); err != nil {
+		return err
+	}
+
+	if err := p.openState(); err != nil {
+		return err
+	}
+
 	p.server.SetHandler(p.handleMessage)
+	p.server.SetConnectHandler(p.handleConnect)
+	p.server.SetDisconnectHandler(p.handleDisconnect)
 
 	if err := p.server.Start(ctx); err != nil {
+		p.stateLog.Close()
 		return fmt.Errorf("failed to start server: %w", err)
 	}
 
 	go metrics.StartUptimeCollector(ctx)
 	go p.metricsReporter(ctx)
 
+	if p.cfg.Slot.Enabled {
+		go p.slots.run(ctx)
+	}
+
 	p.log.Info().
 		Str("version", "0.1.0").
 		Str("address", p.cfg.Server.ListenAddr).
@@ -68,8 +127,21 @@ func (p *Publisher) Start(ctx context.Context) error {
 func (p *Publisher) Stop(ctx context.Context) error {
 	p.log.Info().Msg("Stopping publisher")
 
-	if err := p.server.Stop(ctx); err != nil {
-		return fmt.Errorf("failed to stop server: %w", err)
+	serverErr := p.server.Stop(ctx)
+	if serverErr != nil {
+		serverErr = fmt.Errorf("failed to stop server: %w", serverErr)
+	}
+
+	// Undecided xTs are in the state log, whoever leads next decides them
+	p.coordinator.Stop()
+
+	logErr := p.stateLog.Close()
+	if logErr != nil {
+		logErr = fmt.Errorf("failed to close state log: %w", logErr)
+	}
+
+	if err := errors.Join(serverErr, logErr); err != nil {
+		return err
 	}
 
 	p.log.Info().
@@ -84,25 +156,47 @@ func (p *Publisher) handleMessage(ctx context.Context, from string, msg *pb.Mess
 	start := time.Now()
 	p.msgCount.Add(1)
 
-	var msgType string
-	var err error
+	// Unverified messages are answered without touching any state
+	if err := p.authenticate(from, msg); err != nil {
+		p.reply(ctx, from, msg, nil, err)
+		return err
+	}
+
+	var (
+		msgType string
+		xtID    *pb.XtID
+		err     error
+	)
 
 	switch payload := msg.Payload.(type) {
 	case *pb.Message_XtRequest:
 		msgType = "xt_request"
-		err = p.handleXTRequest(ctx, from, msg, payload.XtRequest)
+		xtID, err = p.handleXTRequest(ctx, from, msg, payload.XtRequest)
+	case *pb.Message_Vote:
+		msgType = "vote"
+		xtID = payload.Vote.GetXtId()
+		err = p.handleVote(ctx, from, payload.Vote)
+	case *pb.Message_BlockSealed:
+		msgType = "block_sealed"
+		served, _ := p.connectionChain(from)
+		err = p.slots.handleSealed(from, served, payload.BlockSealed)
 	default:
 		msgType = "unknown"
 		metrics.RecordError("unknown_message_type", "handle_message")
-		err = fmt.Errorf("unknown message type: %T", payload)
+		err = types.Errorf(types.ErrCodeUnsupported, "unknown message type: %T", payload)
 	}
 
+	// Every request is answered, so failures reach the sequencer that sent it
+	p.reply(ctx, from, msg, xtID, err)
+
 	metrics.MessageProcessingDuration.WithLabelValues(msgType).Observe(time.Since(start).Seconds())
 	return err
 }
 
-// handleXTRequest handles cross-chain transaction requests.
-func (p *Publisher) handleXTRequest(ctx context.Context, from string, msg *pb.Message, req *pb.XTRequest) error {
+// handleXTRequest starts a 2PC round for a cross-chain transaction request,
+// or queues it while one of its chains has too many xTs in the prepare phase.
+// It returns the ID of the xT once the request is valid.
+func (p *Publisher) handleXTRequest(ctx context.Context, from string, msg *pb.Message, req *pb.XTRequest) (*pb.XtID, error) {
 	log := p.log.With().
 		Str("from", from).
 		Str("sender_id", msg.SenderId).
@@ -111,6 +205,11 @@ func (p *Publisher) handleXTRequest(ctx context.Context, from string, msg *pb.Me
 
 	log.Info().Msg("Received xT request")
 
+	if err := validateRequest(req); err != nil {
+		metrics.RecordError("invalid_xt", "xt_request")
+		return nil, err
+	}
+
 	// Record metrics
 	metrics.CrossChainTransactionsTotal.Inc()
 	metrics.TransactionBatchSize.Observe(float64(len(req.Transactions)))
@@ -118,7 +217,7 @@ func (p *Publisher) handleXTRequest(ctx context.Context, from string, msg *pb.Me
 	// Track chains
 	p.mu.Lock()
 	for _, tx := range req.Transactions {
-		chainID := fmt.Sprintf("0x%x", tx.ChainId)
+		chainID := pb.FormatChainID(tx.ChainId)
 		if !p.chains[chainID] {
 			p.chains[chainID] = true
 			metrics.UniqueChains.WithLabelValues(chainID).Set(1)
@@ -130,41 +229,314 @@ func (p *Publisher) handleXTRequest(ctx context.Context, from string, msg *pb.Me
 	for i, tx := range req.Transactions {
 		log.Debug().
 			Int("index", i).
-			Str("chain_id", fmt.Sprintf("0x%x", tx.ChainId)).
+			Str("chain_id", pb.FormatChainID(tx.ChainId)).
 			Int("tx_data_count", len(tx.Transaction)).
 			Msg("Transaction details")
 	}
 
-	// Broadcast to all other connections
-	broadcastStart := time.Now()
+	xtID, err := req.XtID()
+	if err != nil {
+		metrics.RecordError("invalid_xt", "xt_request")
+		return nil, types.Errorf(types.ErrCodeInvalidRequest, "failed to compute xT ID: %w", err)
+	}
 
-	connections := p.server.GetConnections()
-	recipientCount := len(connections) - 1 // Exclude sender
+	xt := &queuedXT{xtID: xtID, chains: requestChains(req), from: from, msg: msg}
+
+	ready, ok := p.queue.enqueue(xt)
+	if !ok {
+		metrics.RecordError("start_failed", "xt_request")
+		return xtID, fmt.Errorf("failed to start xT: %w", consensus.ErrDuplicateTransaction)
+	}
+	p.history.received(xtID.Hex(), msg.SenderId, from, xt.chains)
 
-	if recipientCount > 0 {
-		metrics.BroadcastRecipients.Observe(float64(recipientCount))
+	if len(ready) == 0 || ready[len(ready)-1] != xt {
+		log.Info().Str("xt_id", xtID.Hex()).Msg("xT queued behind in-flight xTs on its chains")
+	}
+
+	return xtID, p.startAdmitted(ctx, ready, xt)
+}
 
-		if err := p.server.Broadcast(ctx, msg, from); err != nil {
-			log.Error().Err(err).Msg("Failed to broadcast xT request")
-			metrics.RecordError("broadcast_failed", "xt_request")
-			return err
+// validateRequest rejects requests that cannot form an xT.
+func validateRequest(req *pb.XTRequest) error {
+	if len(req.Transactions) == 0 {
+		return consensus.ErrEmptyTransaction
+	}
+	for i, tx := range req.Transactions {
+		if len(tx.ChainId) == 0 {
+			return fmt.Errorf("transaction request %d: %w", i, ErrMissingChainID)
 		}
+	}
+	return nil
+}
+
+// startAdmitted starts the 2PC rounds of xTs admitted by the chain queue and
+// returns the error of own, the xT whose request is being handled, if any.
+// An xT the coordinator refuses frees its chains for the next waiting xTs.
+func (p *Publisher) startAdmitted(ctx context.Context, ready []*queuedXT, own *queuedXT) error {
+	var ownErr error
+
+	for len(ready) > 0 {
+		xt := ready[0]
+		ready = ready[1:]
+
+		started, err := p.startXT(ctx, xt)
+		if err == nil {
+			continue
+		}
+
+		if xt == own {
+			ownErr = err
+		} else {
+			// The request was acknowledged when it was queued, so report the failure separately
+			p.log.Error().Err(err).Str("xt_id", xt.xtID.Hex()).Msg("Failed to start queued xT")
+			p.reportError(ctx, xt.from, xt.xtID, err)
+		}
+
+		if !started {
+			ready = append(ready, p.queue.release(xt.xtID)...)
+		}
+	}
+
+	return ownErr
+}
+
+// startXT starts the 2PC round of an admitted xT and asks the sequencers of
+// its participant chains to vote on it. It reports whether the coordinator accepted the xT.
+func (p *Publisher) startXT(ctx context.Context, xt *queuedXT) (bool, error) {
+	req := xt.msg.GetXtRequest()
+
+	log := p.log.With().
+		Str("from", xt.from).
+		Str("xt_id", xt.xtID.Hex()).
+		Logger()
+
+	if _, err := p.coordinator.StartTransaction(ctx, xt.from, req); err != nil {
+		metrics.RecordError("start_failed", "xt_request")
+		return false, fmt.Errorf("failed to start xT: %w", err)
+	}
+	p.history.started(xt.xtID.Hex())
 
-		p.broadcastCnt.Add(1)
-		metrics.BroadcastsTotal.Inc()
-		metrics.BroadcastDuration.Observe(time.Since(broadcastStart).Seconds())
+	if err := p.logProposed(xt.xtID, req); err != nil {
+		log.Error().Err(err).Msg("Failed to log proposed xT")
+		metrics.RecordError("state_log_failed", "xt_request")
+		return true, types.Errorf(types.ErrCodeStateLogFailed, "failed to log proposed xT: %w", err)
+	}
 
-		log.Info().
-			Int("recipients", recipientCount).
-			Dur("duration", time.Since(broadcastStart)).
-			Msg("Successfully broadcast xT request")
+	// Relay to the sequencers of the participant chains, including the sender's
+	if err := p.relay(ctx, xt); err != nil {
+		log.Error().Err(err).Msg("Failed to relay xT request")
+		metrics.RecordError("relay_failed", "xt_request")
+		return true, types.Errorf(types.ErrCodeRoutingFailed, "failed to relay xT request: %w", err)
+	}
+
+	log.Info().Msg("Relayed xT request for voting")
+
+	return true, nil
+}
+
+// handleVote records a participant vote on an xT.
+func (p *Publisher) handleVote(ctx context.Context, from string, vote *pb.Vote) error {
+	p.log.Debug().
+		Str("from", from).
+		Str("xt_id", vote.GetXtId().Hex()).
+		Str("chain_id", pb.FormatChainID(vote.SenderChainId)).
+		Bool("vote", vote.Vote).
+		Msg("Received vote")
+
+	// Only the sequencer that announced a chain in its handshake may vote for it
+	chainID := pb.FormatChainID(vote.SenderChainId)
+	if served, ok := p.connectionChain(from); !ok || served != chainID {
+		metrics.RecordError("vote_rejected", "vote")
+		return fmt.Errorf("%w: %s voted for %s", ErrForeignChain, from, chainID)
+	}
+
+	if _, err := p.coordinator.GetTransactionState(vote.GetXtId()); err == nil {
+		if err := p.stateLog.Append(Record{
+			Type:    RecordVoted,
+			XtID:    vote.GetXtId().Hex(),
+			ChainID: chainID,
+			Vote:    vote.Vote,
+		}); err != nil {
+			metrics.RecordError("state_log_failed", "vote")
+			return types.Errorf(types.ErrCodeStateLogFailed, "failed to log vote: %w", err)
+		}
+		p.history.voted(vote.GetXtId().Hex(), chainID, vote.Vote)
+	}
+
+	if _, err := p.coordinator.RecordVote(ctx, vote); err != nil {
+		metrics.RecordError("vote_rejected", "vote")
+		return fmt.Errorf("failed to record vote: %w", err)
+	}
+
+	return nil
+}
+
+// handleDisconnect aborts pending xTs of the chain served by a closed
+// connection, unless another connection still serves the chain.
+func (p *Publisher) handleDisconnect(info network.ConnectionInfo) {
+	if info.ChainID == "" {
+		return
+	}
+
+	// A sequencer that reconnected before its old connection was found dead
+	if p.servedElsewhere(info.ChainID, info.ID) {
+		p.log.Debug().
+			Str("conn_id", info.ID).
+			Str("chain_id", info.ChainID).
+			Msg("Participant still connected elsewhere, keeping its xTs")
+		return
+	}
+
+	p.slots.removeChain(info.ChainID)
+
+	aborted := p.coordinator.AbortParticipant(context.Background(), info.ChainID)
+	if len(aborted) > 0 {
+		p.log.Warn().
+			Str("conn_id", info.ID).
+			Str("chain_id", info.ChainID).
+			Int("aborted", len(aborted)).
+			Msg("Participant disconnected, aborted pending xTs")
+	}
+}
+
+// broadcastDecision logs the outcome of an xT and sends it to the sequencers
+// of its participant chains. A decision is kept for redelivery until the
+// sequencer of every participant chain has received it.
+func (p *Publisher) broadcastDecision(ctx context.Context, xtID *pb.XtID, decision bool) error {
+	// Let the next waiting xTs on the same chains start once the decision is out
+	defer p.admitNext(context.WithoutCancel(ctx), xtID)
+
+	p.mu.Lock()
+	chains := p.xtChains[xtID.Hex()]
+	delete(p.xtChains, xtID.Hex())
+	p.mu.Unlock()
+
+	if err := p.stateLog.Append(Record{
+		Type:     RecordDecided,
+		XtID:     xtID.Hex(),
+		Decision: decision,
+	}); err != nil {
+		metrics.RecordError("state_log_failed", "decided")
+		// The coordinator already dropped the xT, so the decision is kept to be logged and delivered later
+		p.addUnlogged(xtID, decision, chains)
+		return types.Errorf(types.ErrCodeStateLogFailed, "failed to log decision: %w", err)
+	}
+	p.history.decided(xtID.Hex(), decision)
+
+	// Chains without a connected sequencer get the decision when they reconnect
+	recipients, _ := p.route(chains)
+	msg := newDecidedMessage(xtID, decision)
+
+	var errs []error
+	served := make(map[string]bool, len(chains))
+	for connID, connChains := range recipients {
+		if err := p.server.Send(ctx, connID, msg); err != nil {
+			errs = append(errs, fmt.Errorf("connection %s: %w", connID, err))
+			continue
+		}
+		for _, chainID := range connChains {
+			served[chainID] = true
+		}
+	}
+
+	reached := slices.DeleteFunc(slices.Clone(chains), func(chainID string) bool { return !served[chainID] })
+
+	// Only a connected participant that could not be sent the decision is a
+	// failure, not one whose other connection got it
+	var failed []string
+	for _, connChains := range recipients {
+		for _, chainID := range connChains {
+			if !served[chainID] && !slices.Contains(failed, chainID) {
+				failed = append(failed, chainID)
+			}
+		}
+	}
+
+	// A record without chains marks the decision delivered to all participants
+	if len(reached) > 0 || len(chains) == 0 {
+		if err := p.stateLog.Append(Record{Type: RecordDelivered, XtID: xtID.Hex(), Chains: reached}); err != nil {
+			p.log.Error().Err(err).Str("xt_id", xtID.Hex()).Msg("Failed to log delivery")
+		}
+	}
+
+	if len(reached) < len(chains) {
+		p.addPending(xtID, decision, chains, reached)
 	} else {
-		log.Warn().Msg("No other connections to broadcast to")
+		p.retire(xtID.Hex())
+	}
+
+	if len(failed) > 0 {
+		err := errors.Join(errs...)
+		p.log.Error().
+			Err(err).
+			Str("xt_id", xtID.Hex()).
+			Strs("chains", failed).
+			Msg("Failed to send decision")
+		metrics.RecordError("broadcast_failed", "decided")
+
+		err = types.Errorf(types.ErrCodeBroadcastFailed, "failed to send decision to chains %v: %w", failed, err)
+		if info, ok := p.history.get(xtID.Hex()); ok {
+			p.reportError(ctx, info.ConnectionID, xtID, err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// admitNext frees the chains of a decided xT and starts the xTs waiting on them.
+func (p *Publisher) admitNext(ctx context.Context, xtID *pb.XtID) {
+	_ = p.startAdmitted(ctx, p.queue.release(xtID), nil)
+}
+
+func newDecidedMessage(xtID *pb.XtID, decision bool) *pb.Message {
+	return &pb.Message{
+		SenderId: publisherSenderID,
+		Payload: &pb.Message_Decided{
+			Decided: &pb.Decided{
+				XtId:     xtID,
+				Decision: decision,
+			},
+		},
+	}
+}
+
+// broadcast sends a message to every connection.
+func (p *Publisher) broadcast(ctx context.Context, msg *pb.Message) error {
+	start := time.Now()
+
+	recipients := len(p.server.GetConnections())
+	if recipients == 0 {
+		p.log.Warn().Msg("No connections to broadcast to")
+		return nil
+	}
+
+	metrics.BroadcastRecipients.Observe(float64(recipients))
+
+	if err := p.server.Broadcast(ctx, msg, ""); err != nil {
+		return err
 	}
 
+	p.broadcastCnt.Add(1)
+	metrics.BroadcastsTotal.Inc()
+	metrics.BroadcastDuration.Observe(time.Since(start).Seconds())
+
+	p.log.Debug().
+		Int("recipients", recipients).
+		Dur("duration", time.Since(start)).
+		Msg("Broadcast complete")
+
 	return nil
 }
 
+// broadcastConnected broadcasts a message if any sequencer is connected.
+func (p *Publisher) broadcastConnected(ctx context.Context, msg *pb.Message) error {
+	if len(p.server.GetConnections()) == 0 {
+		return nil
+	}
+	return p.broadcast(ctx, msg)
+}
+
 // metricsReporter periodically reports internal metrics.
 func (p *Publisher) metricsReporter(ctx context.Context) {
 	ticker := time.NewTicker(30 * time.Second)
@@ -194,6 +566,16 @@ func (p *Publisher) metricsReporter(ctx context.Context) {
 	}
 }
 
+// GetXT returns a recent xT by its hex ID.
+func (p *Publisher) GetXT(xtID string) (XTInfo, bool) {
+	return p.history.get(xtID)
+}
+
+// ListXTs returns recent xTs matching filter, newest first.
+func (p *Publisher) ListXTs(filter XTFilter) []XTInfo {
+	return p.history.list(filter)
+}
+
 // GetStats returns current statistics.
 func (p *Publisher) GetStats() map[string]interface{} {
 	connections := p.server.GetConnections()
@@ -203,6 +585,7 @@ func (p *Publisher) GetStats() map[string]interface{} {
 	for chain := range p.chains {
 		chains = append(chains, chain)
 	}
+	pending := len(p.pending)
 	p.mu.RUnlock()
 
 	return map[string]interface{}{
@@ -212,5 +595,9 @@ func (p *Publisher) GetStats() map[string]interface{} {
 		"broadcasts_sent":    p.broadcastCnt.Load(),
 		"unique_chains":      chains,
 		"chains_count":       len(chains),
+		"active_xts":         len(p.coordinator.GetActiveTransactions()),
+		"pending_decisions":  pending,
+		"queue":              p.queue.stats(),
+		"slots":              p.slots.stats(),
 	}
 }
@@ -1 +1,665 @@
 package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kchojn/poc-shared-publisher/internal/config"
+	"github.com/kchojn/poc-shared-publisher/internal/network"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+// fakeServer is an in-memory network.Server recording everything sent.
+type fakeServer struct {
+	mu           sync.Mutex
+	connections  map[string]network.ConnectionInfo
+	broadcasts   []*pb.Message
+	sent         map[string][]*pb.Message
+	broadcastErr error
+	sendErr      map[string]error // Send failures by connection
+	decidedErr   map[string]error // Send failures of decisions by connection
+	startErr     error
+	stopErr      error
+	stopped      atomic.Bool
+
+	handler      network.MessageHandler
+	onConnect    network.ConnectHandler
+	onDisconnect network.DisconnectHandler
+}
+
+func newFakeServer() *fakeServer {
+	return &fakeServer{
+		connections: make(map[string]network.ConnectionInfo),
+		sent:        make(map[string][]*pb.Message),
+		sendErr:     make(map[string]error),
+		decidedErr:  make(map[string]error),
+	}
+}
+
+func (s *fakeServer) Start(context.Context) error { return s.startErr }
+
+func (s *fakeServer) Stop(context.Context) error {
+	s.stopped.Store(true)
+	return s.stopErr
+}
+
+func (s *fakeServer) Broadcast(_ context.Context, msg *pb.Message, _ string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.broadcastErr != nil {
+		return s.broadcastErr
+	}
+	s.broadcasts = append(s.broadcasts, msg)
+	for id := range s.connections {
+		s.sent[id] = append(s.sent[id], msg)
+	}
+	return nil
+}
+
+func (s *fakeServer) Send(_ context.Context, clientID string, msg *pb.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.sendErr[clientID]; err != nil {
+		return err
+	}
+	if err := s.decidedErr[clientID]; err != nil && msg.GetDecided() != nil {
+		return err
+	}
+	s.sent[clientID] = append(s.sent[clientID], msg)
+	return nil
+}
+
+func (s *fakeServer) Reply(ctx context.Context, clientID string, request, reply *pb.Message) error {
+	reply.ReplyTo = request.CorrelationId
+	return s.Send(ctx, clientID, reply)
+}
+
+func (s *fakeServer) SetHandler(handler network.MessageHandler) {
+	s.handler = handler
+}
+
+func (s *fakeServer) SetConnectHandler(handler network.ConnectHandler) {
+	s.onConnect = handler
+}
+
+func (s *fakeServer) SetDisconnectHandler(handler network.DisconnectHandler) {
+	s.onDisconnect = handler
+}
+
+func (s *fakeServer) GetConnections() []network.ConnectionInfo {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	infos := make([]network.ConnectionInfo, 0, len(s.connections))
+	for _, info := range s.connections {
+		infos = append(infos, info)
+	}
+	return infos
+}
+
+func (s *fakeServer) connect(id string) {
+	s.connectChain(id, "")
+}
+
+// connectChain connects a sequencer that announced chainID in its handshake.
+func (s *fakeServer) connectChain(id, chainID string) {
+	info := network.ConnectionInfo{ID: id, ConnectedAt: time.Now(), ChainID: chainID}
+	s.mu.Lock()
+	s.connections[id] = info
+	s.mu.Unlock()
+	if s.onConnect != nil {
+		s.onConnect(info)
+	}
+}
+
+// disconnect closes a connection and calls the disconnect handler.
+func (s *fakeServer) disconnect(id string) {
+	s.mu.Lock()
+	info := s.connections[id]
+	delete(s.connections, id)
+	s.mu.Unlock()
+	if s.onDisconnect != nil {
+		s.onDisconnect(info)
+	}
+}
+
+func (s *fakeServer) sentTo(id string) []*pb.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*pb.Message(nil), s.sent[id]...)
+}
+
+func newTestConfig(stateDir string) *config.Config {
+	return &config.Config{
+		Consensus: config.ConsensusConfig{Timeout: time.Minute},
+		State:     config.StateConfig{Dir: stateDir},
+	}
+}
+
+func newXTRequestMessage(chainIDs ...[]byte) *pb.Message {
+	req := &pb.XTRequest{}
+	for _, chainID := range chainIDs {
+		req.Transactions = append(req.Transactions, &pb.TransactionRequest{
+			ChainId:     chainID,
+			Transaction: [][]byte{append([]byte("tx-"), chainID...)},
+		})
+	}
+	return &pb.Message{SenderId: "seq", Payload: &pb.Message_XtRequest{XtRequest: req}}
+}
+
+func newVoteMessage(chainID []byte, xtID *pb.XtID, vote bool) *pb.Message {
+	return &pb.Message{
+		SenderId: "seq",
+		Payload:  &pb.Message_Vote{Vote: &pb.Vote{SenderChainId: chainID, XtId: xtID, Vote: vote}},
+	}
+}
+
+func TestStateLog_AppendReplay(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	log, err := OpenStateLog(dir)
+	require.NoError(t, err)
+
+	records := []Record{
+		{Type: RecordProposed, XtID: "aa", Chains: []string{"0x01", "0x02"}},
+		{Type: RecordVoted, XtID: "aa", ChainID: "0x01", Vote: true},
+		{Type: RecordDecided, XtID: "aa", Decision: true},
+	}
+	for _, rec := range records {
+		require.NoError(t, log.Append(rec))
+	}
+	require.NoError(t, log.Close())
+
+	log, err = OpenStateLog(dir)
+	require.NoError(t, err)
+	defer log.Close()
+
+	var replayed []Record
+	require.NoError(t, log.Replay(func(rec Record) error {
+		replayed = append(replayed, rec)
+		return nil
+	}))
+
+	require.Len(t, replayed, len(records))
+	for i, rec := range records {
+		assert.Equal(t, rec.Type, replayed[i].Type)
+		assert.Equal(t, rec.XtID, replayed[i].XtID)
+		assert.False(t, replayed[i].Timestamp.IsZero())
+	}
+	assert.Equal(t, []string{"0x01", "0x02"}, replayed[0].Chains)
+	assert.True(t, replayed[2].Decision)
+}
+
+func TestStateLog_TruncatesTornTail(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	log, err := OpenStateLog(dir)
+	require.NoError(t, err)
+	require.NoError(t, log.Append(Record{Type: RecordProposed, XtID: "aa"}))
+	require.NoError(t, log.Close())
+
+	// Simulate a crash in the middle of writing a record
+	path := filepath.Join(dir, stateLogFile)
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o640)
+	require.NoError(t, err)
+	_, err = f.Write([]byte{0x00, 0x00, 0x01, 0x00, 0xde, 0xad})
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	log, err = OpenStateLog(dir)
+	require.NoError(t, err)
+	defer log.Close()
+
+	var count int
+	require.NoError(t, log.Replay(func(Record) error {
+		count++
+		return nil
+	}))
+	assert.Equal(t, 1, count)
+
+	truncated, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), truncated.Size())
+
+	// The log stays appendable after truncation
+	require.NoError(t, log.Append(Record{Type: RecordDecided, XtID: "aa"}))
+}
+
+func TestStateLog_CompactsDeliveredXTs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	log, err := OpenStateLog(dir)
+	require.NoError(t, err)
+
+	// xT "aa" reached both chains, "bb" still misses chain 0x02
+	records := []Record{
+		{Type: RecordProposed, XtID: "aa", Chains: []string{"0x01", "0x02"}},
+		{Type: RecordProposed, XtID: "bb", Chains: []string{"0x01", "0x02"}},
+		{Type: RecordDecided, XtID: "aa", Decision: true},
+		{Type: RecordDecided, XtID: "bb", Decision: false},
+		{Type: RecordDelivered, XtID: "aa", Chains: []string{"0x01"}},
+		{Type: RecordDelivered, XtID: "bb", Chains: []string{"0x01"}},
+		{Type: RecordDelivered, XtID: "aa", Chains: []string{"0x02"}},
+	}
+	for _, rec := range records {
+		require.NoError(t, log.Append(rec))
+	}
+
+	require.NoError(t, log.Compact())
+	require.NoError(t, log.Append(Record{Type: RecordProposed, XtID: "cc", Chains: []string{"0x01"}}))
+	require.NoError(t, log.Close())
+
+	log, err = OpenStateLog(dir)
+	require.NoError(t, err)
+	defer log.Close()
+
+	var replayed []string
+	require.NoError(t, log.Replay(func(rec Record) error {
+		replayed = append(replayed, rec.XtID+":"+string(rec.Type))
+		return nil
+	}))
+	assert.Equal(t, []string{"bb:proposed", "bb:decided", "bb:delivered", "cc:proposed"}, replayed)
+
+	// A replicated log is compacted the same way
+	data := make([][]byte, len(records))
+	for i, rec := range records {
+		data[i], err = json.Marshal(rec)
+		require.NoError(t, err)
+	}
+	kept, err := CompactReplicated(data)
+	require.NoError(t, err)
+	assert.Equal(t, [][]byte{data[1], data[3], data[5]}, kept)
+}
+
+func TestPublisher_RecoversAfterCrash(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	chainA, chainB, chainC := []byte{0x01}, []byte{0x02}, []byte{0x03}
+
+	// First run: one xT is decided but the decision never reaches the sequencers,
+	// a second xT is still collecting votes when the process dies.
+	srv1 := newFakeServer()
+	srv1.connectChain("conn-a", "0x01")
+	srv1.connectChain("conn-b", "0x02")
+	cfg1 := newTestConfig(dir)
+	cfg1.Consensus.MaxInflightPerChain = 2 // Both xTs touch chain A
+	p1 := New(cfg1, srv1, zerolog.Nop())
+	require.NoError(t, p1.Start(ctx))
+
+	committed := newXTRequestMessage(chainA, chainB)
+	committedID, err := committed.GetXtRequest().XtID()
+	require.NoError(t, err)
+
+	undecided := newXTRequestMessage(chainA, chainC)
+	undecidedID, err := undecided.GetXtRequest().XtID()
+	require.NoError(t, err)
+
+	require.NoError(t, p1.handleMessage(ctx, "conn-a", committed))
+	require.NoError(t, p1.handleMessage(ctx, "conn-a", undecided))
+
+	srv1.mu.Lock()
+	srv1.decidedErr["conn-a"] = errors.New("connection reset")
+	srv1.decidedErr["conn-b"] = errors.New("connection reset")
+	srv1.mu.Unlock()
+
+	require.NoError(t, p1.handleMessage(ctx, "conn-a", newVoteMessage(chainA, committedID, true)))
+	require.Error(t, p1.handleMessage(ctx, "conn-b", newVoteMessage(chainB, committedID, true)))
+
+	// Crash: the log file is closed without a graceful stop
+	require.NoError(t, p1.stateLog.Close())
+
+	// Second run: both decisions are resent to reconnecting sequencers
+	srv2 := newFakeServer()
+	p2 := New(newTestConfig(dir), srv2, zerolog.Nop())
+	require.NoError(t, p2.Start(ctx))
+
+	assert.Equal(t, 2, p2.GetStats()["pending_decisions"])
+
+	srv2.connect("conn-x") // Serves no participant chain
+	srv2.connectChain("conn-a2", "0x01")
+	assert.Empty(t, srv2.sentTo("conn-x"))
+
+	decisions := make(map[string]bool)
+	for _, msg := range srv2.sentTo("conn-a2") {
+		decided := msg.GetDecided()
+		require.NotNil(t, decided)
+		decisions[decided.XtId.Hex()] = decided.Decision
+	}
+
+	require.Len(t, decisions, 2)
+	assert.True(t, decisions[committedID.Hex()])
+	assert.False(t, decisions[undecidedID.Hex()])
+
+	// Reconnecting sequencers of the same chain do not count as other participants
+	srv2.connectChain("conn-a3", "0x01")
+	assert.Empty(t, srv2.sentTo("conn-a3"))
+	assert.Equal(t, 2, p2.GetStats()["pending_decisions"])
+
+	// Once chain B reconnected, only the decision awaiting chain C is left
+	srv2.connectChain("conn-b2", "0x02")
+	require.Len(t, srv2.sentTo("conn-b2"), 1)
+	assert.Equal(t, committedID.Hex(), srv2.sentTo("conn-b2")[0].GetDecided().XtId.Hex())
+	assert.Equal(t, 1, p2.GetStats()["pending_decisions"])
+
+	// A third run still owes chain C its decision, and nothing else
+	require.NoError(t, p2.stateLog.Close())
+	srv3 := newFakeServer()
+	p3 := New(newTestConfig(dir), srv3, zerolog.Nop())
+	require.NoError(t, p3.Start(ctx))
+	defer p3.stateLog.Close()
+	assert.Equal(t, 1, p3.GetStats()["pending_decisions"])
+
+	srv3.connectChain("conn-c3", "0x03")
+	sent := srv3.sentTo("conn-c3")
+	require.Len(t, sent, 1)
+	assert.Equal(t, undecidedID.Hex(), sent[0].GetDecided().XtId.Hex())
+	assert.Equal(t, 0, p3.GetStats()["pending_decisions"])
+}
+
+func TestPublisher_AbortsOnParticipantDisconnect(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainA, chainB, chainC := []byte{0x01}, []byte{0x02}, []byte{0x03}
+
+	srv := newFakeServer()
+	srv.connectChain("conn-a", "0x01")
+	srv.connectChain("conn-b", "0x02")
+	srv.connectChain("conn-c", "0x03")
+	srv.connectChain("conn-x", "0x09")
+	p := New(newTestConfig(""), srv, zerolog.Nop())
+	require.NoError(t, p.Start(ctx))
+
+	waiting := newXTRequestMessage(chainA, chainB)
+	waitingID, err := waiting.GetXtRequest().XtID()
+	require.NoError(t, err)
+
+	voted := newXTRequestMessage(chainC, []byte{0x04})
+	votedID, err := voted.GetXtRequest().XtID()
+	require.NoError(t, err)
+
+	require.NoError(t, p.handleMessage(ctx, "conn-a", waiting))
+	require.NoError(t, p.handleMessage(ctx, "conn-c", voted))
+	require.NoError(t, p.handleMessage(ctx, "conn-c", newVoteMessage(chainC, votedID, true)))
+
+	// A connection that never served the chains leaves every xT alone
+	srv.disconnect("conn-x")
+	assert.Len(t, p.coordinator.GetActiveTransactions(), 2)
+
+	// A participant dropping before its vote aborts the xT right away
+	srv.disconnect("conn-b")
+	info, ok := p.GetXT(waitingID.Hex())
+	require.True(t, ok)
+	assert.Equal(t, XTStateAborted, info.State)
+
+	// A participant that already voted does not hold up the decision
+	srv.disconnect("conn-c")
+	_, err = p.coordinator.GetTransactionState(votedID)
+	assert.NoError(t, err)
+}
+
+func TestPublisher_KeepsXTsOfReconnectedParticipant(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+
+	srv := newFakeServer()
+	srv.connectChain("conn-a", "0x01")
+	srv.connectChain("conn-b", "0x02")
+	p := New(newTestConfig(""), srv, zerolog.Nop())
+	require.NoError(t, p.Start(ctx))
+
+	msg := newXTRequestMessage(chainA, chainB)
+	xtID, err := msg.GetXtRequest().XtID()
+	require.NoError(t, err)
+	require.NoError(t, p.handleMessage(ctx, "conn-a", msg))
+
+	// Chain B reconnects before its old connection is found dead
+	srv.connectChain("conn-b2", "0x02")
+	srv.disconnect("conn-b")
+
+	_, err = p.coordinator.GetTransactionState(xtID)
+	require.NoError(t, err, "the xT still waits for chain B")
+	p.slots.mu.Lock()
+	_, sealing := p.slots.sealers["0x02"]
+	p.slots.mu.Unlock()
+	assert.True(t, sealing, "chain B is still expected to seal")
+
+	// Its vote over the new connection decides the xT
+	require.NoError(t, p.handleMessage(ctx, "conn-a", newVoteMessage(chainA, xtID, true)))
+	require.NoError(t, p.handleMessage(ctx, "conn-b2", newVoteMessage(chainB, xtID, true)))
+	info, ok := p.GetXT(xtID.Hex())
+	require.True(t, ok)
+	assert.Equal(t, XTStateCommitted, info.State)
+
+	// The last connection of the chain closing aborts as before
+	other := newXTRequestMessage(chainA, chainB, []byte{0x03})
+	otherID, err := other.GetXtRequest().XtID()
+	require.NoError(t, err)
+	require.NoError(t, p.handleMessage(ctx, "conn-a", other))
+	srv.disconnect("conn-b2")
+	info, ok = p.GetXT(otherID.Hex())
+	require.True(t, ok)
+	assert.Equal(t, XTStateAborted, info.State)
+}
+
+func TestPublisher_KeepsDecisionForDisconnectedParticipants(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+
+	srv := newFakeServer()
+	srv.connectChain("conn-a", "0x01")
+	p := New(newTestConfig(dir), srv, zerolog.Nop())
+	require.NoError(t, p.Start(ctx))
+
+	msg := newXTRequestMessage(chainA, chainB)
+	xtID, err := msg.GetXtRequest().XtID()
+	require.NoError(t, err)
+
+	require.NoError(t, p.handleMessage(ctx, "conn-a", msg))
+	require.NoError(t, p.handleMessage(ctx, "conn-a", newVoteMessage(chainA, xtID, false)))
+
+	// The broadcast reached chain A only, so chain B is still owed the decision
+	assert.Equal(t, 1, p.GetStats()["pending_decisions"])
+	info, ok := p.GetXT(xtID.Hex())
+	require.True(t, ok)
+	assert.Nil(t, info.DeliveredAt)
+
+	srv.connectChain("conn-b", "0x02")
+	sent := srv.sentTo("conn-b")
+	require.NotEmpty(t, sent)
+	assert.Equal(t, xtID.Hex(), sent[len(sent)-1].GetDecided().XtId.Hex())
+	assert.Equal(t, 0, p.GetStats()["pending_decisions"])
+}
+
+func TestPublisher_SendsDecisionToParticipants(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+
+	srv := newFakeServer()
+	srv.connectChain("conn-a", "0x01")
+	srv.connectChain("conn-b", "0x02")
+	srv.connectChain("conn-x", "0x09")
+	p := New(newTestConfig(t.TempDir()), srv, zerolog.Nop())
+	require.NoError(t, p.Start(ctx))
+
+	// A failing consumer that is not a participant does not matter
+	srv.mu.Lock()
+	srv.broadcastErr = errors.New("slow consumer")
+	srv.sendErr["conn-x"] = errors.New("slow consumer")
+	srv.mu.Unlock()
+
+	msg := newXTRequestMessage(chainA, chainB)
+	xtID, err := msg.GetXtRequest().XtID()
+	require.NoError(t, err)
+	require.NoError(t, p.handleMessage(ctx, "conn-a", msg))
+	require.NoError(t, p.handleMessage(ctx, "conn-a", newVoteMessage(chainA, xtID, true)))
+	require.NoError(t, p.handleMessage(ctx, "conn-b", newVoteMessage(chainB, xtID, true)))
+
+	for _, connID := range []string{"conn-a", "conn-b"} {
+		var decided []*pb.Decided
+		for _, sent := range srv.sentTo(connID) {
+			if d := sent.GetDecided(); d != nil {
+				decided = append(decided, d)
+			}
+		}
+		require.Len(t, decided, 1, connID)
+		assert.Equal(t, xtID.Hex(), decided[0].XtId.Hex())
+	}
+	assert.Equal(t, 0, p.GetStats()["pending_decisions"])
+	info, ok := p.GetXT(xtID.Hex())
+	require.True(t, ok)
+	assert.NotNil(t, info.DeliveredAt)
+
+	// A participant that cannot be sent the decision fails it for its chain only
+	other := newXTRequestMessage(chainA, chainB, []byte{0x03})
+	otherID, err := other.GetXtRequest().XtID()
+	require.NoError(t, err)
+	require.NoError(t, p.handleMessage(ctx, "conn-a", other))
+
+	srv.mu.Lock()
+	srv.decidedErr["conn-b"] = errors.New("queue full")
+	srv.mu.Unlock()
+	err = p.handleMessage(ctx, "conn-a", newVoteMessage(chainA, otherID, false))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "0x02")
+
+	assert.Equal(t, 1, p.GetStats()["pending_decisions"])
+	srv.connectChain("conn-a2", "0x01")
+	assert.Empty(t, srv.sentTo("conn-a2"), "chain A already got the decision")
+
+	srv.connectChain("conn-b2", "0x02")
+	sent := srv.sentTo("conn-b2")
+	require.NotEmpty(t, sent)
+	assert.Equal(t, otherID.Hex(), sent[len(sent)-1].GetDecided().XtId.Hex())
+	assert.Equal(t, 1, p.GetStats()["pending_decisions"], "chain C is still owed the decision")
+}
+
+// closeTrackingLog is a StateLog that records whether it was closed.
+type closeTrackingLog struct {
+	StateLog
+	closed bool
+}
+
+func (l *closeTrackingLog) Close() error {
+	l.closed = true
+	return l.StateLog.Close()
+}
+
+func TestPublisher_StopClosesStateLogWhenServerFails(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	srv := newFakeServer()
+	srv.stopErr = errors.New("listener close failed")
+
+	p := New(newTestConfig(""), srv, zerolog.Nop())
+	log := &closeTrackingLog{StateLog: nopLog{}}
+	p.SetStateLog(log)
+	require.NoError(t, p.Start(ctx))
+
+	err := p.Stop(ctx)
+	require.ErrorIs(t, err, srv.stopErr)
+	assert.True(t, log.closed)
+}
+
+// failingLog is a StateLog whose decided records fail while failDecided is set.
+type failingLog struct {
+	StateLog
+	failDecided atomic.Bool
+}
+
+func (l *failingLog) Append(rec Record) error {
+	if rec.Type == RecordDecided && l.failDecided.Load() {
+		return errors.New("disk full")
+	}
+	return l.StateLog.Append(rec)
+}
+
+func TestPublisher_KeepsDecisionWhenLogFails(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	dir := t.TempDir()
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+
+	fileLog, err := OpenStateLog(dir)
+	require.NoError(t, err)
+	log := &failingLog{StateLog: fileLog}
+
+	srv := newFakeServer()
+	srv.connectChain("conn-a", "0x01")
+	p := New(newTestConfig(dir), srv, zerolog.Nop())
+	p.SetStateLog(log)
+	require.NoError(t, p.Start(ctx))
+
+	msg := newXTRequestMessage(chainA, chainB)
+	xtID, err := msg.GetXtRequest().XtID()
+	require.NoError(t, err)
+	require.NoError(t, p.handleMessage(ctx, "conn-a", msg))
+
+	log.failDecided.Store(true)
+	err = p.handleMessage(ctx, "conn-a", newVoteMessage(chainA, xtID, false))
+	require.Error(t, err)
+	assert.Equal(t, 1, p.GetStats()["pending_decisions"], "the decision is not lost")
+
+	// Nothing is delivered while the decision cannot be logged
+	srv.connectChain("conn-b", "0x02")
+	for _, sent := range srv.sentTo("conn-b") {
+		assert.Nil(t, sent.GetDecided())
+	}
+
+	log.failDecided.Store(false)
+	srv.connectChain("conn-b2", "0x02")
+	sent := srv.sentTo("conn-b2")
+	require.Len(t, sent, 1)
+	assert.Equal(t, xtID.Hex(), sent[0].GetDecided().XtId.Hex())
+
+	// The decision survives a restart
+	require.NoError(t, fileLog.Close())
+	recovered, err := OpenStateLog(dir)
+	require.NoError(t, err)
+	defer recovered.Close()
+	state, err := recoverState(recovered)
+	require.NoError(t, err)
+	assert.Empty(t, state.undecided)
+}
@@ -0,0 +1,161 @@
+package publisher
+
+import (
+	"sync"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/pkg/metrics"
+)
+
+// queuedXT is an xT waiting for its chains to leave the prepare phase.
+type queuedXT struct {
+	xtID   *pb.XtID
+	chains []string
+	from   string
+	msg    *pb.Message
+}
+
+// chainQueue serializes xTs per chain: each chain has at most limit xTs in its
+// prepare phase and the rest wait in arrival order.
+//
+// An xT is admitted once every chain it touches has a free slot. A waiting xT
+// is never overtaken by a later xT that shares one of its chains, so admission
+// order per chain is deterministic; xTs on disjoint chains proceed independently.
+type chainQueue struct {
+	limit int
+
+	mu       sync.Mutex
+	waiting  []*queuedXT         // In arrival order
+	inflight map[string]int      // Admitted xTs per chain
+	admitted map[string][]string // Chains of admitted xTs, keyed by xT ID
+	queued   map[string]bool     // Waiting xT IDs
+	depth    map[string]int      // Waiting xTs per chain
+}
+
+func newChainQueue(limit int) *chainQueue {
+	if limit <= 0 {
+		limit = 1
+	}
+
+	return &chainQueue{
+		limit:    limit,
+		inflight: make(map[string]int),
+		admitted: make(map[string][]string),
+		queued:   make(map[string]bool),
+		depth:    make(map[string]int),
+	}
+}
+
+// enqueue adds an xT and returns the xTs that may start now, in order.
+// It reports false if the xT is already queued or in flight.
+func (q *chainQueue) enqueue(xt *queuedXT) ([]*queuedXT, bool) {
+	key := xt.xtID.Hex()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, ok := q.admitted[key]; ok || q.queued[key] {
+		return nil, false
+	}
+
+	q.waiting = append(q.waiting, xt)
+	q.queued[key] = true
+	for _, chainID := range xt.chains {
+		q.depth[chainID]++
+	}
+
+	return q.admitLocked(), true
+}
+
+// release frees the chains of a decided xT and returns the xTs that may start now.
+func (q *chainQueue) release(xtID *pb.XtID) []*queuedXT {
+	key := xtID.Hex()
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	chains, ok := q.admitted[key]
+	if !ok {
+		return nil
+	}
+
+	delete(q.admitted, key)
+	for _, chainID := range chains {
+		q.inflight[chainID]--
+		if q.inflight[chainID] <= 0 {
+			delete(q.inflight, chainID)
+		}
+	}
+
+	return q.admitLocked()
+}
+
+// admitLocked admits waiting xTs in arrival order.
+// Caller must hold q.mu.
+func (q *chainQueue) admitLocked() []*queuedXT {
+	var (
+		ready   []*queuedXT
+		blocked = make(map[string]bool)
+		remain  = q.waiting[:0]
+	)
+
+	for _, xt := range q.waiting {
+		if q.admissibleLocked(xt, blocked) {
+			key := xt.xtID.Hex()
+			delete(q.queued, key)
+			q.admitted[key] = xt.chains
+			for _, chainID := range xt.chains {
+				q.inflight[chainID]++
+				q.depth[chainID]--
+			}
+			ready = append(ready, xt)
+			continue
+		}
+
+		// Later xTs on these chains must wait behind this one
+		for _, chainID := range xt.chains {
+			blocked[chainID] = true
+		}
+		remain = append(remain, xt)
+	}
+
+	for i := len(remain); i < len(q.waiting); i++ {
+		q.waiting[i] = nil
+	}
+	q.waiting = remain
+
+	for chainID, depth := range q.depth {
+		metrics.ChainQueueDepth.WithLabelValues(chainID).Set(float64(depth))
+		if depth == 0 {
+			delete(q.depth, chainID)
+		}
+	}
+
+	return ready
+}
+
+func (q *chainQueue) admissibleLocked(xt *queuedXT, blocked map[string]bool) bool {
+	for _, chainID := range xt.chains {
+		if blocked[chainID] || q.inflight[chainID] >= q.limit {
+			return false
+		}
+	}
+	return true
+}
+
+// stats returns the queue state for GetStats.
+func (q *chainQueue) stats() map[string]interface{} {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	depth := make(map[string]int, len(q.depth))
+	for chainID, d := range q.depth {
+		depth[chainID] = d
+	}
+
+	return map[string]interface{}{
+		"queued":      len(q.waiting),
+		"in_flight":   len(q.admitted),
+		"chain_depth": depth,
+	}
+}
@@ -0,0 +1,167 @@
+package publisher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kchojn/poc-shared-publisher/internal/consensus"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+func newQueuedXT(id byte, chains ...string) *queuedXT {
+	return &queuedXT{xtID: &pb.XtID{Hash: []byte{id}}, chains: chains}
+}
+
+func queuedIDs(xts []*queuedXT) []string {
+	ids := make([]string, 0, len(xts))
+	for _, xt := range xts {
+		ids = append(ids, xt.xtID.Hex())
+	}
+	return ids
+}
+
+func TestChainQueue(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name  string
+		limit int
+		run   func(t *testing.T, q *chainQueue)
+	}{
+		{
+			name:  "serializes xTs on the same chain",
+			limit: 1,
+			run: func(t *testing.T, q *chainQueue) {
+				a, b := newQueuedXT(1, "0x01", "0x02"), newQueuedXT(2, "0x02", "0x03")
+
+				ready, ok := q.enqueue(a)
+				require.True(t, ok)
+				assert.Equal(t, queuedIDs([]*queuedXT{a}), queuedIDs(ready))
+
+				ready, ok = q.enqueue(b)
+				require.True(t, ok)
+				assert.Empty(t, ready)
+
+				assert.Equal(t, queuedIDs([]*queuedXT{b}), queuedIDs(q.release(a.xtID)))
+				assert.Empty(t, q.release(b.xtID))
+			},
+		},
+		{
+			name:  "disjoint chains proceed independently",
+			limit: 1,
+			run: func(t *testing.T, q *chainQueue) {
+				a, b := newQueuedXT(1, "0x01"), newQueuedXT(2, "0x02")
+
+				ready, _ := q.enqueue(a)
+				assert.Len(t, ready, 1)
+				ready, _ = q.enqueue(b)
+				assert.Len(t, ready, 1)
+			},
+		},
+		{
+			name:  "later xTs do not overtake a waiting xT on a shared chain",
+			limit: 1,
+			run: func(t *testing.T, q *chainQueue) {
+				a := newQueuedXT(1, "0x01")
+				b := newQueuedXT(2, "0x01", "0x02") // Waits for a
+				c := newQueuedXT(3, "0x02")         // Waits for b although 0x02 is idle
+				d := newQueuedXT(4, "0x03")         // Unrelated
+
+				q.enqueue(a)
+				ready, _ := q.enqueue(b)
+				assert.Empty(t, ready)
+				ready, _ = q.enqueue(c)
+				assert.Empty(t, ready)
+				ready, _ = q.enqueue(d)
+				assert.Equal(t, queuedIDs([]*queuedXT{d}), queuedIDs(ready))
+
+				assert.Equal(t, queuedIDs([]*queuedXT{b}), queuedIDs(q.release(a.xtID)))
+				assert.Equal(t, queuedIDs([]*queuedXT{c}), queuedIDs(q.release(b.xtID)))
+			},
+		},
+		{
+			name:  "configurable number of in-flight xTs per chain",
+			limit: 2,
+			run: func(t *testing.T, q *chainQueue) {
+				a, b, c := newQueuedXT(1, "0x01"), newQueuedXT(2, "0x01"), newQueuedXT(3, "0x01")
+
+				q.enqueue(a)
+				ready, _ := q.enqueue(b)
+				assert.Len(t, ready, 1)
+				ready, _ = q.enqueue(c)
+				assert.Empty(t, ready)
+				assert.Equal(t, 1, q.stats()["chain_depth"].(map[string]int)["0x01"])
+
+				assert.Equal(t, queuedIDs([]*queuedXT{c}), queuedIDs(q.release(b.xtID)))
+				assert.Empty(t, q.stats()["chain_depth"])
+			},
+		},
+		{
+			name:  "rejects duplicates",
+			limit: 1,
+			run: func(t *testing.T, q *chainQueue) {
+				q.enqueue(newQueuedXT(1, "0x01"))
+				q.enqueue(newQueuedXT(2, "0x01"))
+
+				_, ok := q.enqueue(newQueuedXT(1, "0x01"))
+				assert.False(t, ok, "in flight")
+				_, ok = q.enqueue(newQueuedXT(2, "0x01"))
+				assert.False(t, ok, "waiting")
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+			tt.run(t, newChainQueue(tt.limit))
+		})
+	}
+}
+
+func TestPublisher_SerializesConflictingXTs(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainA, chainB, chainC := []byte{0x01}, []byte{0x02}, []byte{0x03}
+
+	srv := newFakeServer()
+	srv.connectChain("conn-a", "0x01")
+	srv.connectChain("conn-b", "0x02")
+	p := New(newTestConfig(""), srv, zerolog.Nop())
+	require.NoError(t, p.Start(ctx))
+
+	first := newXTRequestMessage(chainA, chainB)
+	firstID, err := first.GetXtRequest().XtID()
+	require.NoError(t, err)
+
+	second := newXTRequestMessage(chainB, chainC)
+	secondID, err := second.GetXtRequest().XtID()
+	require.NoError(t, err)
+
+	require.NoError(t, p.handleMessage(ctx, "conn-a", first))
+	require.NoError(t, p.handleMessage(ctx, "conn-a", second))
+
+	// Only the first xT is relayed; the second waits for chain B
+	assert.Equal(t, []*pb.Message{first}, srv.sentTo("conn-b"))
+	_, err = p.coordinator.GetTransactionState(secondID)
+	assert.ErrorIs(t, err, consensus.ErrUnknownTransaction)
+
+	require.NoError(t, p.handleMessage(ctx, "conn-a", newVoteMessage(chainA, firstID, false)))
+
+	// The abort decision goes out before the second xT is relayed for voting
+	sent := srv.sentTo("conn-b")
+	require.Len(t, sent, 3)
+	assert.NotNil(t, sent[1].GetDecided())
+	assert.Equal(t, second, sent[2])
+
+	state, err := p.coordinator.GetTransactionState(secondID)
+	require.NoError(t, err)
+	assert.Equal(t, consensus.StateUndecided, state)
+}
@@ -0,0 +1,92 @@
+package publisher
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/kchojn/poc-shared-publisher/internal/cluster"
+)
+
+// replicatedLog is a StateLog whose records are committed through the cluster,
+// so a new leader recovers the xTs of the previous one.
+type replicatedLog struct {
+	node    cluster.Node
+	timeout time.Duration
+}
+
+// NewReplicatedStateLog creates a StateLog replicated through node. Append
+// fails unless node leads the cluster and a majority stored the record
+// within timeout.
+func NewReplicatedStateLog(node cluster.Node, timeout time.Duration) StateLog {
+	return &replicatedLog{node: node, timeout: timeout}
+}
+
+// Append replicates a record and returns once it committed.
+func (l *replicatedLog) Append(rec Record) error {
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now()
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return fmt.Errorf("failed to marshal record: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), l.timeout)
+	defer cancel()
+
+	if err := l.node.Propose(ctx, data); err != nil {
+		return fmt.Errorf("failed to replicate record: %w", err)
+	}
+
+	return nil
+}
+
+// Replay calls fn for every committed record, in order.
+func (l *replicatedLog) Replay(fn func(Record) error) error {
+	return l.node.Committed(func(data []byte) error {
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return fmt.Errorf("failed to decode record: %w", err)
+		}
+		return fn(rec)
+	})
+}
+
+// Compact is a no-op; every node compacts its copy of the replicated log
+// with CompactReplicated, see cluster.Config.Compact.
+func (l *replicatedLog) Compact() error {
+	return nil
+}
+
+// Close is a no-op; the node outlives the publisher of a single leader term.
+func (l *replicatedLog) Close() error {
+	return nil
+}
+
+// CompactReplicated is the cluster.Config.Compact function of a replicated
+// decision log. It keeps the records of xTs whose decision has not reached
+// every participant yet.
+func CompactReplicated(data [][]byte) ([][]byte, error) {
+	records := make([]Record, len(data))
+	for i := range data {
+		if err := json.Unmarshal(data[i], &records[i]); err != nil {
+			return nil, fmt.Errorf("failed to decode record: %w", err)
+		}
+	}
+
+	x := newXTLog()
+	for _, rec := range records {
+		x.add(rec)
+	}
+
+	kept := make([][]byte, 0, len(data))
+	for i, rec := range records {
+		if x.pending(rec.XtID) != nil {
+			kept = append(kept, data[i])
+		}
+	}
+	return kept, nil
+}
@@ -0,0 +1,58 @@
+package publisher
+
+import (
+	"context"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/internal/types"
+)
+
+// reply acknowledges a request, or tells the sender why it failed. The reply
+// is addressed to the request, so a sequencer waiting on it gets it back.
+func (p *Publisher) reply(ctx context.Context, connID string, request *pb.Message, xtID *pb.XtID, err error) {
+	msg := newAckMessage(xtID)
+	if err != nil {
+		msg = newErrorMessage(xtID, err)
+	}
+
+	if sendErr := p.server.Reply(ctx, connID, request, msg); sendErr != nil {
+		p.log.Warn().
+			Err(sendErr).
+			Str("conn_id", connID).
+			Msg("Failed to reply to request")
+	}
+}
+
+// reportError tells the sequencer that submitted an xT about a failure after
+// its request was acknowledged.
+func (p *Publisher) reportError(ctx context.Context, connID string, xtID *pb.XtID, err error) {
+	if sendErr := p.server.Send(ctx, connID, newErrorMessage(xtID, err)); sendErr != nil {
+		p.log.Warn().
+			Err(sendErr).
+			Str("conn_id", connID).
+			Str("xt_id", xtID.Hex()).
+			Msg("Failed to report xT error")
+	}
+}
+
+func newAckMessage(xtID *pb.XtID) *pb.Message {
+	return &pb.Message{
+		SenderId: publisherSenderID,
+		Payload: &pb.Message_Ack{
+			Ack: &pb.Ack{XtId: xtID},
+		},
+	}
+}
+
+func newErrorMessage(xtID *pb.XtID, err error) *pb.Message {
+	return &pb.Message{
+		SenderId: publisherSenderID,
+		Payload: &pb.Message_Error{
+			Error: &pb.Error{
+				Code:    string(types.Code(err)),
+				Message: err.Error(),
+				XtId:    xtID,
+			},
+		},
+	}
+}
@@ -0,0 +1,185 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/internal/types"
+)
+
+// lastReply returns the last Ack or Error sent to a connection.
+func lastReply(t *testing.T, srv *fakeServer, connID string) *pb.Message {
+	t.Helper()
+	sent := srv.sentTo(connID)
+	for i := len(sent) - 1; i >= 0; i-- {
+		if sent[i].GetAck() != nil || sent[i].GetError() != nil {
+			return sent[i]
+		}
+	}
+	t.Fatalf("no reply sent to %s", connID)
+	return nil
+}
+
+func TestPublisher_RepliesToEveryRequest(t *testing.T) {
+	t.Parallel()
+
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+
+	accepted := newXTRequestMessage(chainA, chainB)
+	acceptedID, err := accepted.GetXtRequest().XtID()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		msg      *pb.Message
+		wantCode types.ErrorCode // Empty expects an Ack
+		wantXtID *pb.XtID
+	}{
+		{
+			name:     "xT request",
+			msg:      newXTRequestMessage(chainA, chainB),
+			wantXtID: acceptedID,
+		},
+		{
+			name:     "duplicate xT request",
+			msg:      accepted,
+			wantCode: types.ErrCodeDuplicateXT,
+			wantXtID: acceptedID,
+		},
+		{
+			name:     "xT request without transactions",
+			msg:      &pb.Message{Payload: &pb.Message_XtRequest{XtRequest: &pb.XTRequest{}}},
+			wantCode: types.ErrCodeInvalidRequest,
+		},
+		{
+			name:     "xT request without chain ID",
+			msg:      newXTRequestMessage(chainA, nil),
+			wantCode: types.ErrCodeInvalidRequest,
+		},
+		{
+			name:     "vote",
+			msg:      newVoteMessage(chainA, acceptedID, true),
+			wantXtID: acceptedID,
+		},
+		{
+			name:     "duplicate vote",
+			msg:      newVoteMessage(chainA, acceptedID, true),
+			wantCode: types.ErrCodeDuplicateVote,
+			wantXtID: acceptedID,
+		},
+		{
+			name:     "vote on unknown xT",
+			msg:      newVoteMessage(chainA, &pb.XtID{Hash: []byte{0xff}}, true),
+			wantCode: types.ErrCodeUnknownXT,
+			wantXtID: &pb.XtID{Hash: []byte{0xff}},
+		},
+		{
+			name:     "seal with slots disabled",
+			msg:      &pb.Message{Payload: &pb.Message_BlockSealed{BlockSealed: &pb.BlockSealed{Slot: 1}}},
+			wantCode: types.ErrCodeUnsupported,
+		},
+		{
+			name:     "payload sequencers do not send",
+			msg:      newDecidedMessage(acceptedID, true),
+			wantCode: types.ErrCodeUnsupported,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srv := newFakeServer()
+	srv.connectChain("conn-a", "0x01")
+	srv.connectChain("conn-b", "0x02")
+	p := New(newTestConfig(""), srv, zerolog.Nop())
+	require.NoError(t, p.Start(ctx))
+
+	// Requests run in order, later ones depend on the state left by earlier ones
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.msg.CorrelationId = uint64(i + 1)
+			err := p.handleMessage(ctx, "conn-a", tt.msg)
+
+			reply := lastReply(t, srv, "conn-a")
+			assert.Equal(t, tt.msg.CorrelationId, reply.ReplyTo, "the reply is addressed to the request")
+			if tt.wantCode == "" {
+				require.NoError(t, err)
+				require.NotNil(t, reply.GetAck())
+				assert.Equal(t, tt.wantXtID.Hex(), reply.GetAck().XtId.Hex())
+				return
+			}
+
+			require.Error(t, err)
+			require.NotNil(t, reply.GetError())
+			assert.Equal(t, string(tt.wantCode), reply.GetError().Code)
+			assert.Equal(t, err.Error(), reply.GetError().Message)
+			assert.Equal(t, tt.wantXtID.Hex(), reply.GetError().XtId.Hex())
+		})
+	}
+}
+
+func TestPublisher_ReportsFailuresToSubmitter(t *testing.T) {
+	t.Parallel()
+
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+
+	t.Run("routing", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		srv := newFakeServer()
+		srv.connectChain("conn-a", "0x01")
+		srv.connectChain("conn-b", "0x02")
+		srv.sendErr["conn-b"] = errors.New("connection reset")
+		p := New(newTestConfig(""), srv, zerolog.Nop())
+		require.NoError(t, p.Start(ctx))
+
+		require.Error(t, p.handleMessage(ctx, "conn-a", newXTRequestMessage(chainA, chainB)))
+
+		reply := lastReply(t, srv, "conn-a").GetError()
+		require.NotNil(t, reply)
+		assert.Equal(t, string(types.ErrCodeRoutingFailed), reply.Code)
+	})
+
+	t.Run("decision", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		srv := newFakeServer()
+		srv.connectChain("conn-a", "0x01")
+		srv.connectChain("conn-b", "0x02")
+		p := New(newTestConfig(""), srv, zerolog.Nop())
+		require.NoError(t, p.Start(ctx))
+
+		msg := newXTRequestMessage(chainA, chainB)
+		xtID, err := msg.GetXtRequest().XtID()
+		require.NoError(t, err)
+
+		require.NoError(t, p.handleMessage(ctx, "conn-a", msg))
+
+		srv.mu.Lock()
+		srv.decidedErr["conn-b"] = errors.New("connection reset")
+		srv.mu.Unlock()
+
+		require.NoError(t, p.handleMessage(ctx, "conn-a", newVoteMessage(chainA, xtID, true)))
+		require.Error(t, p.handleMessage(ctx, "conn-b", newVoteMessage(chainB, xtID, true)))
+
+		// Both the voter that triggered the decision and the submitter learn about it
+		for _, connID := range []string{"conn-a", "conn-b"} {
+			reply := lastReply(t, srv, connID).GetError()
+			require.NotNil(t, reply, connID)
+			assert.Equal(t, string(types.ErrCodeBroadcastFailed), reply.Code)
+			assert.Equal(t, xtID.Hex(), reply.XtId.Hex())
+		}
+	})
+}
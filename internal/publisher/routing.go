@@ -0,0 +1,122 @@
+package publisher
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/pkg/metrics"
+)
+
+// route returns the connections serving any of chains, and the chains no
+// connection serves. A connection serves the chain announced in its handshake.
+func (p *Publisher) route(chains []string) (recipients map[string][]string, unroutable []string) {
+	recipients = make(map[string][]string)
+	served := make(map[string]bool, len(chains))
+
+	for _, info := range p.server.GetConnections() {
+		for _, chainID := range chains {
+			if info.ChainID == chainID {
+				recipients[info.ID] = append(recipients[info.ID], chainID)
+				served[chainID] = true
+			}
+		}
+	}
+
+	for _, chainID := range chains {
+		if !served[chainID] {
+			unroutable = append(unroutable, chainID)
+		}
+	}
+
+	return recipients, unroutable
+}
+
+// connectionChain returns the chain a connection announced in its handshake.
+func (p *Publisher) connectionChain(connID string) (string, bool) {
+	for _, info := range p.server.GetConnections() {
+		if info.ID == connID {
+			return info.ChainID, true
+		}
+	}
+	return "", false
+}
+
+// servedElsewhere reports whether a connection other than connID serves chainID.
+func (p *Publisher) servedElsewhere(chainID, connID string) bool {
+	for _, info := range p.server.GetConnections() {
+		if info.ID != connID && info.ChainID == chainID {
+			return true
+		}
+	}
+	return false
+}
+
+// relay delivers an xT request to the sequencers of its participant chains
+// and tells the submitter about chains without a connected sequencer.
+func (p *Publisher) relay(ctx context.Context, xt *queuedXT) error {
+	recipients, unroutable := p.route(xt.chains)
+
+	var errs []error
+	delivered := make(map[string]bool, len(xt.chains))
+	for connID, chains := range recipients {
+		if err := p.server.Send(ctx, connID, xt.msg); err != nil {
+			errs = append(errs, fmt.Errorf("connection %s: %w", connID, err))
+			continue
+		}
+		for _, chainID := range chains {
+			delivered[chainID] = true
+		}
+	}
+
+	for _, chainID := range xt.chains {
+		if delivered[chainID] {
+			metrics.XTRoutesTotal.WithLabelValues(chainID, "delivered").Inc()
+		}
+	}
+
+	if len(unroutable) > 0 {
+		for _, chainID := range unroutable {
+			metrics.XTRoutesTotal.WithLabelValues(chainID, "unroutable").Inc()
+		}
+
+		p.log.Warn().
+			Str("xt_id", xt.xtID.Hex()).
+			Strs("chains", unroutable).
+			Msg("No connected sequencer for xT participant chains")
+
+		if err := p.server.Send(ctx, xt.from, newUnroutableMessage(xt.xtID, xt.msg.GetXtRequest(), unroutable)); err != nil {
+			errs = append(errs, fmt.Errorf("failed to report unroutable chains: %w", err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// newUnroutableMessage reports the chains of req that have no connected sequencer.
+func newUnroutableMessage(xtID *pb.XtID, req *pb.XTRequest, chains []string) *pb.Message {
+	unroutable := make(map[string]bool, len(chains))
+	for _, chainID := range chains {
+		unroutable[chainID] = true
+	}
+
+	chainIDs := make([][]byte, 0, len(chains))
+	for _, tx := range req.Transactions {
+		chainID := pb.FormatChainID(tx.ChainId)
+		if unroutable[chainID] {
+			chainIDs = append(chainIDs, tx.ChainId)
+			delete(unroutable, chainID)
+		}
+	}
+
+	return &pb.Message{
+		SenderId: publisherSenderID,
+		Payload: &pb.Message_Unroutable{
+			Unroutable: &pb.Unroutable{
+				XtId:     xtID,
+				ChainIds: chainIDs,
+			},
+		},
+	}
+}
@@ -0,0 +1,91 @@
+package publisher
+
+import (
+	"context"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kchojn/poc-shared-publisher/internal/consensus"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+func TestPublisher_RoutesXTRequestsToParticipantChains(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	chainA, chainB, chainC, chainD := []byte{0x01}, []byte{0x02}, []byte{0x03}, []byte{0x04}
+
+	srv := newFakeServer()
+	srv.connectChain("conn-a", "0x01")
+	srv.connectChain("conn-b", "0x02")
+	srv.connectChain("conn-c", "0x03")
+	p := New(newTestConfig(""), srv, zerolog.Nop())
+	require.NoError(t, p.Start(ctx))
+
+	t.Run("only participants receive the request", func(t *testing.T) {
+		msg := newXTRequestMessage(chainA, chainB)
+		require.NoError(t, p.handleMessage(ctx, "conn-a", msg))
+
+		sent := srv.sentTo("conn-a")
+		require.Len(t, sent, 2)
+		assert.Equal(t, msg, sent[0])
+		assert.NotNil(t, sent[1].GetAck(), "the sender is acknowledged after the relay")
+
+		assert.Equal(t, []*pb.Message{msg}, srv.sentTo("conn-b"))
+		assert.Empty(t, srv.sentTo("conn-c"))
+	})
+
+	t.Run("chains without a sequencer are reported to the sender", func(t *testing.T) {
+		msg := newXTRequestMessage(chainC, chainD)
+		xtID, err := msg.GetXtRequest().XtID()
+		require.NoError(t, err)
+
+		require.NoError(t, p.handleMessage(ctx, "conn-c", msg))
+
+		sent := srv.sentTo("conn-c")
+		require.Len(t, sent, 3)
+		assert.Equal(t, msg, sent[0])
+		assert.NotNil(t, sent[2].GetAck())
+
+		unroutable := sent[1].GetUnroutable()
+		require.NotNil(t, unroutable)
+		assert.Equal(t, xtID.Hex(), unroutable.XtId.Hex())
+		assert.Equal(t, [][]byte{chainD}, unroutable.ChainIds)
+	})
+
+	t.Run("votes for another chain neither count nor route", func(t *testing.T) {
+		chainE, chainF, chainG := []byte{0x05}, []byte{0x06}, []byte{0x07}
+		srv.connectChain("conn-e", "0x05")
+		srv.connectChain("conn-x", "0x08")
+
+		first := newXTRequestMessage(chainE, chainF)
+		firstID, err := first.GetXtRequest().XtID()
+		require.NoError(t, err)
+		require.NoError(t, p.handleMessage(ctx, "conn-a", first))
+
+		err = p.handleMessage(ctx, "conn-x", newVoteMessage(chainE, firstID, false))
+		require.ErrorIs(t, err, ErrForeignChain)
+
+		state, err := p.coordinator.GetTransactionState(firstID)
+		require.NoError(t, err)
+		assert.Equal(t, consensus.StateUndecided, state, "the spoofed vote was not recorded")
+
+		// The real sequencer aborts, which admits the next xT on chain E
+		require.NoError(t, p.handleMessage(ctx, "conn-e", newVoteMessage(chainE, firstID, false)))
+
+		second := newXTRequestMessage(chainE, chainG)
+		require.NoError(t, p.handleMessage(ctx, "conn-a", second))
+
+		for _, msg := range srv.sentTo("conn-x") {
+			assert.Nil(t, msg.GetXtRequest(), "requests of chain E only go to its sequencer")
+		}
+		sent := srv.sentTo("conn-e")
+		require.NotEmpty(t, sent)
+		assert.Equal(t, second, sent[len(sent)-1])
+	})
+}
@@ -0,0 +1,265 @@
+package publisher
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/kchojn/poc-shared-publisher/internal/config"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+	"github.com/kchojn/poc-shared-publisher/internal/types"
+	"github.com/kchojn/poc-shared-publisher/pkg/metrics"
+)
+
+var (
+	// ErrFutureSlot is returned for acknowledgements of slots that have not started.
+	ErrFutureSlot = types.NewError(types.ErrCodeInvalidSlot, "seal acknowledgement for future slot")
+
+	// ErrSlotsDisabled is returned for acknowledgements when the scheduler is not running.
+	ErrSlotsDisabled = types.NewError(types.ErrCodeUnsupported, "slot scheduler disabled")
+)
+
+// slotScheduler drives synchronous rounds: every slot it broadcasts StartSlot,
+// then RequestSeal, and flags chains that do not acknowledge the seal in time.
+type slotScheduler struct {
+	cfg  config.SlotConfig
+	send func(ctx context.Context, msg *pb.Message) error
+	log  zerolog.Logger
+
+	mu          sync.Mutex
+	running     bool
+	slot        uint64
+	sealAt      time.Time
+	sealed      map[string]uint64 // Last slot each chain acknowledged
+	sealers     map[string]uint64 // Chains taking part in the slot protocol, by the slot they joined in
+	missedTotal map[string]uint64
+}
+
+func newSlotScheduler(
+	cfg config.SlotConfig,
+	send func(ctx context.Context, msg *pb.Message) error,
+	log zerolog.Logger,
+) *slotScheduler {
+	return &slotScheduler{
+		cfg:         cfg,
+		send:        send,
+		log:         log.With().Str("component", "slots").Logger(),
+		sealed:      make(map[string]uint64),
+		sealers:     make(map[string]uint64),
+		missedTotal: make(map[string]uint64),
+	}
+}
+
+// run drives the slot clock until ctx is cancelled.
+// Slot boundaries are computed from the start time so they do not drift.
+func (s *slotScheduler) run(ctx context.Context) {
+	genesis := time.Now()
+
+	s.mu.Lock()
+	s.running = true
+	s.mu.Unlock()
+
+	s.log.Info().
+		Dur("duration", s.cfg.Duration).
+		Dur("seal_offset", s.cfg.SealOffset).
+		Dur("seal_deadline", s.cfg.SealDeadline).
+		Msg("Slot scheduler started")
+
+	for slot := uint64(1); ; slot++ {
+		start := genesis.Add(time.Duration(slot-1) * s.cfg.Duration)
+
+		if !sleepUntil(ctx, start) {
+			return
+		}
+		s.startSlot(ctx, slot, start)
+
+		if !sleepUntil(ctx, start.Add(s.cfg.SealOffset)) {
+			return
+		}
+		s.requestSeal(ctx, slot)
+
+		if !sleepUntil(ctx, start.Add(s.cfg.SealOffset+s.cfg.SealDeadline)) {
+			return
+		}
+		s.checkSeals(slot)
+	}
+}
+
+func (s *slotScheduler) startSlot(ctx context.Context, slot uint64, start time.Time) {
+	s.mu.Lock()
+	s.slot = slot
+	s.sealAt = time.Time{}
+	s.mu.Unlock()
+
+	metrics.SlotCurrent.Set(float64(slot))
+
+	msg := &pb.Message{
+		SenderId: publisherSenderID,
+		Payload: &pb.Message_StartSlot{
+			StartSlot: &pb.StartSlot{Slot: slot, Timestamp: start.UnixMilli()},
+		},
+	}
+
+	if err := s.send(ctx, msg); err != nil {
+		s.log.Error().Err(err).Uint64("slot", slot).Msg("Failed to broadcast StartSlot")
+		metrics.RecordError("broadcast_failed", "start_slot")
+		return
+	}
+
+	s.log.Debug().Uint64("slot", slot).Msg("Slot started")
+}
+
+func (s *slotScheduler) requestSeal(ctx context.Context, slot uint64) {
+	s.mu.Lock()
+	s.sealAt = time.Now()
+	s.mu.Unlock()
+
+	msg := &pb.Message{
+		SenderId: publisherSenderID,
+		Payload: &pb.Message_RequestSeal{
+			RequestSeal: &pb.RequestSeal{Slot: slot},
+		},
+	}
+
+	if err := s.send(ctx, msg); err != nil {
+		s.log.Error().Err(err).Uint64("slot", slot).Msg("Failed to broadcast RequestSeal")
+		metrics.RecordError("broadcast_failed", "request_seal")
+		return
+	}
+
+	s.log.Debug().Uint64("slot", slot).Msg("Seal requested")
+}
+
+// checkSeals flags every participating chain that did not seal the slot.
+// Chains that joined during the slot are expected to seal from the next one.
+func (s *slotScheduler) checkSeals(slot uint64) {
+	s.mu.Lock()
+	var missed []string
+	for chainID, joined := range s.sealers {
+		if joined < slot && s.sealed[chainID] < slot {
+			missed = append(missed, chainID)
+			s.missedTotal[chainID]++
+		}
+	}
+	s.mu.Unlock()
+
+	sort.Strings(missed)
+	for _, chainID := range missed {
+		metrics.SlotSealsMissedTotal.WithLabelValues(chainID).Inc()
+	}
+
+	if len(missed) > 0 {
+		s.log.Warn().
+			Uint64("slot", slot).
+			Strs("chains", missed).
+			Msg("Chains missed the seal deadline")
+	}
+}
+
+// handleSealed records a sealed-block acknowledgement from a connection that
+// announced the chain served in its handshake.
+func (s *slotScheduler) handleSealed(from, served string, ack *pb.BlockSealed) error {
+	chainID := pb.FormatChainID(ack.ChainId)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.running {
+		return ErrSlotsDisabled
+	}
+
+	// Only the sequencer of a chain may seal for it
+	if chainID != served {
+		metrics.RecordError("seal_rejected", "block_sealed")
+		return fmt.Errorf("%w: %s sealed for %s", ErrForeignChain, from, chainID)
+	}
+
+	if ack.Slot > s.slot {
+		return fmt.Errorf("%w: got %d, current %d", ErrFutureSlot, ack.Slot, s.slot)
+	}
+
+	if _, ok := s.sealers[chainID]; !ok {
+		s.sealers[chainID] = s.slot
+	}
+	if ack.Slot > s.sealed[chainID] {
+		s.sealed[chainID] = ack.Slot
+	}
+
+	status := "on_time"
+	deadline := s.sealAt.Add(s.cfg.SealDeadline)
+	switch {
+	case ack.Slot < s.slot, s.sealAt.IsZero():
+		status = "late"
+	case time.Now().After(deadline):
+		status = "late"
+	default:
+		metrics.SlotSealLatency.Observe(time.Since(s.sealAt).Seconds())
+	}
+
+	metrics.SlotSealsTotal.WithLabelValues(chainID, status).Inc()
+
+	s.log.Debug().
+		Str("from", from).
+		Str("chain_id", chainID).
+		Uint64("slot", ack.Slot).
+		Uint64("block_number", ack.BlockNumber).
+		Str("status", status).
+		Msg("Block sealed")
+
+	return nil
+}
+
+// addChain starts expecting seals from a chain, e.g. after its sequencer connected.
+func (s *slotScheduler) addChain(chainID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.sealers[chainID]; !ok {
+		s.sealers[chainID] = s.slot
+	}
+}
+
+// removeChain stops expecting seals from a chain, e.g. after its sequencer disconnected.
+func (s *slotScheduler) removeChain(chainID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.sealers, chainID)
+}
+
+// stats returns the scheduler state for GetStats.
+func (s *slotScheduler) stats() map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sealed := make(map[string]uint64, len(s.sealed))
+	for chainID, slot := range s.sealed {
+		sealed[chainID] = slot
+	}
+
+	missed := make(map[string]uint64, len(s.missedTotal))
+	for chainID, count := range s.missedTotal {
+		missed[chainID] = count
+	}
+
+	return map[string]interface{}{
+		"current_slot":     s.slot,
+		"last_sealed_slot": sealed,
+		"missed_seals":     missed,
+	}
+}
+
+// sleepUntil waits until t and reports false if ctx was cancelled first.
+func sleepUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,102 @@
+package publisher
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/kchojn/poc-shared-publisher/internal/config"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+func TestSlotScheduler(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		mu   sync.Mutex
+		sent []*pb.Message
+	)
+	send := func(_ context.Context, msg *pb.Message) error {
+		mu.Lock()
+		defer mu.Unlock()
+		sent = append(sent, msg)
+		return nil
+	}
+
+	s := newSlotScheduler(config.SlotConfig{
+		Enabled:      true,
+		Duration:     150 * time.Millisecond,
+		SealOffset:   50 * time.Millisecond,
+		SealDeadline: 50 * time.Millisecond,
+	}, send, zerolog.Nop())
+
+	require.ErrorIs(t, s.handleSealed("conn", "", &pb.BlockSealed{Slot: 1}), ErrSlotsDisabled)
+
+	go s.run(ctx)
+
+	chainA, chainB := []byte{0x01}, []byte{0x02}
+
+	// Both chains seal slot 1, only chain A seals slot 2
+	require.Eventually(t, func() bool { return s.stats()["current_slot"] == uint64(1) }, time.Second, 5*time.Millisecond)
+	require.NoError(t, s.handleSealed("conn-a", "0x01", &pb.BlockSealed{Slot: 1, ChainId: chainA}))
+	require.NoError(t, s.handleSealed("conn-b", "0x02", &pb.BlockSealed{Slot: 1, ChainId: chainB}))
+	require.ErrorIs(t, s.handleSealed("conn-a", "0x01", &pb.BlockSealed{Slot: 5, ChainId: chainA}), ErrFutureSlot)
+	require.ErrorIs(t, s.handleSealed("conn-a", "0x01", &pb.BlockSealed{Slot: 1, ChainId: chainB}), ErrForeignChain)
+
+	require.Eventually(t, func() bool { return s.stats()["current_slot"] == uint64(2) }, time.Second, 5*time.Millisecond)
+	require.NoError(t, s.handleSealed("conn-a", "0x01", &pb.BlockSealed{Slot: 2, ChainId: chainA}))
+
+	require.Eventually(t, func() bool {
+		missed := s.stats()["missed_seals"].(map[string]uint64)
+		return missed["0x02"] == 1
+	}, time.Second, 5*time.Millisecond)
+
+	missed := s.stats()["missed_seals"].(map[string]uint64)
+	assert.Zero(t, missed["0x01"])
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.GreaterOrEqual(t, len(sent), 4)
+	assert.Equal(t, uint64(1), sent[0].GetStartSlot().GetSlot())
+	assert.Equal(t, uint64(1), sent[1].GetRequestSeal().GetSlot())
+	assert.Equal(t, uint64(2), sent[2].GetStartSlot().GetSlot())
+	assert.Equal(t, uint64(2), sent[3].GetRequestSeal().GetSlot())
+}
+
+func TestSlotScheduler_ExpectsConnectedChains(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	send := func(context.Context, *pb.Message) error { return nil }
+	s := newSlotScheduler(config.SlotConfig{Enabled: true, SealDeadline: time.Second}, send, zerolog.Nop())
+
+	missed := func() map[string]uint64 { return s.stats()["missed_seals"].(map[string]uint64) }
+
+	// A connected chain is expected to seal even if it never did
+	s.addChain("0x01")
+	s.startSlot(ctx, 1, time.Now())
+	s.checkSeals(1)
+	assert.Equal(t, uint64(1), missed()["0x01"])
+
+	// Joining during a slot, a chain is expected to seal from the next one
+	s.startSlot(ctx, 2, time.Now())
+	s.addChain("0x02")
+	s.checkSeals(2)
+	assert.Equal(t, uint64(2), missed()["0x01"])
+	assert.Zero(t, missed()["0x02"])
+
+	// Once disconnected, it is not
+	s.removeChain("0x01")
+	s.startSlot(ctx, 3, time.Now())
+	s.checkSeals(3)
+	assert.Equal(t, uint64(2), missed()["0x01"])
+	assert.Equal(t, uint64(1), missed()["0x02"])
+}
@@ -1 +1,664 @@
 package publisher
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/kchojn/poc-shared-publisher/internal/network"
+	pb "github.com/kchojn/poc-shared-publisher/internal/proto"
+)
+
+const (
+	stateLogFile     = "xt.wal"
+	recordHeaderSize = 8 // 4-byte length + 4-byte CRC32C
+	maxRecordSize    = 64 * 1024 * 1024
+
+	// stateCompactEvery is how many xTs reach every participant between two
+	// compactions of the decision log.
+	stateCompactEvery = 1024
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// RecordType identifies an xT state transition.
+type RecordType string
+
+const (
+	RecordProposed  RecordType = "proposed"
+	RecordVoted     RecordType = "voted"
+	RecordDecided   RecordType = "decided"
+	RecordDelivered RecordType = "delivered"
+)
+
+// Record is a single entry of the decision log.
+type Record struct {
+	Type      RecordType `json:"type"`
+	XtID      string     `json:"xt_id"`
+	Timestamp time.Time  `json:"ts"`
+
+	// Proposed; for Delivered the chains that received the decision, all if empty
+	Chains  []string `json:"chains,omitempty"`
+	Request []byte   `json:"request,omitempty"` // Marshalled XTRequest
+
+	// Voted
+	ChainID string `json:"chain_id,omitempty"`
+	Vote    bool   `json:"vote,omitempty"`
+
+	// Decided
+	Decision bool `json:"decision,omitempty"`
+}
+
+// StateLog is an append-only log of xT state transitions.
+type StateLog interface {
+	// Append durably writes a record
+	Append(rec Record) error
+	// Replay calls fn for every record in the log, in order
+	Replay(fn func(Record) error) error
+	// Compact drops the records of xTs whose decision reached every participant
+	Compact() error
+	// Close closes the log
+	Close() error
+}
+
+// fileLog is a StateLog backed by an fsync'd file.
+//
+// Each record is framed as a 4-byte big-endian length, a 4-byte CRC32C of the
+// payload and the JSON encoded record. A torn or corrupted tail left by a crash
+// is truncated on replay. Compact writes the live records to a new file and
+// renames it over the log, so a crash leaves either the old or the new log.
+type fileLog struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// OpenStateLog opens (or creates) the decision log in dir.
+func OpenStateLog(dir string) (StateLog, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create state dir: %w", err)
+	}
+
+	file, err := os.OpenFile(filepath.Join(dir, stateLogFile), os.O_CREATE|os.O_RDWR, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state log: %w", err)
+	}
+
+	return &fileLog{file: file}, nil
+}
+
+// Append durably writes a record.
+func (l *fileLog) Append(rec Record) error {
+	if rec.Timestamp.IsZero() {
+		rec.Timestamp = time.Now()
+	}
+
+	buf, err := frameRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Seek(0, io.SeekEnd); err != nil {
+		return fmt.Errorf("failed to seek state log: %w", err)
+	}
+
+	if _, err := l.file.Write(buf); err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync state log: %w", err)
+	}
+
+	return nil
+}
+
+// Replay calls fn for every intact record and truncates a damaged tail.
+func (l *fileLog) Replay(fn func(Record) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.replayLocked(fn)
+}
+
+// replayLocked replays the log. Caller must hold l.mu.
+func (l *fileLog) replayLocked(fn func(Record) error) error {
+	if _, err := l.file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to seek state log: %w", err)
+	}
+
+	r := bufio.NewReader(l.file)
+	header := make([]byte, recordHeaderSize)
+
+	var offset int64
+	for {
+		rec, n, err := readRecord(r, header)
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			// Torn write or corruption: drop everything after the last good record
+			if terr := l.file.Truncate(offset); terr != nil {
+				return fmt.Errorf("failed to truncate state log after %v: %w", err, terr)
+			}
+			return nil
+		}
+
+		if err := fn(rec); err != nil {
+			return err
+		}
+
+		offset += n
+	}
+}
+
+// Compact rewrites the log without the records of xTs whose decision reached
+// every participant.
+func (l *fileLog) Compact() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var records []Record
+	if err := l.replayLocked(func(rec Record) error {
+		records = append(records, rec)
+		return nil
+	}); err != nil {
+		return err
+	}
+
+	live := liveRecords(records)
+	if len(live) == len(records) {
+		return nil
+	}
+
+	path := l.file.Name()
+	tmp := path + ".compact"
+
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to create compacted state log: %w", err)
+	}
+
+	if err := writeRecords(file, live); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, path); err != nil {
+		file.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace state log: %w", err)
+	}
+
+	l.file.Close()
+	l.file = file
+
+	return nil
+}
+
+// writeRecords durably writes framed records to file.
+func writeRecords(file *os.File, records []Record) error {
+	w := bufio.NewWriter(file)
+	for _, rec := range records {
+		buf, err := frameRecord(rec)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(buf); err != nil {
+			return fmt.Errorf("failed to write record: %w", err)
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write record: %w", err)
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync state log: %w", err)
+	}
+
+	return nil
+}
+
+// Close closes the log.
+func (l *fileLog) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// frameRecord encodes a record with its length and checksum header.
+func frameRecord(rec Record) ([]byte, error) {
+	payload, err := json.Marshal(rec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal record: %w", err)
+	}
+
+	buf := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:8], crc32.Checksum(payload, crcTable))
+	copy(buf[recordHeaderSize:], payload)
+
+	return buf, nil
+}
+
+// readRecord reads a single framed record and returns it with its size on disk.
+func readRecord(r io.Reader, header []byte) (Record, int64, error) {
+	var rec Record
+
+	if _, err := io.ReadFull(r, header); err != nil {
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			return rec, 0, fmt.Errorf("truncated record header: %w", err)
+		}
+		return rec, 0, err
+	}
+
+	length := binary.BigEndian.Uint32(header[0:4])
+	checksum := binary.BigEndian.Uint32(header[4:8])
+
+	if length > maxRecordSize {
+		return rec, 0, fmt.Errorf("record size %d exceeds max %d", length, maxRecordSize)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return rec, 0, fmt.Errorf("truncated record: %w", io.ErrUnexpectedEOF)
+	}
+
+	if crc32.Checksum(payload, crcTable) != checksum {
+		return rec, 0, errors.New("record checksum mismatch")
+	}
+
+	if err := json.Unmarshal(payload, &rec); err != nil {
+		return rec, 0, fmt.Errorf("failed to unmarshal record: %w", err)
+	}
+
+	return rec, int64(recordHeaderSize) + int64(length), nil
+}
+
+// nopLog is used when no state directory is configured.
+type nopLog struct{}
+
+func (nopLog) Append(Record) error             { return nil }
+func (nopLog) Replay(func(Record) error) error { return nil }
+func (nopLog) Compact() error                  { return nil }
+func (nopLog) Close() error                    { return nil }
+
+// pendingDecision is a decision that has not yet reached every participant.
+type pendingDecision struct {
+	xtID      string
+	decision  bool
+	chains    []string
+	delivered map[string]struct{} // Participant chains the decision reached
+	unlogged  bool                // Decided record not written yet
+}
+
+func newPendingDecision(xtID string, decision bool, chains, delivered []string) *pendingDecision {
+	d := &pendingDecision{
+		xtID:      xtID,
+		decision:  decision,
+		chains:    chains,
+		delivered: make(map[string]struct{}, len(delivered)),
+	}
+	for _, chainID := range delivered {
+		d.delivered[chainID] = struct{}{}
+	}
+	return d
+}
+
+// awaits reports whether the sequencer of chainID still needs the decision.
+func (d *pendingDecision) awaits(chainID string) bool {
+	if _, ok := d.delivered[chainID]; ok {
+		return false
+	}
+	// Without known participants any sequencer may take the decision
+	return len(d.chains) == 0 || slices.Contains(d.chains, chainID)
+}
+
+// done reports whether every participant chain received the decision.
+func (d *pendingDecision) done() bool {
+	if len(d.chains) == 0 {
+		return len(d.delivered) > 0
+	}
+	for _, chainID := range d.chains {
+		if _, ok := d.delivered[chainID]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// xtEntry is the state of an xT as recorded in the decision log.
+type xtEntry struct {
+	chains       []string
+	decided      bool
+	decision     bool
+	delivered    []string
+	deliveredAll bool
+}
+
+// xtLog folds decision log records into the state of each xT.
+type xtLog struct {
+	entries map[string]*xtEntry
+	order   []string // xT IDs by first record
+}
+
+func newXTLog() *xtLog {
+	return &xtLog{entries: make(map[string]*xtEntry)}
+}
+
+func (x *xtLog) add(rec Record) {
+	entry, ok := x.entries[rec.XtID]
+	if !ok {
+		entry = &xtEntry{}
+		x.entries[rec.XtID] = entry
+		x.order = append(x.order, rec.XtID)
+	}
+
+	switch rec.Type {
+	case RecordProposed:
+		entry.chains = rec.Chains
+	case RecordDecided:
+		entry.decided = true
+		entry.decision = rec.Decision
+	case RecordDelivered:
+		// Records without chains were written before delivery was tracked per chain
+		entry.deliveredAll = entry.deliveredAll || len(rec.Chains) == 0
+		entry.delivered = append(entry.delivered, rec.Chains...)
+	case RecordVoted:
+	}
+}
+
+// pending returns the decision of an xT that has not reached every
+// participant yet, or nil once it has.
+func (x *xtLog) pending(xtID string) *pendingDecision {
+	entry := x.entries[xtID]
+	if entry.deliveredAll {
+		return nil
+	}
+
+	d := newPendingDecision(xtID, entry.decided && entry.decision, entry.chains, entry.delivered)
+	if d.done() {
+		return nil
+	}
+	return d
+}
+
+// liveRecords returns the records of xTs whose decision has not reached every
+// participant yet, in log order. The others are not needed for recovery.
+func liveRecords(records []Record) []Record {
+	x := newXTLog()
+	for _, rec := range records {
+		x.add(rec)
+	}
+
+	live := make([]Record, 0, len(records))
+	for _, rec := range records {
+		if x.pending(rec.XtID) != nil {
+			live = append(live, rec)
+		}
+	}
+	return live
+}
+
+// recoveredState is the result of replaying the decision log.
+type recoveredState struct {
+	undecided []string // xTs proposed but never decided
+	pending   map[string]*pendingDecision
+}
+
+// recoverState rebuilds the xT state from the decision log.
+func recoverState(log StateLog) (*recoveredState, error) {
+	x := newXTLog()
+
+	err := log.Replay(func(rec Record) error {
+		x.add(rec)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to replay state log: %w", err)
+	}
+
+	state := &recoveredState{pending: make(map[string]*pendingDecision)}
+
+	for _, xtID := range x.order {
+		d := x.pending(xtID)
+		if d == nil {
+			continue
+		}
+		if !x.entries[xtID].decided {
+			state.undecided = append(state.undecided, xtID)
+		}
+
+		state.pending[xtID] = d
+	}
+
+	return state, nil
+}
+
+// openState opens the decision log and recovers xTs left over by a previous run.
+// Undecided xTs are aborted; undelivered decisions are resent as sequencers reconnect.
+func (p *Publisher) openState() error {
+	stateLog := p.stateLog
+	if stateLog == nil {
+		if p.cfg.State.Dir == "" {
+			p.log.Warn().Msg("State directory not configured, decisions will not survive a restart")
+			p.stateLog = nopLog{}
+			return nil
+		}
+
+		var err error
+		if stateLog, err = OpenStateLog(p.cfg.State.Dir); err != nil {
+			return err
+		}
+	}
+
+	recovered, err := recoverState(stateLog)
+	if err != nil {
+		stateLog.Close()
+		return err
+	}
+
+	for _, xtID := range recovered.undecided {
+		if err := stateLog.Append(Record{Type: RecordDecided, XtID: xtID, Decision: false}); err != nil {
+			stateLog.Close()
+			return fmt.Errorf("failed to log recovered abort: %w", err)
+		}
+	}
+
+	// Records of xTs that reached every participant are no longer needed
+	if err := stateLog.Compact(); err != nil {
+		p.log.Warn().Err(err).Msg("Failed to compact decision log")
+	}
+
+	p.stateLog = stateLog
+
+	p.mu.Lock()
+	p.pending = recovered.pending
+	p.mu.Unlock()
+
+	p.log.Info().
+		Int("aborted", len(recovered.undecided)).
+		Int("pending_decisions", len(recovered.pending)).
+		Msg("Recovered state from decision log")
+
+	return nil
+}
+
+// logProposed writes the proposed record of a new xT and remembers its chains.
+func (p *Publisher) logProposed(xtID *pb.XtID, req *pb.XTRequest) error {
+	data, err := proto.Marshal(req)
+	if err != nil {
+		return fmt.Errorf("failed to marshal xT request: %w", err)
+	}
+
+	chains := requestChains(req)
+
+	p.mu.Lock()
+	p.xtChains[xtID.Hex()] = chains
+	p.mu.Unlock()
+
+	return p.stateLog.Append(Record{
+		Type:    RecordProposed,
+		XtID:    xtID.Hex(),
+		Chains:  chains,
+		Request: data,
+	})
+}
+
+// requestChains returns the distinct chains of an xT request in request order.
+func requestChains(req *pb.XTRequest) []string {
+	seen := make(map[string]struct{})
+	var chains []string
+	for _, tx := range req.Transactions {
+		chainID := pb.FormatChainID(tx.ChainId)
+		if _, ok := seen[chainID]; !ok {
+			seen[chainID] = struct{}{}
+			chains = append(chains, chainID)
+		}
+	}
+	return chains
+}
+
+// addPending keeps a decision for redelivery to the sequencers of the
+// participant chains it has not reached yet.
+func (p *Publisher) addPending(xtID *pb.XtID, decision bool, chains, delivered []string) {
+	p.mu.Lock()
+	p.pending[xtID.Hex()] = newPendingDecision(xtID.Hex(), decision, chains, delivered)
+	p.mu.Unlock()
+}
+
+// addUnlogged keeps a decision whose decided record could not be written.
+// It is delivered once a retried write succeeds.
+func (p *Publisher) addUnlogged(xtID *pb.XtID, decision bool, chains []string) {
+	d := newPendingDecision(xtID.Hex(), decision, chains, nil)
+	d.unlogged = true
+
+	p.mu.Lock()
+	p.pending[xtID.Hex()] = d
+	p.mu.Unlock()
+}
+
+// logPending writes the decided record of a decision kept by addUnlogged, so
+// no sequencer learns a decision a restart would not recover. It reports
+// whether the decision is logged.
+func (p *Publisher) logPending(d *pendingDecision) bool {
+	p.mu.RLock()
+	unlogged := d.unlogged
+	p.mu.RUnlock()
+
+	if !unlogged {
+		return true
+	}
+
+	if err := p.stateLog.Append(Record{Type: RecordDecided, XtID: d.xtID, Decision: d.decision}); err != nil {
+		p.log.Error().Err(err).Str("xt_id", d.xtID).Msg("Failed to log pending decision")
+		return false
+	}
+
+	p.mu.Lock()
+	d.unlogged = false
+	p.mu.Unlock()
+
+	p.history.decided(d.xtID, d.decision)
+
+	return true
+}
+
+// handleConnect expects seals from the chain of a newly connected sequencer
+// and resends it the undelivered decisions of that chain.
+func (p *Publisher) handleConnect(info network.ConnectionInfo) {
+	if info.ChainID == "" {
+		return
+	}
+
+	p.slots.addChain(info.ChainID)
+
+	p.mu.Lock()
+	pending := make([]*pendingDecision, 0, len(p.pending))
+	for _, d := range p.pending {
+		if d.awaits(info.ChainID) {
+			pending = append(pending, d)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, d := range pending {
+		hash, err := hex.DecodeString(d.xtID)
+		if err != nil || !p.logPending(d) {
+			continue
+		}
+
+		msg := newDecidedMessage(&pb.XtID{Hash: hash}, d.decision)
+		if err := p.server.Send(context.Background(), info.ID, msg); err != nil {
+			p.log.Error().
+				Err(err).
+				Str("conn_id", info.ID).
+				Str("xt_id", d.xtID).
+				Msg("Failed to redeliver decision")
+			continue
+		}
+
+		p.log.Info().
+			Str("conn_id", info.ID).
+			Str("chain_id", info.ChainID).
+			Str("xt_id", d.xtID).
+			Bool("decision", d.decision).
+			Msg("Redelivered decision")
+
+		p.markRedelivered(d, info.ChainID)
+	}
+}
+
+// markRedelivered records that the sequencer of chainID received a decision
+// and retires the decision once every participant chain has.
+func (p *Publisher) markRedelivered(d *pendingDecision, chainID string) {
+	p.mu.Lock()
+	d.delivered[chainID] = struct{}{}
+	done := d.done()
+	if done {
+		delete(p.pending, d.xtID)
+	}
+	p.mu.Unlock()
+
+	if err := p.stateLog.Append(Record{Type: RecordDelivered, XtID: d.xtID, Chains: []string{chainID}}); err != nil {
+		p.log.Error().Err(err).Str("xt_id", d.xtID).Msg("Failed to log delivery")
+	}
+
+	if done {
+		p.retire(d.xtID)
+	}
+}
+
+// retire records that the decision of an xT reached every participant and
+// compacts the decision log every stateCompactEvery such xTs.
+func (p *Publisher) retire(xtID string) {
+	p.history.delivered(xtID)
+
+	if p.retired.Add(1)%stateCompactEvery != 0 || !p.compacting.CompareAndSwap(false, true) {
+		return
+	}
+
+	go func() {
+		defer p.compacting.Store(false)
+		if err := p.stateLog.Compact(); err != nil {
+			p.log.Error().Err(err).Msg("Failed to compact decision log")
+		}
+	}()
+}
@@ -1 +1,59 @@
 package types
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrorCode is a machine-readable reason a request failed. It is sent to
+// sequencers in pb.Error, so released codes must not change.
+type ErrorCode string
+
+const (
+	ErrCodeInternal        ErrorCode = "internal"         // Unexpected publisher failure
+	ErrCodeInvalidRequest  ErrorCode = "invalid_request"  // Malformed request, e.g. without transactions
+	ErrCodeUnsupported     ErrorCode = "unsupported"      // Payload the publisher does not handle
+	ErrCodeUnauthenticated ErrorCode = "unauthenticated"  // Unsigned message, or signature not from an allowlisted key
+	ErrCodeDuplicateXT     ErrorCode = "duplicate_xt"     // xT with the same ID already in progress
+	ErrCodeUnknownXT       ErrorCode = "unknown_xt"       // Vote on an xT that is not in progress
+	ErrCodeNotParticipant  ErrorCode = "not_participant"  // Vote from a chain outside the xT
+	ErrCodeDuplicateVote   ErrorCode = "duplicate_vote"   // Second vote of a chain on the same xT
+	ErrCodeInvalidSlot     ErrorCode = "invalid_slot"     // Seal for a slot that is not being sealed
+	ErrCodeStateLogFailed  ErrorCode = "state_log_failed" // Request could not be persisted
+	ErrCodeRoutingFailed   ErrorCode = "routing_failed"   // xT request could not be relayed to a participant
+	ErrCodeBroadcastFailed ErrorCode = "broadcast_failed" // Decision could not be sent to a participant
+)
+
+// Error is an error with the code reported to the sequencer.
+type Error struct {
+	Code ErrorCode
+	Err  error
+}
+
+// NewError creates an error with code, for use as a sentinel.
+func NewError(code ErrorCode, msg string) *Error {
+	return &Error{Code: code, Err: errors.New(msg)}
+}
+
+// Errorf formats an error with code; %w wraps like fmt.Errorf.
+func Errorf(code ErrorCode, format string, args ...interface{}) *Error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Code returns the code of the outermost Error in err's chain, or
+// ErrCodeInternal if there is none.
+func Code(err error) ErrorCode {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ErrCodeInternal
+}
@@ -32,6 +32,36 @@ var (
 		Help: "Total number of messages sent",
 	}, []string{"type"})
 
+	ConnectionRTT = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "publisher_connection_rtt_seconds",
+		Help: "Last heartbeat round-trip time per connection",
+	}, []string{"conn_id"})
+
+	ConnectionQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "publisher_connection_queue_depth",
+		Help: "Messages waiting in the outbound queue per connection",
+	}, []string{"conn_id"})
+
+	ConnectionQueueDropped = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_connection_queue_dropped_total",
+		Help: "Total number of messages dropped from a full outbound queue per connection",
+	}, []string{"conn_id"})
+
+	MessagesUnsupported = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_messages_unsupported_total",
+		Help: "Total number of received payloads the publisher does not accept",
+	}, []string{"type"})
+
+	MessagesUnauthenticated = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_messages_unauthenticated_total",
+		Help: "Total number of sequencer messages failing signature verification",
+	}, []string{"reason"})
+
+	FramesCorrupted = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_frames_corrupted_total",
+		Help: "Total number of received frames with a bad checksum, magic or header version",
+	}, []string{"reason"})
+
 	MessageSize = promauto.NewHistogramVec(prometheus.HistogramOpts{
 		Name:    "publisher_message_size_bytes",
 		Help:    "Message size in bytes",
@@ -82,6 +112,11 @@ var (
 		Help: "Uptime in seconds",
 	})
 
+	XTRoutesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_xt_routes_total",
+		Help: "Total number of xT requests routed to participant chains",
+	}, []string{"chain_id", "result"}) // result: delivered, unroutable
+
 	CrossChainTransactionsTotal = promauto.NewCounter(prometheus.CounterOpts{
 		Name: "publisher_cross_chain_transactions_total",
 		Help: "Total number of cross-chain transactions",
@@ -91,6 +126,83 @@ var (
 		Name: "publisher_unique_chains",
 		Help: "Number of unique chains seen",
 	}, []string{"chain_id"})
+
+	TwoPCActiveTransactions = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "publisher_2pc_active_transactions",
+		Help: "Number of cross-chain transactions awaiting a decision",
+	})
+
+	TwoPCVotesTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_2pc_votes_total",
+		Help: "Total number of 2PC votes received",
+	}, []string{"vote"}) // vote: commit, abort
+
+	TwoPCDecisionsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_2pc_decisions_total",
+		Help: "Total number of 2PC decisions",
+	}, []string{"decision"}) // decision: commit, abort
+
+	TwoPCDuration = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "publisher_2pc_duration_seconds",
+		Help:    "Time from xT start to decision",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15), // 1ms to ~16s
+	})
+
+	TwoPCTimeoutsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "publisher_2pc_timeouts_total",
+		Help: "Total number of xTs whose vote deadline passed",
+	})
+
+	TwoPCForcedAbortsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_2pc_forced_aborts_total",
+		Help: "Total number of xTs aborted by the coordinator without an abort vote",
+	}, []string{"reason"}) // reason: timeout, disconnect
+
+	ChainQueueDepth = promauto.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "publisher_chain_queue_depth",
+		Help: "Number of xTs waiting for a chain to leave the prepare phase",
+	}, []string{"chain_id"})
+
+	SlotCurrent = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "publisher_slot_current",
+		Help: "Current slot number",
+	})
+
+	SlotSealsTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_slot_seals_total",
+		Help: "Total number of sealed-block acknowledgements",
+	}, []string{"chain_id", "status"}) // status: on_time, late
+
+	SlotSealsMissedTotal = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "publisher_slot_seals_missed_total",
+		Help: "Total number of slots a chain failed to seal before the deadline",
+	}, []string{"chain_id"})
+
+	SlotSealLatency = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "publisher_slot_seal_latency_seconds",
+		Help:    "Time from RequestSeal to sealed-block acknowledgement",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15), // 1ms to ~16s
+	})
+
+	ClusterTerm = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "publisher_cluster_term",
+		Help: "Current Raft term of this node",
+	})
+
+	ClusterLeader = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "publisher_cluster_leader",
+		Help: "Whether this node leads the cluster (1) or not (0)",
+	})
+
+	ClusterCommitIndex = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "publisher_cluster_commit_index",
+		Help: "Index of the last committed entry of the replicated log",
+	})
+
+	ClusterElectionsTotal = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "publisher_cluster_elections_total",
+		Help: "Total number of elections started by this node",
+	})
 )
 
 // RecordMessageReceived records a received message.
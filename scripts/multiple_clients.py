@@ -9,6 +9,35 @@ import time
 import random
 from datetime import datetime
 
+PROTOCOL_VERSION = 1
+
+# Frame header: magic "SP", frame version, flags, payload length, CRC32C of the payload
+FRAME_MAGIC = b'SP'
+FRAME_VERSION = 1
+FRAME_HEADER_SIZE = 12
+
+def _crc32c_table():
+    table = []
+    for i in range(256):
+        crc = i
+        for _ in range(8):
+            crc = (crc >> 1) ^ 0x82F63B78 if crc & 1 else crc >> 1
+        table.append(crc)
+    return table
+
+_CRC32C_TABLE = _crc32c_table()
+
+def crc32c(data):
+    """CRC-32C (Castagnoli) checksum"""
+    crc = 0xFFFFFFFF
+    for b in data:
+        crc = _CRC32C_TABLE[(crc ^ b) & 0xFF] ^ (crc >> 8)
+    return crc ^ 0xFFFFFFFF
+
+def frame(message):
+    """Prefix a serialized Message with the frame header"""
+    return FRAME_MAGIC + bytes([FRAME_VERSION, 0]) + struct.pack('>II', len(message), crc32c(message)) + message
+
 class SequencerClient:
     def __init__(self, client_id, chain_id, host='localhost', port=8080):
         self.client_id = client_id
@@ -22,8 +51,34 @@ class SequencerClient:
         """Connect to publisher"""
         self.socket = socket.socket(socket.AF_INET, socket.SOCK_STREAM)
         self.socket.connect((self.host, self.port))
+
+        # Handshake: Hello (Message field 10) must be the first message
+        name = self.client_id.encode('utf-8')
+        hello = b''
+        hello += b'\x0a' + bytes([len(self.chain_id)]) + self.chain_id
+        hello += b'\x12' + bytes([len(name)]) + name
+        hello += b'\x18' + bytes([PROTOCOL_VERSION])
+        message = b'\x52' + bytes([len(hello)]) + hello
+        self.socket.sendall(frame(message))
+
+        # Wait for the Welcome
+        self.socket.settimeout(5.0)
+        header = self.recv_exact(FRAME_HEADER_SIZE)
+        if header[:2] != FRAME_MAGIC:
+            raise ConnectionError(f"not a publisher frame: {header[:2]!r}")
+        self.recv_exact(struct.unpack('>I', header[4:8])[0])
         print(f"[{self.client_id}] Connected to {self.host}:{self.port}")
 
+    def recv_exact(self, n):
+        """Read exactly n bytes"""
+        data = b''
+        while len(data) < n:
+            chunk = self.socket.recv(n - len(data))
+            if not chunk:
+                raise ConnectionError("connection closed during handshake")
+            data += chunk
+        return data
+
     def create_message(self, tx_data):
         """Create protobuf message"""
         # TransactionRequest
@@ -48,9 +103,8 @@ class SequencerClient:
         tx_data = f"TX from {self.client_id} at {time.time():.2f}".encode()
         message = self.create_message(tx_data)
 
-        # Send with length prefix
-        length_prefix = struct.pack('>I', len(message))
-        self.socket.sendall(length_prefix + message)
+        # Send with the frame header
+        self.socket.sendall(frame(message))
         print(f"[{self.client_id}] Sent transaction ({len(message)} bytes)")
 
     def receive_broadcasts(self):
@@ -58,12 +112,17 @@ class SequencerClient:
         self.socket.settimeout(1.0)
         while self.running:
             try:
-                # Read length
-                length_data = self.socket.recv(4)
-                if not length_data:
+                # Read the frame header
+                header = self.socket.recv(FRAME_HEADER_SIZE)
+                if not header:
                     break
+                while len(header) < FRAME_HEADER_SIZE:
+                    chunk = self.socket.recv(FRAME_HEADER_SIZE - len(header))
+                    if not chunk:
+                        raise ConnectionError("connection closed mid-frame")
+                    header += chunk
 
-                length = struct.unpack('>I', length_data)[0]
+                length = struct.unpack('>I', header[4:8])[0]
 
                 # Read message
                 message_data = b''
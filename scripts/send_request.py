@@ -66,6 +66,85 @@ def create_xt_request_message(sender_id="python-sequencer", chain_id=b'\x12\x34'
 
     return message
 
+PROTOCOL_VERSION = 1
+
+# Frame header: magic "SP", frame version, flags, payload length, CRC32C of the payload
+FRAME_MAGIC = b'SP'
+FRAME_VERSION = 1
+FRAME_HEADER_SIZE = 12
+
+def _crc32c_table():
+    table = []
+    for i in range(256):
+        crc = i
+        for _ in range(8):
+            crc = (crc >> 1) ^ 0x82F63B78 if crc & 1 else crc >> 1
+        table.append(crc)
+    return table
+
+_CRC32C_TABLE = _crc32c_table()
+
+def crc32c(data):
+    """CRC-32C (Castagnoli) checksum"""
+    crc = 0xFFFFFFFF
+    for b in data:
+        crc = _CRC32C_TABLE[(crc ^ b) & 0xFF] ^ (crc >> 8)
+    return crc ^ 0xFFFFFFFF
+
+def frame(message):
+    """Prefix a serialized Message with the frame header"""
+    return FRAME_MAGIC + bytes([FRAME_VERSION, 0]) + struct.pack('>II', len(message), crc32c(message)) + message
+
+def create_hello_message(sender_id, chain_id, name):
+    """
+    Every connection starts with a Hello:
+    Message {
+        string sender_id = 1;
+        oneof payload {
+            Hello hello = 10;
+        }
+    }
+    Hello {
+        bytes chain_id = 1;
+        string name = 2;
+        uint32 protocol_version = 3;
+    }
+    """
+    name_bytes = name.encode('utf-8')
+
+    hello = b''
+    hello += b'\x0a' + bytes([len(chain_id)]) + chain_id        # Field 1: chain_id
+    hello += b'\x12' + bytes([len(name_bytes)]) + name_bytes    # Field 2: name
+    hello += b'\x18' + bytes([PROTOCOL_VERSION])                # Field 3: protocol_version (varint)
+
+    message = b''
+    message += b'\x0a' + bytes([len(sender_id)]) + sender_id.encode('utf-8')
+    message += b'\x52' + bytes([len(hello)]) + hello  # Field 10, wire type 2
+
+    return message
+
+def read_frame(sock):
+    """Read one framed message, or None when the connection closed"""
+    header = b''
+    while len(header) < FRAME_HEADER_SIZE:
+        chunk = sock.recv(FRAME_HEADER_SIZE - len(header))
+        if not chunk:
+            return None
+        header += chunk
+
+    if header[:2] != FRAME_MAGIC:
+        raise ConnectionError(f"not a publisher frame: {header[:2]!r}")
+    length = struct.unpack('>I', header[4:8])[0]
+
+    message_data = b''
+    while len(message_data) < length:
+        chunk = sock.recv(length - len(message_data))
+        if not chunk:
+            break
+        message_data += chunk
+
+    return message_data
+
 def send_request(host='localhost', port=8080):
     """Send a request to the publisher"""
     try:
@@ -75,19 +154,30 @@ def send_request(host='localhost', port=8080):
         sock.connect((host, port))
         print(f"[{datetime.now().strftime('%H:%M:%S')}] Connected!")
 
+        sender_id = f"python-sequencer-{int(time.time())}"
+        chain_id = b'\x12\x34'
+
+        # Handshake: the publisher answers the Hello with a Welcome
+        hello = create_hello_message(sender_id, chain_id, "python-sequencer")
+        sock.sendall(frame(hello))
+        sock.settimeout(5.0)
+        if read_frame(sock) is None:
+            print(f"[{datetime.now().strftime('%H:%M:%S')}] Handshake rejected")
+            return 1
+        print(f"[{datetime.now().strftime('%H:%M:%S')}] Handshake complete")
+
         # Create message
         message = create_xt_request_message(
-            sender_id=f"python-sequencer-{int(time.time())}",
-            chain_id=b'\x12\x34',
+            sender_id=sender_id,
+            chain_id=chain_id,
             transactions=[
                 b'Transaction data 1 at ' + str(time.time()).encode(),
                 b'Transaction data 2 at ' + str(time.time()).encode(),
             ]
         )
 
-        # Send with length prefix (4 bytes, big-endian)
-        length_prefix = struct.pack('>I', len(message))
-        data = length_prefix + message
+        # Send with the frame header (12 bytes)
+        data = frame(message)
 
         print(f"[{datetime.now().strftime('%H:%M:%S')}] Sending message ({len(message)} bytes)...")
         sock.sendall(data)
@@ -99,23 +189,11 @@ def send_request(host='localhost', port=8080):
 
         try:
             while True:
-                # Read length prefix
-                length_data = sock.recv(4)
-                if not length_data:
+                message_data = read_frame(sock)
+                if message_data is None:
                     break
 
-                length = struct.unpack('>I', length_data)[0]
-                print(f"[{datetime.now().strftime('%H:%M:%S')}] Receiving broadcast ({length} bytes)...")
-
-                # Read message
-                message_data = b''
-                while len(message_data) < length:
-                    chunk = sock.recv(length - len(message_data))
-                    if not chunk:
-                        break
-                    message_data += chunk
-
-                print(f"[{datetime.now().strftime('%H:%M:%S')}] Received broadcast message")
+                print(f"[{datetime.now().strftime('%H:%M:%S')}] Received broadcast message ({len(message_data)} bytes)")
 
         except socket.timeout:
             print(f"[{datetime.now().strftime('%H:%M:%S')}] No more broadcasts (timeout)")